@@ -2,6 +2,7 @@ package cflog2otel
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
@@ -14,9 +15,32 @@ import (
 
 func Aggregate(ctx context.Context, cfg *Config, celVariables *CELVariables, logs []CELVariablesLog) ([]*metricdata.ResourceMetrics, error) {
 	resourceMetrics := make([]*metricdata.ResourceMetrics, 0)
+	if celVariables.Router == nil {
+		celVariables.Router = cfg.Router()
+	}
+	if celVariables.Definitions == nil {
+		celVariables.Definitions = cfg.CELDefinitions()
+	}
+	if celVariables.CELEnv == nil {
+		celVariables.CELEnv = cfg.CELEnv()
+	}
+	celVariables.LogRefs = celVariables.LogRefs.Merge(cfg.LogReferences())
+	trace := aggregateTraceFromContext(ctx)
 	for _, l := range logs {
 		celVariables.SetLogLine(l)
-		attrs, err := ToAttributes(ctx, cfg.ResourceAttributes, celVariables)
+		lt := trace.startLine(l)
+		var resourceTraces *[]AttributeTrace
+		if lt != nil {
+			resourceTraces = &lt.ResourceAttributes
+		}
+		attrs, err := toAttributes(ctx, cfg.ResourceAttributes, celVariables, resourceTraces)
+		if errors.Is(err, ErrSkipLine) {
+			slog.DebugContext(ctx, "skip log line for resource attributes", "error", err)
+			if lt != nil {
+				lt.Skipped = err.Error()
+			}
+			continue
+		}
 		if err != nil {
 			return nil, oops.Wrapf(err, "failed to convert attributes")
 		}
@@ -66,7 +90,13 @@ func Aggregate(ctx context.Context, cfg *Config, celVariables *CELVariables, log
 				})
 				metricsIndex = len(target.ScopeMetrics[0].Metrics) - 1
 			}
-			target.ScopeMetrics[0].Metrics[metricsIndex], err = aggregateMetric(ctx, target.ScopeMetrics[0].Metrics[metricsIndex], mcfg, celVariables)
+			mt := lt.startMetric(mcfg.Name)
+			target.ScopeMetrics[0].Metrics[metricsIndex], err = aggregateMetric(ctx, target.ScopeMetrics[0].Metrics[metricsIndex], mcfg, celVariables, mt)
+			if errors.Is(err, ErrSkipLine) {
+				slog.DebugContext(ctx, "skip log line for metric", "metric", mcfg.Name, "error", err)
+				mt.skip(err.Error())
+				continue
+			}
 			if err != nil {
 				return nil, oops.Wrapf(err, "failed to aggregate metric %q", mcfg.Name)
 			}
@@ -109,24 +139,29 @@ func LenDataPoints(data metricdata.Aggregation) int {
 	}
 }
 
-func aggregateMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables) (metricdata.Metrics, error) {
+// aggregateMetric aggregates the current log line to the metric. if mt is not nil, the evaluation is recorded to it.
+func aggregateMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables, mt *MetricTrace) (metricdata.Metrics, error) {
 	if config.Filter != nil {
-		isTarget, err := config.Filter.Eval(ctx, vars)
+		isTarget, ft, err := evalWithTrace(ctx, config.Filter, vars, mt != nil)
+		if mt != nil {
+			mt.Filter = ft
+		}
 		if err != nil {
 			return metrics, oops.Wrapf(err, "failed to evaluate filter")
 		}
 		if !isTarget {
 			slog.DebugContext(ctx, "not a target log, skipping")
+			mt.skip("filter rejected")
 			return metrics, nil
 		}
 	}
 	switch config.Type {
 	case AggregationTypeCount:
-		return aggregateForCountMetric(ctx, metrics, config, vars)
+		return aggregateForCountMetric(ctx, metrics, config, vars, mt)
 	case AggregationTypeSum:
-		return aggregateForSumMetric(ctx, metrics, config, vars)
+		return aggregateForSumMetric(ctx, metrics, config, vars, mt)
 	case AggregationTypeHistogram:
-		return aggregateForHistogramMetric(ctx, metrics, config, vars)
+		return aggregateForHistogramMetric(ctx, metrics, config, vars, mt)
 	default:
 		return metricdata.Metrics{}, oops.Errorf("unsupported aggregation type %q", config.Type)
 	}
@@ -137,17 +172,24 @@ func getStartTimeAndTime(config MetricsConfig, t time.Time) (time.Time, time.Tim
 	return startTime, startTime.Add(config.AggregateInterval())
 }
 
-func getAggregateAxis(ctx context.Context, config MetricsConfig, vars *CELVariables) (time.Time, time.Time, attribute.Set, error) {
-	attrs, err := ToAttributes(ctx, config.Attributes, vars)
+func getAggregateAxis(ctx context.Context, config MetricsConfig, vars *CELVariables, mt *MetricTrace) (time.Time, time.Time, attribute.Set, error) {
+	var attrTraces *[]AttributeTrace
+	if mt != nil {
+		attrTraces = &mt.Attributes
+	}
+	attrs, err := toAttributes(ctx, config.ResolvedAttributes(), vars, attrTraces)
 	if err != nil {
 		return time.Time{}, time.Time{}, attribute.Set{}, oops.Wrapf(err, "failed to convert attributes")
 	}
 	attrSet := attribute.NewSet(attrs...)
 	startTime, t := getStartTimeAndTime(config, vars.Log.Timestamp)
+	if mt != nil {
+		mt.StartTime, mt.Time = &startTime, &t
+	}
 	return startTime, t, attrSet, nil
 }
 
-func aggregateForCountMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables) (metricdata.Metrics, error) {
+func aggregateForCountMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables, mt *MetricTrace) (metricdata.Metrics, error) {
 	if metrics.Data == nil {
 		temporality := metricdata.DeltaTemporality
 		if config.IsCumulative {
@@ -163,7 +205,7 @@ func aggregateForCountMetric(ctx context.Context, metrics metricdata.Metrics, co
 	if !ok {
 		return metrics, oops.Errorf("unsupported data type for counter")
 	}
-	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars)
+	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars, mt)
 	if err != nil {
 		return metrics, oops.Wrapf(err, "failed to get aggregate axis")
 	}
@@ -191,7 +233,7 @@ func aggregateForCountMetric(ctx context.Context, metrics metricdata.Metrics, co
 	return metrics, nil
 }
 
-func aggregateForSumMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables) (metricdata.Metrics, error) {
+func aggregateForSumMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables, mt *MetricTrace) (metricdata.Metrics, error) {
 	if metrics.Data == nil {
 		temporality := metricdata.DeltaTemporality
 		if config.IsCumulative {
@@ -207,11 +249,14 @@ func aggregateForSumMetric(ctx context.Context, metrics metricdata.Metrics, conf
 	if !ok {
 		return metrics, oops.Errorf("unsupported data type for counter")
 	}
-	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars)
+	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars, mt)
 	if err != nil {
 		return metrics, oops.Wrapf(err, "failed to get aggregate axis")
 	}
-	value, err := config.Value.Eval(ctx, vars)
+	value, vt, err := evalWithTrace(ctx, config.Value, vars, mt != nil)
+	if mt != nil {
+		mt.Value = vt
+	}
 	if err != nil {
 		return metrics, oops.Wrapf(err, "failed to evaluate value")
 	}
@@ -240,7 +285,7 @@ func aggregateForSumMetric(ctx context.Context, metrics metricdata.Metrics, conf
 	return metrics, nil
 }
 
-func aggregateForHistogramMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables) (metricdata.Metrics, error) {
+func aggregateForHistogramMetric(ctx context.Context, metrics metricdata.Metrics, config MetricsConfig, vars *CELVariables, mt *MetricTrace) (metricdata.Metrics, error) {
 	if metrics.Data == nil {
 		temporality := metricdata.DeltaTemporality
 		if config.IsCumulative {
@@ -255,11 +300,14 @@ func aggregateForHistogramMetric(ctx context.Context, metrics metricdata.Metrics
 	if !ok {
 		return metrics, oops.Errorf("unsupported data type for histogram")
 	}
-	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars)
+	startTime, t, attrSet, err := getAggregateAxis(ctx, config, vars, mt)
 	if err != nil {
 		return metrics, oops.Wrapf(err, "failed to get aggregate axis")
 	}
-	value, err := config.Value.Eval(ctx, vars)
+	value, vt, err := evalWithTrace(ctx, config.Value, vars, mt != nil)
+	if mt != nil {
+		mt.Value = vt
+	}
 	if err != nil {
 		return metrics, oops.Wrapf(err, "failed to evaluate value")
 	}
@@ -19,11 +19,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/cel-go/cel"
 	"github.com/mashiike/slogutils"
 	"github.com/samber/oops"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
@@ -31,28 +32,122 @@ type App struct {
 	cfg        *Config
 	client     S3APIClient
 	downloader *manager.Downloader
+	geoip      *GeoIPDatabase
+	userAgent  *UserAgentParser
+	// distributions is kept across invocations to cache the metadata of distributions.
+	distributions *CloudFrontDistributionResolver
 }
 
-func New(ctx context.Context, cfg *Config) (*App, error) {
-	awsCfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, oops.Wrapf(err, "failed to load AWS config")
+// Option configures App.
+type Option func(*appOptions)
+
+type appOptions struct {
+	client           S3APIClient
+	cloudFrontClient CloudFrontAPIClient
+	celEnvOptions    []cel.EnvOption
+	celVariables     []CELVariable
+}
+
+// WithS3Client sets the S3 client. if not set, the client is created from the default AWS config.
+func WithS3Client(client S3APIClient) Option {
+	return func(o *appOptions) {
+		o.client = client
 	}
-	client := s3.NewFromConfig(awsCfg)
-	return NewWithClient(cfg, client)
+}
+
+// WithCloudFrontClient sets the CloudFront client for `enrichment.cloudfront.api`.
+// if not set, the client is created from the default AWS config.
+func WithCloudFrontClient(client CloudFrontAPIClient) Option {
+	return func(o *appOptions) {
+		o.cloudFrontClient = client
+	}
+}
+
+// WithCELEnvOptions adds options of CEL environment, such as custom functions by cel.Function or cel.Lib.
+func WithCELEnvOptions(opts ...cel.EnvOption) Option {
+	return func(o *appOptions) {
+		o.celEnvOptions = append(o.celEnvOptions, opts...)
+	}
+}
+
+// WithCELVariable adds an extra variable namespace to CEL environment.
+func WithCELVariable(v CELVariable) Option {
+	return func(o *appOptions) {
+		o.celVariables = append(o.celVariables, v)
+	}
+}
+
+func New(ctx context.Context, cfg *Config, opts ...Option) (*App, error) {
+	var o appOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	needsCloudFront := cfg.Enrichment.CloudFront != nil && cfg.Enrichment.CloudFront.API
+	if o.client == nil || (needsCloudFront && o.cloudFrontClient == nil) {
+		awsCfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to load AWS config")
+		}
+		if o.client == nil {
+			o.client = s3.NewFromConfig(awsCfg)
+		}
+		if needsCloudFront && o.cloudFrontClient == nil {
+			o.cloudFrontClient = cloudfront.NewFromConfig(awsCfg)
+		}
+	}
+	return newApp(ctx, cfg, o)
 }
 
 type S3APIClient interface {
 	manager.DownloadAPIClient
 	s3.ListObjectsV2APIClient
+	s3.HeadObjectAPIClient
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+}
+
+func NewWithClient(cfg *Config, client S3APIClient, opts ...Option) (*App, error) {
+	return New(context.Background(), cfg, append(opts, WithS3Client(client))...)
 }
 
-func NewWithClient(cfg *Config, client S3APIClient) (*App, error) {
-	return &App{
-		cfg:        cfg,
-		client:     client,
-		downloader: manager.NewDownloader(client),
-	}, nil
+// newApp returns App with the copy of config bound to the CEL environment of the options,
+// so Apps with different environments can coexist in one process.
+func newApp(ctx context.Context, cfg *Config, o appOptions) (*App, error) {
+	env, err := NewCELEnv(o.celEnvOptions, o.celVariables...)
+	if err != nil {
+		return nil, err
+	}
+	bound, err := cfg.WithCELEnv(env)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to bind config to CEL environment")
+	}
+	app := &App{
+		cfg:        bound,
+		client:     o.client,
+		downloader: manager.NewDownloader(o.client),
+	}
+	if bound.Enrichment.GeoIP != nil {
+		db, err := LoadGeoIPDatabase(ctx, bound.Enrichment.GeoIP, app.downloader)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to load geoip database")
+		}
+		app.geoip = db
+	}
+	if bound.Enrichment.UserAgent != nil {
+		parser, err := LoadUserAgentRules(ctx, bound.Enrichment.UserAgent, app.downloader)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to load user agent rules")
+		}
+		app.userAgent = parser
+	}
+	if bound.Enrichment.CloudFront != nil {
+		resolver, err := NewCloudFrontDistributionResolver(bound.Enrichment.CloudFront, o.cloudFrontClient)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to create cloudfront distribution resolver")
+		}
+		app.distributions = resolver
+	}
+	return app, nil
 }
 
 func unwrapSQSEvent(ctx context.Context, eventIter iter.Seq[json.RawMessage]) iter.Seq[json.RawMessage] {
@@ -214,13 +309,23 @@ func (app *App) Process(ctx context.Context, notifications []events.S3EventRecor
 			slog.WarnContext(ctx, "failed to shutdown exporter", "error", err)
 		}
 	}()
-	recourceMetrics := make([]*metricdata.ResourceMetrics, 0)
-	for _, notification := range notifications {
+	lookups := app.newLookups()
+	// processing stops before the deadline, so that the error is returned instead of timeout.
+	processCtx, cancel := withDeadlineMargin(ctx)
+	defer cancel()
+	results, err := parallelMap(processCtx, app.cfg.ConcurrencyValue(), notifications, func(ctx context.Context, notification events.S3EventRecord) ([]*metricdata.ResourceMetrics, error) {
 		slog.InfoContext(ctx, "processing notification", "bucket", notification.S3.Bucket.Name, "key", notification.S3.Object.Key)
-		metrics, err := app.generateMetrics(ctx, notification)
+		metrics, err := app.generateMetrics(ctx, notification, lookups)
 		if err != nil {
-			return oops.Wrapf(err, "failed to generate metrics[s3://%s/%s]", notification.S3.Bucket.Name, notification.S3.Object.Key)
+			return nil, oops.Wrapf(err, "failed to generate metrics[s3://%s/%s]", notification.S3.Bucket.Name, notification.S3.Object.Key)
 		}
+		return metrics, nil
+	})
+	if err != nil {
+		return err
+	}
+	recourceMetrics := make([]*metricdata.ResourceMetrics, 0)
+	for _, metrics := range results {
 		recourceMetrics = append(recourceMetrics, metrics...)
 	}
 	if len(recourceMetrics) == 0 {
@@ -240,23 +345,6 @@ func (app *App) Process(ctx context.Context, notifications []events.S3EventRecor
 	return nil
 }
 
-func newOtelExporter(ctx context.Context, oc OtelConfig) (*otlpmetricgrpc.Exporter, string, error) {
-	opts := make([]otlpmetricgrpc.Option, 0)
-	if len(oc.Headers) > 0 {
-		opts = append(opts, otlpmetricgrpc.WithHeaders(oc.Headers))
-	}
-	if oc.GZip {
-		opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
-	}
-	endpointURL := oc.EndpointURL().String()
-	opts = append(opts, otlpmetricgrpc.WithEndpointURL(endpointURL))
-	exporter, err := otlpmetricgrpc.New(ctx, opts...)
-	if err != nil {
-		return nil, "", err
-	}
-	return exporter, endpointURL, nil
-}
-
 // WriteAtBuffer is an in-memory buffer implementing io.WriterAt
 type WriteAtBuffer struct {
 	buf *bytes.Buffer
@@ -280,94 +368,221 @@ func (w *WriteAtBuffer) Bytes() []byte {
 	return w.buf.Bytes()
 }
 
-func (app *App) generateMetrics(ctx context.Context, notification events.S3EventRecord) ([]*metricdata.ResourceMetrics, error) {
+// invocationLookups holds the lookup caches shared in one invocation.
+type invocationLookups struct {
+	geoip     *CELGeoIP
+	userAgent *CELUserAgent
+	s3Tags    *S3TagsLookup
+}
+
+func (app *App) newLookups() invocationLookups {
+	lookups := invocationLookups{
+		s3Tags: NewS3TagsLookup(app.client),
+	}
+	if app.geoip != nil {
+		lookups.geoip = app.geoip.NewLookup()
+	}
+	if app.userAgent != nil {
+		lookups.userAgent = app.userAgent.NewLookup()
+	} else {
+		lookups.userAgent = defaultUserAgentParser.NewLookup()
+	}
+	return lookups
+}
+
+func (app *App) generateMetrics(ctx context.Context, notification events.S3EventRecord, lookups invocationLookups) ([]*metricdata.ResourceMetrics, error) {
 
 	ctx = slogutils.With(ctx,
 		"bucket_name", notification.S3.Bucket.Name,
 		"object_key", notification.S3.Object.Key,
 	)
 	slog.InfoContext(ctx, "starting metrics generation")
-	celVariables, logs, err := app.GetVariablesAndLogs(ctx, notification)
+	celVariables, logs, stats, intervals, err := app.getVariablesAndLogs(ctx, notification)
 	if err != nil {
 		return nil, oops.Wrapf(err, "failed to get variables and logs")
 	}
+	resourceMetrics, err := app.aggregateLogs(ctx, notification, celVariables, logs, stats, lookups)
+	if err != nil {
+		return nil, err
+	}
+	if intervals != nil {
+		resourceMetrics = intervals.filter(resourceMetrics)
+	}
+	return resourceMetrics, nil
+}
+
+// aggregateLogs enriches the variables and aggregates the logs of the notification, including self metrics.
+func (app *App) aggregateLogs(ctx context.Context, notification events.S3EventRecord, celVariables *CELVariables, logs []CELVariablesLog, stats *ParseStats, lookups invocationLookups) ([]*metricdata.ResourceMetrics, error) {
+	if celVariables != nil {
+		celVariables.GeoIP = lookups.geoip
+		celVariables.UserAgent = lookups.userAgent
+		app.distributions.SetVariables(ctx, &celVariables.CloudFront)
+		if len(logs) > 0 {
+			if err := lookups.s3Tags.SetVariables(ctx, app.cfg.S3References(), celVariables); err != nil {
+				return nil, oops.Wrapf(err, "failed to get S3 tags and metadata")
+			}
+		}
+	}
+	resourceMetrics := make([]*metricdata.ResourceMetrics, 0)
+	var err error
 	if len(logs) == 0 {
 		slog.InfoContext(ctx, "no logs to process")
-		return []*metricdata.ResourceMetrics{}, nil
+	} else {
+		resourceMetrics, err = Aggregate(ctx, app.cfg, celVariables, logs)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to aggregate metrics")
+		}
 	}
-	resourceMetrics, err := Aggregate(ctx, app.cfg, celVariables, logs)
-	if err != nil {
-		return nil, oops.Wrapf(err, "failed to aggregate metrics")
+	if app.cfg.Parse.OnError == ParseErrorPolicySkipAndCount && stats.TotalLines > 0 {
+		selfMetrics, err := NewParseSelfMetrics(ctx, app.cfg, celVariables, stats, notification.EventTime)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to generate self metrics")
+		}
+		resourceMetrics = append(resourceMetrics, selfMetrics)
 	}
 	return resourceMetrics, nil
 }
 
-func (app *App) GetVariablesAndLogs(ctx context.Context, notification events.S3EventRecord) (*CELVariables, []CELVariablesLog, error) {
-	prefix, distributionID, datehour, _, err := ParseCFStandardLogObjectKey(notification.S3.Object.Key)
-	if err != nil {
-		if app.cfg.NoSkip {
-			return nil, nil, oops.Wrapf(err, "parse object key[%s]", notification.S3.Object.Key)
+func (app *App) GetVariablesAndLogs(ctx context.Context, notification events.S3EventRecord) (*CELVariables, []CELVariablesLog, *ParseStats, error) {
+	celVariables, logs, stats, _, err := app.getVariablesAndLogs(ctx, notification)
+	return celVariables, logs, stats, err
+}
+
+// getVariablesAndLogs returns the variables and logs of the notification, including backfill.
+// in backfill mode interval, it also returns the intervals to export.
+func (app *App) getVariablesAndLogs(ctx context.Context, notification events.S3EventRecord) (*CELVariables, []CELVariablesLog, *ParseStats, backfillIntervals, error) {
+	parser, fixed := app.cfg.Parse.Parser()
+	var (
+		prefix, distributionID, datehour string
+		keyErr                           error
+	)
+	if fixed && parser.Name() == LogFormatCloudFrontStandard {
+		prefix, distributionID, datehour, _, keyErr = ParseCFStandardLogObjectKey(notification.S3.Object.Key)
+		if keyErr != nil {
+			if app.cfg.NoSkip {
+				return nil, nil, nil, nil, oops.Wrapf(keyErr, "parse object key[%s]", notification.S3.Object.Key)
+			}
+			slog.WarnContext(ctx, "skipping object", "reason", keyErr.Error())
+			return nil, []CELVariablesLog{}, &ParseStats{}, nil, nil
 		}
-		slog.WarnContext(ctx, "skipping object", "reason", err.Error())
-		return nil, []CELVariablesLog{}, nil
 	}
 	reader, err := NewS3ObjectReader(ctx, app.downloader, notification.S3.Bucket.Name, notification.S3.Object.Key)
 	if err != nil {
-		return nil, nil, oops.Wrapf(err, "failed to create object reader")
+		return nil, nil, nil, nil, oops.Wrapf(err, "failed to create object reader")
+	}
+	if !fixed {
+		parser, reader, err = detectLogParser(notification.S3.Object.Key, reader)
+		if err != nil {
+			if app.cfg.NoSkip {
+				return nil, nil, nil, nil, err
+			}
+			slog.WarnContext(ctx, "skipping object", "reason", err.Error())
+			return nil, []CELVariablesLog{}, &ParseStats{}, nil, nil
+		}
+		slog.DebugContext(ctx, "detected log format", "format", parser.Name())
+		if parser.Name() == LogFormatCloudFrontStandard {
+			prefix, distributionID, datehour, _, keyErr = ParseCFStandardLogObjectKey(notification.S3.Object.Key)
+		}
 	}
-	logs, err := ParseCloudFrontLog(ctx, reader)
+	logs, stats, err := ParseLog(ctx, parser, reader, app.cfg.Parse)
 	if err != nil {
-		return nil, nil, oops.Wrapf(err, "failed to parse cloudfront log")
+		return nil, nil, nil, nil, oops.Wrapf(err, "failed to parse %s log", parser.Name())
 	}
-	if app.cfg.Backfill.Enabled {
+	var intervals backfillIntervals
+	// backfill lists the objects of the same hour, by the object key of CloudFront standard logs.
+	if app.cfg.Backfill.Enabled && parser.Name() == LogFormatCloudFrontStandard && keyErr == nil {
 		currentObjectLines := len(logs)
 		skipLines := 0
 		backfilTotalLines := 0
 		eventTime := notification.EventTime
-		p := s3.NewListObjectsV2Paginator(app.client, &s3.ListObjectsV2Input{
-			Bucket: &notification.S3.Bucket.Name,
-			Prefix: aws.String(fmt.Sprintf("%s%s.%s.", prefix, distributionID, datehour)),
-		})
-		timeTolerance := app.cfg.Backfill.TimeToleranceDuration()
-		for p.HasMorePages() {
-			out, err := p.NextPage(ctx)
-			if err != nil {
-				return nil, nil, oops.Wrapf(err, "failed to list objects")
-			}
-			for _, obj := range out.Contents {
-				if *obj.Key == notification.S3.Object.Key {
-					continue
-				}
-				if d := eventTime.Sub(*obj.LastModified); d > timeTolerance {
-					slog.InfoContext(ctx, "skipping backfill object", "key", *obj.Key, "last_modified", *obj.LastModified, "time_tolerance", timeTolerance, "since", d)
-					continue
+		mode := app.cfg.Backfill.Mode
+		datehours := []string{datehour}
+		if mode == BackfillModeInterval {
+			intervals = newBackfillIntervals(app.cfg.Metrics, logs)
+			// the lines of the object may be in the intervals of the other hours, e.g. delivered late,
+			// and the late lines of the intervals may be in the objects of the following hours,
+			// so the siblings of those hours are also read to recompute the intervals from the complete set.
+			for _, h := range intervals.hours() {
+				if !slices.Contains(datehours, h) {
+					datehours = append(datehours, h)
 				}
-				reader, err := NewS3ObjectReader(ctx, app.downloader, notification.S3.Bucket.Name, *obj.Key)
+			}
+		}
+		timeTolerance := app.cfg.Backfill.TimeToleranceDuration()
+		var backfillKeys []string
+		for _, h := range datehours {
+			p := s3.NewListObjectsV2Paginator(app.client, &s3.ListObjectsV2Input{
+				Bucket: &notification.S3.Bucket.Name,
+				Prefix: aws.String(fmt.Sprintf("%s%s.%s.", prefix, distributionID, h)),
+			})
+			for p.HasMorePages() {
+				out, err := p.NextPage(ctx)
 				if err != nil {
-					return nil, nil, oops.Wrapf(err, "failed to create object reader")
+					return nil, nil, nil, nil, oops.Wrapf(err, "failed to list objects")
 				}
-				currentLogs, err := ParseCloudFrontLog(ctx, reader)
-				if err != nil {
-					return nil, nil, oops.Wrapf(err, "failed to parse cloudfront log")
+				for _, obj := range out.Contents {
+					if *obj.Key == notification.S3.Object.Key {
+						continue
+					}
+					if d := eventTime.Sub(*obj.LastModified); mode == BackfillModeTimeTolerance && d > timeTolerance {
+						slog.InfoContext(ctx, "skipping backfill object", "key", *obj.Key, "last_modified", *obj.LastModified, "time_tolerance", timeTolerance, "since", d)
+						continue
+					}
+					backfillKeys = append(backfillKeys, *obj.Key)
 				}
-				backfilTotalLines += len(currentLogs)
-				for _, currentLog := range currentLogs {
+			}
+		}
+		if mode == BackfillModeInterval && currentObjectLines == 0 {
+			// no intervals are touched, so the siblings are not needed.
+			backfillKeys = nil
+		}
+		// objects are downloaded concurrently, and merged in the order of listing to keep the output stable.
+		objects, err := parallelMap(ctx, app.cfg.ConcurrencyValue(), backfillKeys, func(ctx context.Context, key string) ([]CELVariablesLog, error) {
+			reader, err := NewS3ObjectReader(ctx, app.downloader, notification.S3.Bucket.Name, key)
+			if err != nil {
+				return nil, oops.Wrapf(err, "failed to create object reader")
+			}
+			// the parse stats of the siblings are not reported, since they are read again on every notification of the hour
+			// and would count the same lines many times. the siblings are reported by their own notifications.
+			currentLogs, _, err := ParseCloudFrontLogWithConfig(ctx, reader, app.cfg.Parse)
+			if err != nil {
+				return nil, oops.Wrapf(err, "failed to parse cloudfront log[%s]", key)
+			}
+			return currentLogs, nil
+		})
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		for _, objectLogs := range objects {
+			backfilTotalLines += len(objectLogs)
+			for _, currentLog := range objectLogs {
+				switch mode {
+				case BackfillModeInterval:
+					if !intervals.contains(app.cfg.Metrics, currentLog.Timestamp) {
+						skipLines++
+						slog.DebugContext(ctx, "skipping backfill log", "timestamp", currentLog.Timestamp, "reason", "not in the intervals of the object")
+						continue
+					}
+				default:
 					if d := eventTime.Sub(currentLog.Timestamp); d > timeTolerance {
 						skipLines++
 						slog.DebugContext(ctx, "skipping backfill log", "timestamp", currentLog.Timestamp, "time_tolerance", timeTolerance, "since", d)
 						continue
 					}
-					logs = append(logs, currentLog)
 				}
+				logs = append(logs, currentLog)
 			}
 		}
 		slices.SortStableFunc(logs, func(i, j CELVariablesLog) int {
 			return i.Timestamp.Compare(j.Timestamp)
 		})
-		slog.InfoContext(ctx, "backfill logs", "total", backfilTotalLines+currentObjectLines, "skipped", skipLines)
+		slog.InfoContext(ctx, "backfill logs", "mode", mode, "total", backfilTotalLines+currentObjectLines, "skipped", skipLines)
 	}
 	celVariables := NewCELVariables(notification, distributionID)
-	return celVariables, logs, nil
+	if len(stats.SkippedLines) > 0 {
+		slog.WarnContext(ctx, "skipped malformed log lines", "total", stats.TotalLines, "skipped", len(stats.SkippedLines))
+	}
+	return celVariables, logs, stats, intervals, nil
 }
 
 func NewS3ObjectReader(ctx context.Context, downloader *manager.Downloader, bucket, key string) (io.Reader, error) {
@@ -413,9 +628,17 @@ func ToAttribute(ctx context.Context, key string, value any) (attribute.KeyValue
 }
 
 func ToAttributes(ctx context.Context, cfgs []AttributeConfig, celVariables *CELVariables) ([]attribute.KeyValue, error) {
+	return toAttributes(ctx, cfgs, celVariables, nil)
+}
+
+// toAttributes evaluates the attributes. if traces is not nil, the evaluations are appended to it.
+func toAttributes(ctx context.Context, cfgs []AttributeConfig, celVariables *CELVariables, traces *[]AttributeTrace) ([]attribute.KeyValue, error) {
 	attrs := make([]attribute.KeyValue, 0)
 	for _, cfg := range cfgs {
-		val, err := cfg.Value.Eval(ctx, celVariables)
+		val, trace, err := evalWithTrace(ctx, cfg.Value, celVariables, traces != nil)
+		if traces != nil {
+			*traces = append(*traces, AttributeTrace{Key: cfg.Key, CELEvalTrace: *trace})
+		}
 		if err != nil {
 			return nil, oops.Wrapf(err, "failed to evaluate attribute")
 		}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Songmu/flextime"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -20,7 +24,10 @@ import (
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
 	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestE2E(t *testing.T) {
@@ -71,6 +78,91 @@ func TestE2E__Backfill(t *testing.T) {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
 	})))
+	restore := flextime.Set(time.Date(2019, 12, 01, 22, 56, 0, 0, time.UTC))
+	defer restore()
+	// the output must not depend on the order of concurrent downloads.
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			ctrl := newMockControler(t)
+			defer ctrl.Finish()
+			client := newMockS3APIClient(ctrl)
+			bs, err := os.ReadFile("testdata/cf_log.txt")
+			require.NoError(t, err)
+			bs2, err := os.ReadFile("testdata/cf_log2.txt")
+			require.NoError(t, err)
+			client.On(
+				"GetObject",
+				mock.Anything,
+				mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+					return input.Bucket != nil && *input.Bucket == "example-bucket" && input.Key != nil && *input.Key == "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"
+				}),
+			).Return(&s3.GetObjectOutput{
+				Body: io.NopCloser(
+					bytes.NewReader(gzipData(bs)),
+				),
+				ContentLength: aws.Int64(int64(len(bs))),
+			}, nil)
+			client.On(
+				"GetObject",
+				mock.Anything,
+				mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+					return input.Bucket != nil && *input.Bucket == "example-bucket" && input.Key != nil && *input.Key == "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz"
+				}),
+			).Return(&s3.GetObjectOutput{
+				Body: io.NopCloser(
+					bytes.NewReader(gzipData(bs2)),
+				),
+				ContentLength: aws.Int64(int64(len(bs2))),
+			}, nil)
+			client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+				Bucket: aws.String("example-bucket"),
+				Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22."),
+			}).Return(&s3.ListObjectsV2Output{
+				Contents: []types.Object{
+					{
+						Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT2KCN4SGK9.gz"),
+						LastModified: aws.Time(time.Date(2019, 12, 01, 22, 05, 0, 0, time.UTC)),
+					},
+					{
+						Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz"),
+						LastModified: aws.Time(time.Date(2019, 12, 01, 22, 40, 0, 0, time.UTC)),
+					},
+					{
+						Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"),
+						LastModified: aws.Time(time.Date(2019, 12, 01, 22, 52, 0, 0, time.UTC)),
+					},
+				},
+			}, nil)
+			cfg := cflog2otel.DefaultConfig()
+			err = cfg.Load("testdata/backfil_config.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+			require.NoError(t, err)
+			cfg.Concurrency = concurrency
+			ctx := context.Background()
+			var sended []*collectormetrics.ExportMetricsServiceRequest
+			server := otlptest.NewMetricsCollector(otlptest.ExporterFunc(
+				func(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+					sended = append(sended, req)
+					return &collectormetrics.ExportMetricsServiceResponse{}, nil
+				},
+			))
+			defer server.Close()
+			cfg.Otel.SetEndpointURL(server.URL)
+			app, err := cflog2otel.NewWithClient(cfg, client)
+			require.NoError(t, err)
+
+			payload, err := os.ReadFile("testdata/s3_notification.json")
+			require.NoError(t, err)
+			_, err = app.Invoke(ctx, payload)
+			require.NoError(t, err)
+			require.Len(t, sended, 1)
+
+			g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+			g.AssertJson(t, "e2e_backfill", sended[0])
+		})
+	}
+}
+
+func TestE2E__BackfillInterval(t *testing.T) {
 	restore := flextime.Set(time.Date(2019, 12, 01, 22, 56, 0, 0, time.UTC))
 	defer restore()
 	ctrl := newMockControler(t)
@@ -104,18 +196,15 @@ func TestE2E__Backfill(t *testing.T) {
 		),
 		ContentLength: aws.Int64(int64(len(bs2))),
 	}, nil)
+	// the sibling is delivered late, but it is read regardless of LastModified.
 	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
 		Bucket: aws.String("example-bucket"),
 		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22."),
 	}).Return(&s3.ListObjectsV2Output{
 		Contents: []types.Object{
-			{
-				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT2KCN4SGK9.gz"),
-				LastModified: aws.Time(time.Date(2019, 12, 01, 22, 05, 0, 0, time.UTC)),
-			},
 			{
 				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz"),
-				LastModified: aws.Time(time.Date(2019, 12, 01, 22, 40, 0, 0, time.UTC)),
+				LastModified: aws.Time(time.Date(2019, 12, 02, 3, 0, 0, 0, time.UTC)),
 			},
 			{
 				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"),
@@ -123,8 +212,397 @@ func TestE2E__Backfill(t *testing.T) {
 			},
 		},
 	}, nil)
+	// the following hour, where the late lines of the intervals are delivered.
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-23."),
+	}).Return(&s3.ListObjectsV2Output{}, nil)
+	cfg := cflog2otel.DefaultConfig()
+	err = cfg.Load("testdata/backfill_interval.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg.Otel.SetEndpointURL(server.URL)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	payload, err := os.ReadFile("testdata/s3_notification.json")
+	require.NoError(t, err)
+	_, err = app.Invoke(ctx, payload)
+	require.NoError(t, err)
+	sended := recorder.Requests()
+	require.Len(t, sended, 1)
+
+	// only the interval 22:30-23:00 touched by the object is exported, with the 4xx lines of the sibling.
+	otlptest.AssertSum(t, sended, "http.server.http_requests", 9)
+	otlptest.AssertSum(t, sended, "http.server.http_requests", 3, attribute.String("http.status_code", "4xx"))
+	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+	g.AssertJson(t, "e2e_backfill_interval", sended[0])
+}
+
+// invokeBackfillIntervalLateLine invokes with the object of the key as the trigger, where the object of 22h has a late line at 21:59:50.
+func invokeBackfillIntervalLateLine(t *testing.T, triggerKey string, hours []string) []*collectormetrics.ExportMetricsServiceRequest {
+	t.Helper()
+	restore := flextime.Set(time.Date(2019, 12, 01, 22, 56, 0, 0, time.UTC))
+	defer restore()
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	objects := map[string]string{
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz": "testdata/cf_log_late.txt",
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz": "testdata/cf_log2.txt",
+		"logs/EMLARXS9EXAMPLE.2019-12-01-21.RT2KCN4SGK9.gz": "testdata/cf_log_prev_hour.txt",
+	}
+	for key, path := range objects {
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		client.On(
+			"GetObject",
+			mock.Anything,
+			mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+				return input.Key != nil && *input.Key == key
+			}),
+		).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+	}
+	for _, hour := range hours {
+		var contents []types.Object
+		for key := range objects {
+			if strings.HasPrefix(key, "logs/EMLARXS9EXAMPLE."+hour+".") {
+				contents = append(contents, types.Object{
+					Key:          aws.String(key),
+					LastModified: aws.Time(time.Date(2019, 12, 01, 22, 52, 0, 0, time.UTC)),
+				})
+			}
+		}
+		slices.SortFunc(contents, func(a, b types.Object) int { return strings.Compare(*a.Key, *b.Key) })
+		client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+			Bucket: aws.String("example-bucket"),
+			Prefix: aws.String("logs/EMLARXS9EXAMPLE." + hour + "."),
+		}).Return(&s3.ListObjectsV2Output{Contents: contents}, nil).Once()
+	}
+	cfg := cflog2otel.DefaultConfig()
+	err := cfg.Load("testdata/backfill_interval.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err)
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg.Otel.SetEndpointURL(server.URL)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	payload, err := os.ReadFile("testdata/s3_notification.json")
+	require.NoError(t, err)
+	payload = bytes.ReplaceAll(payload, []byte("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"), []byte(triggerKey))
+	_, err = app.Invoke(context.Background(), payload)
+	require.NoError(t, err)
+	return recorder.Requests()
+}
+
+func TestE2E__BackfillInterval__LateLine(t *testing.T) {
+	sended := invokeBackfillIntervalLateLine(t, "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz", []string{"2019-12-01-21", "2019-12-01-22", "2019-12-01-23"})
+	require.Len(t, sended, 1)
+
+	// 22:30-23:00 is the same as without the late line, and 21:30-22:00 is recomputed with the sibling of 21h,
+	// the line at 21:10 of the sibling is not in the touched intervals.
+	otlptest.AssertSum(t, sended, "http.server.http_requests", 9+3)
+	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+	g.AssertJson(t, "e2e_backfill_interval_late_line", sended[0])
+}
+
+func TestE2E__BackfillInterval__LateLineInFollowingHour(t *testing.T) {
+	// the object of 21h is the trigger after the object of 22h with the late line has landed.
+	sended := invokeBackfillIntervalLateLine(t, "logs/EMLARXS9EXAMPLE.2019-12-01-21.RT2KCN4SGK9.gz", []string{"2019-12-01-21", "2019-12-01-22"})
+	require.Len(t, sended, 1)
+
+	// 21:00-21:30 has the line at 21:10, and 21:30-22:00 has the lines at 21:45 and the late line at 21:59:50.
+	otlptest.AssertSum(t, sended, "http.server.http_requests", 1+3)
+	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+	g.AssertJson(t, "e2e_backfill_interval_late_line_following_hour", sended[0])
+}
+
+func TestE2E__ExportFaults(t *testing.T) {
+	cases := []struct {
+		name     string
+		faults   []otlptest.Fault
+		retry    *cflog2otel.OtelRetryConfig
+		policy   cflog2otel.PartialSuccessPolicy
+		exported int
+		check    func(t *testing.T, err error)
+	}{
+		{
+			name:     "retry on unavailable",
+			faults:   []otlptest.Fault{otlptest.Unavailable(), otlptest.Unavailable()},
+			retry:    &cflog2otel.OtelRetryConfig{InitialInterval: "10ms", MaxInterval: "10ms", MaxElapsedTime: "5s"},
+			exported: 1,
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "unavailable without retry",
+			faults: []otlptest.Fault{otlptest.Unavailable()},
+			retry:  &cflog2otel.OtelRetryConfig{Enabled: aws.Bool(false)},
+			check: func(t *testing.T, err error) {
+				require.Equal(t, codes.Unavailable, status.Code(err))
+			},
+		},
+		{
+			name:   "resource exhausted",
+			faults: []otlptest.Fault{otlptest.ResourceExhausted()},
+			check: func(t *testing.T, err error) {
+				require.ErrorContains(t, err, "resource exhausted")
+			},
+		},
+		{
+			name:     "partial success warn",
+			faults:   []otlptest.Fault{otlptest.PartialSuccess(2, "invalid data points")},
+			exported: 1,
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "partial success fail",
+			faults:   []otlptest.Fault{otlptest.PartialSuccess(2, "invalid data points")},
+			policy:   cflog2otel.PartialSuccessPolicyFail,
+			exported: 1,
+			check: func(t *testing.T, err error) {
+				var psErr *cflog2otel.PartialSuccessError
+				require.ErrorAs(t, err, &psErr)
+				require.EqualValues(t, 2, psErr.RejectedDataPoints)
+				require.Equal(t, "invalid data points", psErr.ErrorMessage)
+			},
+		},
+	}
+	bs, err := os.ReadFile("testdata/cf_log.txt")
+	require.NoError(t, err)
+	payload, err := os.ReadFile("testdata/s3_notification.json")
+	require.NoError(t, err)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := newMockControler(t)
+			defer ctrl.Finish()
+			client := newMockS3APIClient(ctrl)
+			client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+				Body: io.NopCloser(
+					bytes.NewReader(gzipData(bs)),
+				),
+				ContentLength: aws.Int64(int64(len(bs))),
+			}, nil).Once()
+			cfg := cflog2otel.DefaultConfig()
+			err := cfg.Load("testdata/request_count_by_status_category.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+			require.NoError(t, err)
+			recorder := otlptest.NewRecorder()
+			server := otlptest.NewMetricsCollector(recorder, otlptest.WithFaults(c.faults...))
+			defer server.Close()
+			cfg.Otel.OnPartialSuccess = c.policy
+			cfg.Otel.Retry = c.retry
+			require.NoError(t, cfg.Otel.Validate())
+			cfg.Otel.SetEndpointURL(server.URL)
+			app, err := cflog2otel.NewWithClient(cfg, client)
+			require.NoError(t, err)
+
+			_, err = app.Invoke(context.Background(), payload)
+			c.check(t, err)
+			require.Len(t, recorder.Requests(), c.exported)
+		})
+	}
+}
+
+func TestE2E__LogFormatAuto(t *testing.T) {
+	const objectKey = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2019/12/01/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20191201T2245Z_192.0.2.1_2soosksi.log.gz"
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	bs, err := os.ReadFile("testdata/alb_log.txt")
+	require.NoError(t, err)
+	client.On(
+		"GetObject",
+		mock.Anything,
+		mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return input.Bucket != nil && *input.Bucket == "example-bucket" && input.Key != nil && *input.Key == objectKey
+		}),
+	).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(
+			bytes.NewReader(gzipData(bs)),
+		),
+		ContentLength: aws.Int64(int64(len(bs))),
+	}, nil)
 	cfg := cflog2otel.DefaultConfig()
-	err = cfg.Load("testdata/backfil_config.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	err = cfg.Load("testdata/alb_log_format.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg.Otel.SetEndpointURL(server.URL)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	payload, err := os.ReadFile("testdata/s3_notification.json")
+	require.NoError(t, err)
+	payload = bytes.ReplaceAll(payload, []byte("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"), []byte(objectKey))
+	_, err = app.Invoke(ctx, payload)
+	require.NoError(t, err)
+	sended := recorder.Requests()
+	require.Len(t, sended, 1)
+
+	otlptest.AssertSum(t, sended, "http.server.requests", 3)
+	otlptest.AssertSum(t, sended, "http.server.requests", 1, attribute.Int64("http.response.status_code", 502))
+	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+	g.AssertJson(t, "e2e_log_format_auto", sended[0])
+}
+
+func TestE2E__DeadlineMargin(t *testing.T) {
+	t.Run("short timeout", func(t *testing.T) {
+		ctrl := newMockControler(t)
+		defer ctrl.Finish()
+		client := newMockS3APIClient(ctrl)
+		bs, err := os.ReadFile("testdata/cf_log.txt")
+		require.NoError(t, err)
+		client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+		cfg := cflog2otel.DefaultConfig()
+		err = cfg.Load("testdata/request_count_by_status_category.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+		require.NoError(t, err)
+		recorder := otlptest.NewRecorder()
+		server := otlptest.NewMetricsCollector(recorder)
+		defer server.Close()
+		cfg.Otel.SetEndpointURL(server.URL)
+		app, err := cflog2otel.NewWithClient(cfg, client)
+		require.NoError(t, err)
+
+		// the default timeout of Lambda, the margin does not consume the whole budget.
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		payload, err := os.ReadFile("testdata/s3_notification.json")
+		require.NoError(t, err)
+		_, err = app.Invoke(ctx, payload)
+		require.NoError(t, err)
+		require.Len(t, recorder.Requests(), 1)
+	})
+	t.Run("stop before deadline", func(t *testing.T) {
+		ctrl := newMockControler(t)
+		defer ctrl.Finish()
+		client := newMockS3APIClient(ctrl)
+		client.On("GetObject", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).Return(nil, context.DeadlineExceeded).Once()
+		cfg := cflog2otel.DefaultConfig()
+		err := cfg.Load("testdata/request_count_by_status_category.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+		require.NoError(t, err)
+		server := otlptest.NewMetricsCollector(otlptest.ExporterFunc(
+			func(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+				t.Error("unexpected export")
+				return &collectormetrics.ExportMetricsServiceResponse{}, nil
+			},
+		))
+		defer server.Close()
+		cfg.Otel.SetEndpointURL(server.URL)
+		app, err := cflog2otel.NewWithClient(cfg, client)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		payload, err := os.ReadFile("testdata/s3_notification.json")
+		require.NoError(t, err)
+		_, err = app.Invoke(ctx, payload)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.NoError(t, ctx.Err(), "processing stops before the deadline of the invocation")
+	})
+}
+
+func TestE2E__ConcurrentNotifications(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	bs, err := os.ReadFile("testdata/cf_log.txt")
+	require.NoError(t, err)
+	distributions := []string{"EMLARXS9EXAMPLE1", "EMLARXS9EXAMPLE2", "EMLARXS9EXAMPLE3"}
+	var records []events.S3EventRecord
+	for i, distributionID := range distributions {
+		key := fmt.Sprintf("logs/%s.2019-12-01-22.RT4KCN4SGK9.gz", distributionID)
+		call := client.On(
+			"GetObject",
+			mock.Anything,
+			mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+				return input.Key != nil && *input.Key == key
+			}),
+		).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+		// the first notification finishes last.
+		call.After(time.Duration(len(distributions)-i) * 50 * time.Millisecond)
+		records = append(records, events.S3EventRecord{
+			EventTime: time.Date(2019, 12, 1, 22, 56, 0, 0, time.UTC),
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: "example-bucket"},
+				Object: events.S3Object{Key: key, Size: 1024},
+			},
+		})
+	}
+	s3Event, err := json.Marshal(events.S3Event{Records: records})
+	require.NoError(t, err)
+	payload, err := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "1", EventSource: "aws:sqs", Body: string(s3Event)},
+	}})
+	require.NoError(t, err)
+
+	cfg := cflog2otel.DefaultConfig()
+	err = cfg.Load("testdata/request_count_by_status_category.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err)
+	cfg.Concurrency = len(distributions)
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg.Otel.SetEndpointURL(server.URL)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	_, err = app.Invoke(context.Background(), payload)
+	require.NoError(t, err)
+	sended := recorder.Requests()
+	require.Len(t, sended, len(distributions))
+	// merged in the order of the notifications, regardless of the completion order.
+	for i, req := range sended {
+		var got string
+		for _, kv := range req.GetResourceMetrics()[0].GetResource().GetAttributes() {
+			if kv.GetKey() == "aws.cloudfront.distribution_id" {
+				got = kv.GetValue().GetStringValue()
+			}
+		}
+		require.Equal(t, distributions[i], got)
+	}
+}
+
+func TestE2E__ParseSkipAndCount(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	bs, err := os.ReadFile("testdata/cf_log_malformed.txt")
+	require.NoError(t, err)
+	client.On(
+		"GetObject",
+		mock.Anything,
+		mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return input.Bucket != nil && *input.Bucket == "example-bucket" && input.Key != nil && *input.Key == "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"
+		}),
+	).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(
+			bytes.NewReader(gzipData(bs)),
+		),
+		ContentLength: aws.Int64(int64(len(bs))),
+	}, nil)
+	cfg := cflog2otel.DefaultConfig()
+	err = cfg.Load("testdata/parse_skip_and_count.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
 	require.NoError(t, err)
 	ctx := context.Background()
 	var sended []*collectormetrics.ExportMetricsServiceRequest
@@ -143,10 +621,71 @@ func TestE2E__Backfill(t *testing.T) {
 	require.NoError(t, err)
 	_, err = app.Invoke(ctx, payload)
 	require.NoError(t, err)
-	require.Len(t, sended, 1)
+	require.Len(t, sended, 2)
 
 	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
-	g.AssertJson(t, "e2e_backfill", sended[0])
+	g.AssertJson(t, "e2e_parse_skip_and_count", sended)
+}
+
+func TestE2E__ParseSkipAndCount__Backfill(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	objects := map[string]string{
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz": "testdata/cf_log.txt",
+		// the malformed lines of the sibling are counted by the notification of the sibling.
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz": "testdata/cf_log_malformed.txt",
+	}
+	var contents []types.Object
+	for key, path := range objects {
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		client.On(
+			"GetObject",
+			mock.Anything,
+			mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+				return input.Key != nil && *input.Key == key
+			}),
+		).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+		contents = append(contents, types.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(time.Date(2019, 12, 01, 22, 52, 0, 0, time.UTC)),
+		})
+	}
+	slices.SortFunc(contents, func(a, b types.Object) int { return strings.Compare(*a.Key, *b.Key) })
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22."),
+	}).Return(&s3.ListObjectsV2Output{Contents: contents}, nil).Once()
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-23."),
+	}).Return(&s3.ListObjectsV2Output{}, nil).Once()
+	cfg := cflog2otel.DefaultConfig()
+	err := cfg.Load("testdata/parse_skip_and_count_backfill.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err)
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg.Otel.SetEndpointURL(server.URL)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	payload, err := os.ReadFile("testdata/s3_notification.json")
+	require.NoError(t, err)
+	_, err = app.Invoke(context.Background(), payload)
+	require.NoError(t, err)
+	sended := recorder.Requests()
+
+	bs, err := os.ReadFile("testdata/cf_log.txt")
+	require.NoError(t, err)
+	logs, err := cflog2otel.ParseCloudFrontLog(context.Background(), bytes.NewReader(bs))
+	require.NoError(t, err)
+	otlptest.AssertSum(t, sended, cflog2otel.SelfMetricsParseLines, float64(len(logs)))
+	require.Empty(t, recorder.Metrics(cflog2otel.SelfMetricsParseSkippedLines))
 }
 
 func TestUnwrapEvent_S3Notification(t *testing.T) {
@@ -0,0 +1,114 @@
+package cflog2otel
+
+import (
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// backfillIntervals is the start times of the aggregation intervals touched by the triggering object, keyed by metric name.
+type backfillIntervals map[string]map[int64]struct{}
+
+func newBackfillIntervals(metrics []MetricsConfig, logs []CELVariablesLog) backfillIntervals {
+	intervals := make(backfillIntervals, len(metrics))
+	for _, m := range metrics {
+		starts, ok := intervals[m.Name]
+		if !ok {
+			starts = make(map[int64]struct{})
+			intervals[m.Name] = starts
+		}
+		for _, l := range logs {
+			startTime, _ := getStartTimeAndTime(m, l.Timestamp)
+			starts[startTime.UnixNano()] = struct{}{}
+		}
+	}
+	return intervals
+}
+
+// hours returns the hours of the intervals and the following hours in the format of the object key, e.g. `2019-12-01-22`, in order.
+// the intervals divide 1h, so each interval is in a single hour, and the late lines of it are delivered in the following hour.
+func (bi backfillIntervals) hours() []string {
+	var hours []string
+	for _, starts := range bi {
+		for start := range starts {
+			hour := time.Unix(0, start).UTC().Truncate(time.Hour)
+			for _, h := range []time.Time{hour, hour.Add(time.Hour)} {
+				if key := h.Format(replayHourLayout); !slices.Contains(hours, key) {
+					hours = append(hours, key)
+				}
+			}
+		}
+	}
+	slices.Sort(hours)
+	return hours
+}
+
+// contains reports whether the timestamp is in any interval touched by the triggering object.
+func (bi backfillIntervals) contains(metrics []MetricsConfig, t time.Time) bool {
+	for _, m := range metrics {
+		startTime, _ := getStartTimeAndTime(m, t)
+		if _, ok := bi[m.Name][startTime.UnixNano()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter removes the data points of the intervals not touched by the triggering object.
+// the metrics not in the config, e.g. self metrics, are kept as is.
+func (bi backfillIntervals) filter(resourceMetrics []*metricdata.ResourceMetrics) []*metricdata.ResourceMetrics {
+	resp := make([]*metricdata.ResourceMetrics, 0, len(resourceMetrics))
+	for _, r := range resourceMetrics {
+		scopeMetrics := make([]metricdata.ScopeMetrics, 0, len(r.ScopeMetrics))
+		for _, sm := range r.ScopeMetrics {
+			metrics := make([]metricdata.Metrics, 0, len(sm.Metrics))
+			for _, m := range sm.Metrics {
+				if starts, ok := bi[m.Name]; ok {
+					m.Data = filterDataPoints(m.Data, starts)
+					if LenDataPoints(m.Data) == 0 {
+						continue
+					}
+				}
+				metrics = append(metrics, m)
+			}
+			if len(metrics) == 0 {
+				continue
+			}
+			sm.Metrics = metrics
+			scopeMetrics = append(scopeMetrics, sm)
+		}
+		if len(scopeMetrics) == 0 {
+			continue
+		}
+		r.ScopeMetrics = scopeMetrics
+		resp = append(resp, r)
+	}
+	return resp
+}
+
+func filterDataPoints(data metricdata.Aggregation, starts map[int64]struct{}) metricdata.Aggregation {
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		data.DataPoints = filterByStartTime(data.DataPoints, starts, func(dp metricdata.DataPoint[int64]) time.Time { return dp.StartTime })
+		return data
+	case metricdata.Sum[float64]:
+		data.DataPoints = filterByStartTime(data.DataPoints, starts, func(dp metricdata.DataPoint[float64]) time.Time { return dp.StartTime })
+		return data
+	case metricdata.Histogram[float64]:
+		data.DataPoints = filterByStartTime(data.DataPoints, starts, func(dp metricdata.HistogramDataPoint[float64]) time.Time { return dp.StartTime })
+		return data
+	default:
+		return data
+	}
+}
+
+func filterByStartTime[DP any](dps []DP, starts map[int64]struct{}, startTime func(DP) time.Time) []DP {
+	filtered := make([]DP, 0, len(dps))
+	for _, dp := range dps {
+		if _, ok := starts[startTime(dp).UnixNano()]; ok {
+			filtered = append(filtered, dp)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,13 @@
+package cflog2otel
+
+// BackfillMode is how the backfill selects the logs of the sibling objects.
+type BackfillMode int
+
+//go:generate enumer -type=BackfillMode -trimprefix=BackfillMode -transform=snake -json -text
+const (
+	// BackfillModeTimeTolerance reads the objects and the lines within time_tolerance from the event time.
+	BackfillModeTimeTolerance BackfillMode = iota
+	// BackfillModeInterval recomputes the aggregation intervals which the triggering object touches,
+	// with all lines of the intervals in the objects of the hour.
+	BackfillModeInterval
+)
@@ -0,0 +1,111 @@
+// Code generated by "enumer -type=BackfillMode -trimprefix=BackfillMode -transform=snake -json -text"; DO NOT EDIT.
+
+package cflog2otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const _BackfillModeName = "time_toleranceinterval"
+
+var _BackfillModeIndex = [...]uint8{0, 14, 22}
+
+const _BackfillModeLowerName = "time_toleranceinterval"
+
+func (i BackfillMode) String() string {
+	if i < 0 || i >= BackfillMode(len(_BackfillModeIndex)-1) {
+		return fmt.Sprintf("BackfillMode(%d)", i)
+	}
+	return _BackfillModeName[_BackfillModeIndex[i]:_BackfillModeIndex[i+1]]
+}
+
+// An "invalid array index" compiler error signifies that the constant values have changed.
+// Re-run the stringer command to generate them again.
+func _BackfillModeNoOp() {
+	var x [1]struct{}
+	_ = x[BackfillModeTimeTolerance-(0)]
+	_ = x[BackfillModeInterval-(1)]
+}
+
+var _BackfillModeValues = []BackfillMode{BackfillModeTimeTolerance, BackfillModeInterval}
+
+var _BackfillModeNameToValueMap = map[string]BackfillMode{
+	_BackfillModeName[0:14]:  BackfillModeTimeTolerance,
+	_BackfillModeName[14:22]: BackfillModeInterval,
+}
+
+var _BackfillModeLowerNameToValueMap = map[string]BackfillMode{
+	_BackfillModeLowerName[0:14]:  BackfillModeTimeTolerance,
+	_BackfillModeLowerName[14:22]: BackfillModeInterval,
+}
+
+var _BackfillModeNames = []string{
+	_BackfillModeName[0:14],
+	_BackfillModeName[14:22],
+}
+
+// BackfillModeString retrieves an enum value from the enum constants string name.
+// Throws an error if the param is not part of the enum.
+func BackfillModeString(s string) (BackfillMode, error) {
+	if val, ok := _BackfillModeNameToValueMap[s]; ok {
+		return val, nil
+	}
+
+	if val, ok := _BackfillModeLowerNameToValueMap[strings.ToLower(s)]; ok {
+		return val, nil
+	}
+	return 0, fmt.Errorf("%s does not belong to BackfillMode values", s)
+}
+
+// BackfillModeValues returns all values of the enum
+func BackfillModeValues() []BackfillMode {
+	return _BackfillModeValues
+}
+
+// BackfillModeStrings returns a slice of all String values of the enum
+func BackfillModeStrings() []string {
+	strs := make([]string, len(_BackfillModeNames))
+	copy(strs, _BackfillModeNames)
+	return strs
+}
+
+// IsABackfillMode returns "true" if the value is listed in the enum definition. "false" otherwise
+func (i BackfillMode) IsABackfillMode() bool {
+	for _, v := range _BackfillModeValues {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface for BackfillMode
+func (i BackfillMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for BackfillMode
+func (i *BackfillMode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("BackfillMode should be a string, got %s", data)
+	}
+
+	var err error
+	*i, err = BackfillModeString(s)
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for BackfillMode
+func (i BackfillMode) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for BackfillMode
+func (i *BackfillMode) UnmarshalText(text []byte) error {
+	var err error
+	*i, err = BackfillModeString(string(text))
+	return err
+}
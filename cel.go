@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/ext"
 	"github.com/samber/oops"
@@ -17,20 +23,34 @@ import (
 var defaultCELEnv *cel.Env
 
 type CELVariables struct {
-	Bucket     CELVariablesS3Bucket   `json:"bucket" cel:"bucket"`
-	Object     CELVariablesS3Object   `json:"object" cel:"object"`
-	CloudFront CELVariablesCloudFront `json:"cloudfront" cel:"cloudfront"`
-	Log        CELVariablesLog        `json:"log" cel:"log"`
+	Bucket      CELVariablesS3Bucket   `json:"bucket" cel:"bucket"`
+	Object      CELVariablesS3Object   `json:"object" cel:"object"`
+	CloudFront  CELVariablesCloudFront `json:"cloudfront" cel:"cloudfront"`
+	Log         CELVariablesLog        `json:"log" cel:"log"`
+	GeoIP       *CELGeoIP              `json:"-" cel:"-"`
+	UserAgent   *CELUserAgent          `json:"-" cel:"-"`
+	Router      *Router                `json:"-" cel:"-"`
+	LogRefs     CELLogReferences       `json:"-" cel:"-"`
+	Definitions *CELDefinitions        `json:"-" cel:"-"`
+	CELEnv      *CELEnv                `json:"-" cel:"-"`
+	defsCache   map[string]ref.Val
 }
 
 type CELVariablesS3Bucket struct {
 	Name          string                     `json:"name" cel:"name"`
 	OwnerIdentity CELVariablesS3UserIdentity `json:"ownerIdentity" cel:"ownerIdentity"`
 	Arn           string                     `json:"arn" cel:"arn"`
+	// Tags is fetched by GetBucketTagging only when referenced by the configuration.
+	Tags map[string]string `json:"tags,omitempty" cel:"tags"`
 }
 
 type CELVariablesCloudFront struct {
 	DistributionID string `json:"distributionId" cel:"distributionId"`
+	// metadata of the distribution, resolved only when `enrichment.cloudfront` is configured.
+	Aliases    []string          `json:"aliases,omitempty" cel:"aliases"`
+	Comment    string            `json:"comment,omitempty" cel:"comment"`
+	Tags       map[string]string `json:"tags,omitempty" cel:"tags"`
+	PriceClass string            `json:"priceClass,omitempty" cel:"priceClass"`
 }
 
 type CELVariablesS3UserIdentity struct {
@@ -43,6 +63,9 @@ type CELVariablesS3Object struct {
 	ETag      string `json:"eTag" cel:"eTag"`
 	VersionID string `json:"versionId" cel:"versionId"`
 	Sequencer string `json:"sequencer" cel:"sequencer"`
+	// Tags and Metadata are fetched by GetObjectTagging and HeadObject only when referenced by the configuration.
+	Tags     map[string]string `json:"tags,omitempty" cel:"tags"`
+	Metadata map[string]string `json:"metadata,omitempty" cel:"metadata"`
 }
 
 func NewCELVariables(record events.S3EventRecord, distributionID string) *CELVariables {
@@ -69,12 +92,49 @@ func NewCELVariables(record events.S3EventRecord, distributionID string) *CELVar
 
 func (v *CELVariables) SetLogLine(log CELVariablesLog) {
 	v.Log = log
+	v.defsCache = nil
+	if v.Router != nil && log.CsURIStem != nil {
+		v.Log.Route, _ = v.Router.Match(*log.CsURIStem)
+	}
+	if v.LogRefs.Query && log.CsURIQuery != nil {
+		v.Log.Query = ParseQueryString(*log.CsURIQuery)
+	}
+	if v.LogRefs.Cookies && log.CsCookie != nil {
+		v.Log.Cookies = ParseCookies(*log.CsCookie)
+	}
 }
 
 func (v *CELVariables) MarshalMap() map[string]interface{} {
+	return v.marshalMap(context.Background())
+}
+
+// marshalMap returns the variables for the evaluation, `defs` is evaluated with ctx.
+func (v *CELVariables) marshalMap(ctx context.Context) map[string]interface{} {
 	if v == nil {
 		return map[string]interface{}{}
 	}
+	m := v.marshalNativeTypesMap()
+	if v.GeoIP != nil {
+		m["geo"] = v.GeoIP
+	} else {
+		m["geo"] = &CELGeoIP{}
+	}
+	if v.UserAgent != nil {
+		m["ua"] = v.UserAgent
+	} else {
+		m["ua"] = &CELUserAgent{}
+	}
+	if v.Router != nil {
+		m["route"] = v.Router
+	} else {
+		m["route"] = &Router{}
+	}
+	m["defs"] = celDefinitionsValue{ctx: ctx, vars: v}
+	v.CELEnv.setVariables(m, v)
+	return m
+}
+
+func (v *CELVariables) marshalNativeTypesMap() map[string]interface{} {
 	return map[string]interface{}{
 		"bucket":     v.Bucket,
 		"object":     v.Object,
@@ -86,8 +146,10 @@ func (v *CELVariables) MarshalMap() map[string]interface{} {
 func init() {
 	var err error
 	var variables CELVariables
-	m := variables.MarshalMap()
+	m := variables.marshalNativeTypesMap()
 	opts := make([]cel.EnvOption, 0, len(m)*2)
+	// OptionalTypes must be declared before NativeTypes, which replaces the type provider.
+	opts = append(opts, cel.OptionalTypes())
 	for k, v := range m {
 		rt := reflect.TypeOf(v)
 		var pkgPath string
@@ -102,6 +164,7 @@ func init() {
 			ext.NativeTypes(rt, ext.ParseStructTags(true)),
 		)
 	}
+	opts = append(opts, cel.Variable("defs", celDefinitionsType), NetworkCELLib(), GeoIPCELLib(), UserAgentCELLib(), RouteCELLib())
 	defaultCELEnv, err = cel.NewEnv(opts...)
 	if err != nil {
 		panic(oops.Wrapf(err, "failed to create CEL environment"))
@@ -121,6 +184,12 @@ type celCapableFieldSwitch[T any] struct {
 	DefaultExpr string `json:"default_expr,omitempty"`
 }
 
+// celCapableFieldErrorPolicy is the policy for evaluation errors, e.g. `cel('...') + { on_error: 'use_default', default: 0 }`.
+type celCapableFieldErrorPolicy[T any] struct {
+	OnError CELErrorPolicy `json:"on_error,omitempty"`
+	Default *T             `json:"default,omitempty"`
+}
+
 type CELCapable[T any] struct {
 	raw                  json.RawMessage
 	value                T
@@ -128,8 +197,28 @@ type CELCapable[T any] struct {
 	switchCases          []cel.Program
 	switchCaseValues     []T
 	switchCaseValueProgs []cel.Program
+	switchCaseExprs      []string
 	switchDefault        T
 	switchDefaultProg    cel.Program
+	switchDefaultExpr    string
+	onError              CELErrorPolicy
+	errorDefault         *T
+	evalTimeout          time.Duration
+	field                *celCapableField[T]
+	env                  *cel.Env
+	// bindErr is the check error deferred until the expression is bound to the environment declaring the references.
+	bindErr error
+	sources []celSource
+	refs    CELLogReferences
+	s3Refs  CELS3References
+	geoRefs bool
+	defRefs []string
+}
+
+type celSource struct {
+	expr   string
+	isCase bool
+	ast    *cel.Ast
 }
 
 func (expr *CELCapable[T]) MarshalJSON() ([]byte, error) {
@@ -153,22 +242,57 @@ func (expr *CELCapable[T]) UnmarshalJSON(data []byte) error {
 	if field.Expr == "" && field.Switch == nil {
 		return fallback()
 	}
+	var policy celCapableFieldErrorPolicy[T]
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return oops.Wrapf(err, "on_error")
+	}
+	expr.onError = policy.OnError
+	expr.errorDefault = policy.Default
+	expr.field = &field
+	if err := expr.build(defaultCELEnv, defaultCELProgramConfig); err != nil {
+		if !isCELUndeclaredReference(err) {
+			return err
+		}
+		expr.bindErr = err
+		return nil
+	}
+	for _, src := range expr.sources {
+		warnNullableLogFields(src.expr, src.ast)
+	}
+	return nil
+}
 
+// build compiles the expressions of the field with the environment and creates programs with the config.
+func (expr *CELCapable[T]) build(env *cel.Env, pc celProgramConfig) error {
+	field := expr.field
+	expr.prog = nil
+	expr.switchCases = nil
+	expr.switchCaseValues = nil
+	expr.switchCaseValueProgs = nil
+	expr.switchCaseExprs = nil
+	expr.switchDefaultProg = nil
+	expr.switchDefaultExpr = ""
+	expr.sources = nil
+	expr.refs = CELLogReferences{}
+	expr.s3Refs = CELS3References{}
+	expr.geoRefs = false
+	expr.defRefs = nil
+	expr.evalTimeout = pc.evalTimeout
+	expr.env = env
+	expr.bindErr = nil
 	if field.Expr != "" {
-		prog, out, err := compileAndEval(field.Expr)
+		prog, err := expr.compile(env, pc, field.Expr, false)
 		if err != nil {
-			return oops.Wrapf(err, "cel(%s)", field.Expr)
+			return err
 		}
 		expr.prog = prog
-		if _, ok := out.Value().(T); !ok {
-			return oops.Errorf("failed to convert CEL expression value to %T", expr.value)
-		}
 		return nil
 	}
 	var defaultCount int
 	expr.switchCases = make([]cel.Program, 0, len(field.Switch))
 	expr.switchCaseValues = make([]T, 0, len(field.Switch))
 	expr.switchCaseValueProgs = make([]cel.Program, 0, len(field.Switch))
+	expr.switchCaseExprs = make([]string, 0, len(field.Switch))
 	for i, s := range field.Switch {
 		if s.Case == "" {
 			if s.DefaultExpr == "" {
@@ -176,39 +300,30 @@ func (expr *CELCapable[T]) UnmarshalJSON(data []byte) error {
 				defaultCount++
 				continue
 			}
-			prog, out, err := compileAndEval(s.DefaultExpr)
+			prog, err := expr.compile(env, pc, s.DefaultExpr, false)
 			if err != nil {
-				return oops.Wrapf(err, "cel(%q) for default", s.DefaultExpr)
+				return oops.Wrapf(err, "switch default")
 			}
 			expr.switchDefaultProg = prog
-
-			if _, ok := out.Value().(T); !ok {
-				return oops.Errorf("failed to convert CEL expression value to %T", expr.value)
-			}
+			expr.switchDefaultExpr = s.DefaultExpr
 			defaultCount++
 			continue
 		}
-		caseProg, caseOut, err := compileAndEval(s.Case)
+		caseProg, err := expr.compile(env, pc, s.Case, true)
 		if err != nil {
-			return oops.Wrapf(err, "cel(%q) for case", s.Case)
-		}
-		if caseOut.Type() != cel.BoolType {
-			return oops.Errorf("switch case[%d] must return boolean type", i)
+			return oops.Wrapf(err, "switch case[%d]", i)
 		}
 		var valueProg cel.Program
 		if s.ValueExpr != "" {
-			var valueOut ref.Val
-			valueProg, valueOut, err = compileAndEval(s.ValueExpr)
+			valueProg, err = expr.compile(env, pc, s.ValueExpr, false)
 			if err != nil {
-				return oops.Wrapf(err, "cel(%q) for value", s.ValueExpr)
-			}
-			if _, ok := valueOut.Value().(T); !ok {
-				return oops.Errorf("failed to convert CEL expression value to %T", expr.value)
+				return oops.Wrapf(err, "switch case[%d] value", i)
 			}
 		}
 		expr.switchCases = append(expr.switchCases, caseProg)
 		expr.switchCaseValues = append(expr.switchCaseValues, s.Value)
 		expr.switchCaseValueProgs = append(expr.switchCaseValueProgs, valueProg)
+		expr.switchCaseExprs = append(expr.switchCaseExprs, s.Case)
 	}
 	if defaultCount > 1 {
 		return oops.Errorf("multiple default values in switch")
@@ -219,29 +334,305 @@ func (expr *CELCapable[T]) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func compileAndEval(expr string) (cel.Program, ref.Val, error) {
-	ast, iss := defaultCELEnv.Compile(expr)
-	if iss.Err() != nil {
-		return nil, nil, oops.Wrapf(iss.Err(), "failed to compile CEL expression")
+// clone returns a copy of the expression, which can be bound to another environment.
+func (expr *CELCapable[T]) clone() *CELCapable[T] {
+	if expr == nil {
+		return nil
 	}
-	prog, err := defaultCELEnv.Program(ast)
+	cloned := *expr
+	return &cloned
+}
+
+// bind compiles the expressions again with the environment and creates programs with the config.
+// literal values are not changed.
+func (expr *CELCapable[T]) bind(env *cel.Env, pc celProgramConfig) error {
+	if expr == nil || expr.field == nil {
+		return nil
+	}
+	if err := expr.build(env, pc); err != nil {
+		expr.bindErr = err
+		return err
+	}
+	return nil
+}
+
+// compile compiles the expression, checks the output type and records its references.
+// switch cases must return bool, others must return T.
+func (expr *CELCapable[T]) compile(env *cel.Env, pc celProgramConfig, src string, isCase bool) (cel.Program, error) {
+	ast, err := compileCEL(env, src)
 	if err != nil {
-		return nil, nil, oops.Wrapf(err, "failed to create CEL program")
+		return nil, err
+	}
+	want := celExpectedTypes[T]()
+	if isCase {
+		want = []*cel.Type{cel.BoolType}
 	}
-	dummyVariables := &CELVariables{}
-	out, _, err := prog.Eval(dummyVariables.MarshalMap())
+	if err := checkCELOutputType(src, ast, want); err != nil {
+		return nil, err
+	}
+	prog, err := env.Program(ast, pc.programOptions()...)
 	if err != nil {
-		return nil, nil, oops.Wrapf(err, "failed to evaluate CEL expression")
+		return nil, &CELExpressionError{Expr: src, Err: oops.Wrapf(err, "failed to create CEL program")}
+	}
+	expr.sources = append(expr.sources, celSource{expr: src, isCase: isCase, ast: ast})
+	expr.refs = expr.refs.Merge(collectLogReferences(ast))
+	expr.s3Refs = expr.s3Refs.Merge(collectS3References(ast))
+	expr.geoRefs = expr.geoRefs || hasGeoIPReference(ast)
+	for _, name := range collectDefinitionReferences(ast) {
+		if !slices.Contains(expr.defRefs, name) {
+			expr.defRefs = append(expr.defRefs, name)
+		}
+	}
+	return prog, nil
+}
+
+// EstimateCost returns the estimated cost of the expressions. for switch, the costs of all branches are summed up.
+func (expr *CELCapable[T]) EstimateCost() (CELCostEstimate, error) {
+	var total CELCostEstimate
+	if expr == nil {
+		return total, nil
+	}
+	for _, src := range expr.sources {
+		est, err := estimateCELCost(expr.env, src.ast)
+		if err != nil {
+			return total, &CELExpressionError{Expr: src.expr, Err: err}
+		}
+		total = total.Add(est)
+	}
+	return total, nil
+}
+
+// CheckType compiles the expressions again with the environment and checks the output types.
+// if want is empty, the output types are checked against T.
+// this is used for checks which need the whole config, such as types of definitions.
+func (expr *CELCapable[T]) CheckType(env *cel.Env, want ...*cel.Type) error {
+	if expr == nil {
+		return nil
+	}
+	if len(want) == 0 {
+		want = celExpectedTypes[T]()
+	}
+	for _, src := range expr.sources {
+		ast, err := compileCEL(env, src.expr)
+		if err != nil {
+			return err
+		}
+		w := want
+		if src.isCase {
+			w = []*cel.Type{cel.BoolType}
+		}
+		if err := checkCELOutputType(src.expr, ast, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindError returns the error if the expression is not compiled with the environment.
+func (expr *CELCapable[T]) bindError() error {
+	if expr == nil {
+		return nil
+	}
+	return expr.bindErr
+}
+
+// DefinitionReferences returns definition names referenced by the compiled expressions.
+func (expr *CELCapable[T]) DefinitionReferences() []string {
+	if expr == nil {
+		return nil
+	}
+	return expr.defRefs
+}
+
+// LogReferences returns derived log fields referenced by the compiled expressions.
+func (expr *CELCapable[T]) LogReferences() CELLogReferences {
+	if expr == nil {
+		return CELLogReferences{}
+	}
+	return expr.refs
+}
+
+// S3References returns S3 tags and metadata referenced by the compiled expressions.
+func (expr *CELCapable[T]) S3References() CELS3References {
+	if expr == nil {
+		return CELS3References{}
+	}
+	return expr.s3Refs
+}
+
+// GeoIPReferenced reports whether the compiled expressions refer to `geo` variable.
+func (expr *CELCapable[T]) GeoIPReferenced() bool {
+	if expr == nil {
+		return false
+	}
+	return expr.geoRefs
+}
+
+// CELLogReferences reports which derived log fields are referenced by compiled expressions.
+// derived fields are expensive to build, so they are populated only when referenced.
+type CELLogReferences struct {
+	Query   bool
+	Cookies bool
+	// Fields are the CEL names of all referenced log fields, sorted.
+	Fields []string
+}
+
+func (r CELLogReferences) Merge(other CELLogReferences) CELLogReferences {
+	fields := append(slices.Clone(r.Fields), other.Fields...)
+	slices.Sort(fields)
+	return CELLogReferences{
+		Query:   r.Query || other.Query,
+		Cookies: r.Cookies || other.Cookies,
+		Fields:  slices.Compact(fields),
 	}
-	return prog, out, nil
 }
 
+// celFieldAccess returns the identifier operand and the field name of `ident.field`, `ident.?field`,
+// and the index access with string literal `ident["field"]` or `ident[?"field"]`. `dyn(ident)` is also accepted as the operand.
+func celFieldAccess(e celast.Expr) (celast.Expr, string, bool) {
+	switch e.Kind() {
+	case celast.SelectKind:
+		sel := e.AsSelect()
+		operand, ok := celIdentOperand(sel.Operand())
+		if !ok {
+			return nil, "", false
+		}
+		return operand, sel.FieldName(), true
+	case celast.CallKind:
+		call := e.AsCall()
+		switch call.FunctionName() {
+		case operators.OptSelect, operators.Index, operators.OptIndex:
+		default:
+			return nil, "", false
+		}
+		if len(call.Args()) != 2 {
+			return nil, "", false
+		}
+		operand, ok := celIdentOperand(call.Args()[0])
+		if !ok {
+			return nil, "", false
+		}
+		field := call.Args()[1]
+		if field.Kind() != celast.LiteralKind {
+			return nil, "", false
+		}
+		name, ok := field.AsLiteral().(types.String)
+		if !ok {
+			return nil, "", false
+		}
+		return operand, string(name), true
+	}
+	return nil, "", false
+}
+
+// celIdentOperand returns the identifier of `ident` or `dyn(ident)`.
+func celIdentOperand(e celast.Expr) (celast.Expr, bool) {
+	if e.Kind() == celast.CallKind {
+		call := e.AsCall()
+		if call.FunctionName() != "dyn" || call.IsMemberFunction() || len(call.Args()) != 1 {
+			return nil, false
+		}
+		e = call.Args()[0]
+	}
+	return e, e.Kind() == celast.IdentKind
+}
+
+// celFieldReferences returns the fields of the identifier accessed by celFieldAccess, sorted.
+// whole reports whether the identifier is used otherwise, e.g. `dyn(log)[key]`, so the accessed fields are unknown.
+func celFieldReferences(a *cel.Ast, ident string) (fields []string, whole bool) {
+	accessed := make(map[int64]bool)
+	var idents []int64
+	celast.PreOrderVisit(a.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() == celast.IdentKind && e.AsIdent() == ident {
+			idents = append(idents, e.ID())
+			return
+		}
+		operand, field, ok := celFieldAccess(e)
+		if !ok || operand.AsIdent() != ident {
+			return
+		}
+		accessed[operand.ID()] = true
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}))
+	for _, id := range idents {
+		if !accessed[id] {
+			whole = true
+		}
+	}
+	slices.Sort(fields)
+	return fields, whole
+}
+
+func collectLogReferences(a *cel.Ast) CELLogReferences {
+	fields, whole := celFieldReferences(a, "log")
+	return CELLogReferences{
+		Query:   whole || slices.Contains(fields, "query"),
+		Cookies: whole || slices.Contains(fields, "cookies"),
+		Fields:  fields,
+	}
+}
+
+func collectS3References(a *cel.Ast) CELS3References {
+	objectFields, objectWhole := celFieldReferences(a, "object")
+	bucketFields, bucketWhole := celFieldReferences(a, "bucket")
+	return CELS3References{
+		ObjectTags:     objectWhole || slices.Contains(objectFields, "tags"),
+		ObjectMetadata: objectWhole || slices.Contains(objectFields, "metadata"),
+		BucketTags:     bucketWhole || slices.Contains(bucketFields, "tags"),
+	}
+}
+
+func hasGeoIPReference(a *cel.Ast) bool {
+	var found bool
+	celast.PreOrderVisit(a.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() == celast.IdentKind && e.AsIdent() == "geo" {
+			found = true
+		}
+	}))
+	return found
+}
+
+// Eval evaluates the expression. if the evaluation failed, the error is handled by `on_error` policy:
+// `fail` returns the error, `skip_line` returns the error wrapping ErrSkipLine,
+// `use_default` returns `default` value (or switch default value, zero value) without error.
 func (expr *CELCapable[T]) Eval(ctx context.Context, vars *CELVariables) (T, error) {
+	value, err := expr.eval(ctx, vars)
+	if err == nil {
+		return value, nil
+	}
+	switch expr.onError {
+	case CELErrorPolicySkipLine:
+		return value, fmt.Errorf("%w: %w", ErrSkipLine, err)
+	case CELErrorPolicyUseDefault:
+		slog.DebugContext(ctx, "use default value for CEL evaluation error", "error", err)
+		recordCELBranch(ctx, "on_error", "")
+		if expr.errorDefault != nil {
+			return *expr.errorDefault, nil
+		}
+		return expr.switchDefault, nil
+	}
+	return value, err
+}
+
+func (expr *CELCapable[T]) eval(ctx context.Context, vars *CELVariables) (T, error) {
+	if expr.bindErr != nil {
+		var zero T
+		return zero, expr.bindErr
+	}
 	if expr.prog == nil && len(expr.switchCases) == 0 {
+		recordCELBranch(ctx, "literal", "")
 		return expr.value, nil
 	}
-	variables := vars.MarshalMap()
+	if expr.evalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, expr.evalTimeout)
+		defer cancel()
+	}
+	variables := vars.marshalMap(ctx)
 	if expr.prog != nil {
+		recordCELBranch(ctx, "expr", expr.field.Expr)
 		out, _, err := expr.prog.ContextEval(ctx, variables)
 		if err != nil {
 			var zero T
@@ -263,6 +654,7 @@ func (expr *CELCapable[T]) Eval(ctx context.Context, vars *CELVariables) (T, err
 			return expr.switchDefault, oops.Errorf("switch case[%d] must return boolean type", i)
 		}
 		if out.Value().(bool) {
+			recordCELSwitchCase(ctx, i, expr.switchCaseExprs[i])
 			if expr.switchCaseValueProgs[i] != nil {
 				valueOut, _, err := expr.switchCaseValueProgs[i].ContextEval(ctx, variables)
 				if err != nil {
@@ -277,6 +669,7 @@ func (expr *CELCapable[T]) Eval(ctx context.Context, vars *CELVariables) (T, err
 			return expr.switchCaseValues[i], nil
 		}
 	}
+	recordCELBranch(ctx, "default", expr.switchDefaultExpr)
 	if expr.switchDefaultProg != nil {
 		out, _, err := expr.switchDefaultProg.ContextEval(ctx, variables)
 		if err != nil {
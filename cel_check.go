@@ -0,0 +1,185 @@
+package cflog2otel
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/samber/oops"
+)
+
+// CELExpressionError is returned when a CEL expression can not be compiled or returns an unexpected type.
+type CELExpressionError struct {
+	Expr string
+	Err  error
+	// undeclared reports whether the expression is parsed, but references functions or variables not declared in the environment.
+	undeclared bool
+}
+
+func (e *CELExpressionError) Error() string {
+	return fmt.Sprintf("cel(%q): %v", e.Expr, e.Err)
+}
+
+func (e *CELExpressionError) Unwrap() error {
+	return e.Err
+}
+
+func compileCEL(env *cel.Env, src string) (*cel.Ast, error) {
+	parsed, iss := env.Parse(src)
+	if iss.Err() != nil {
+		return nil, &CELExpressionError{Expr: src, Err: oops.Wrapf(iss.Err(), "failed to compile CEL expression")}
+	}
+	ast, iss := env.Check(parsed)
+	if iss.Err() != nil {
+		return nil, &CELExpressionError{Expr: src, Err: oops.Wrapf(iss.Err(), "failed to compile CEL expression"), undeclared: hasUndeclaredReferences(env, parsed)}
+	}
+	return ast, nil
+}
+
+// isCELUndeclaredReference reports whether the expression references functions or variables not declared in the environment,
+// which may be declared by the environment bound later.
+func isCELUndeclaredReference(err error) bool {
+	var celErr *CELExpressionError
+	return errors.As(err, &celErr) && celErr.undeclared
+}
+
+// hasUndeclaredReferences reports whether the parsed expression references functions or variables not declared in the environment.
+// the namespaces of functions, e.g. `geo` of `geo.country()`, and the variables of comprehensions are declared.
+func hasUndeclaredReferences(env *cel.Env, parsed *cel.Ast) bool {
+	declared := make(map[string]bool)
+	for _, v := range env.Variables() {
+		root, _, _ := strings.Cut(v.Name(), ".")
+		declared[root] = true
+	}
+	for name := range env.Functions() {
+		if root, _, ok := strings.Cut(name, "."); ok {
+			declared[root] = true
+		}
+	}
+	expr := parsed.NativeRep().Expr()
+	celast.PreOrderVisit(expr, celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() == celast.ComprehensionKind {
+			c := e.AsComprehension()
+			declared[c.IterVar()] = true
+			declared[c.IterVar2()] = true
+			declared[c.AccuVar()] = true
+		}
+	}))
+	undeclared := false
+	celast.PreOrderVisit(expr, celast.NewExprVisitor(func(e celast.Expr) {
+		switch e.Kind() {
+		case celast.IdentKind:
+			root, _, _ := strings.Cut(e.AsIdent(), ".")
+			if !declared[root] {
+				undeclared = true
+			}
+		case celast.CallKind:
+			call := e.AsCall()
+			if env.HasFunction(call.FunctionName()) {
+				return
+			}
+			if call.IsMemberFunction() && call.Target().Kind() == celast.IdentKind && env.HasFunction(call.Target().AsIdent()+"."+call.FunctionName()) {
+				return
+			}
+			undeclared = true
+		}
+	}))
+	return undeclared
+}
+
+// celScalarTypes are the output types allowed for attribute values.
+var celScalarTypes = []*cel.Type{cel.StringType, cel.IntType, cel.DoubleType, cel.BoolType, cel.NullType}
+
+// celExpectedTypes returns the CEL types which can be converted to T. nil means any type.
+func celExpectedTypes[T any]() []*cel.Type {
+	var zero T
+	switch any(zero).(type) {
+	case bool:
+		return []*cel.Type{cel.BoolType}
+	case float64:
+		return []*cel.Type{cel.DoubleType}
+	case int64:
+		return []*cel.Type{cel.IntType}
+	case string:
+		return []*cel.Type{cel.StringType}
+	}
+	return nil
+}
+
+// checkCELOutputType checks the output type of the checked AST. dyn is checked at evaluation.
+func checkCELOutputType(src string, ast *cel.Ast, want []*cel.Type) error {
+	if len(want) == 0 {
+		return nil
+	}
+	got := ast.OutputType()
+	if got.Kind() == types.DynKind || got.Kind() == types.TypeParamKind {
+		return nil
+	}
+	for _, w := range want {
+		if w.IsAssignableType(got) {
+			return nil
+		}
+	}
+	names := make([]string, 0, len(want))
+	for _, w := range want {
+		names = append(names, w.String())
+	}
+	hint := ""
+	if got.IsExactType(cel.IntType) && slices.Contains(want, cel.DoubleType) {
+		hint = ", use double() to convert"
+	}
+	return &CELExpressionError{
+		Expr: src,
+		Err:  oops.Errorf("returns %s, but %s is required%s", got, strings.Join(names, " or "), hint),
+	}
+}
+
+// nullableLogFields are the CEL names of log fields which are null when the value is `-`.
+var nullableLogFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	rt := reflect.TypeOf(CELVariablesLog{})
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.Type.Kind() != reflect.Ptr {
+			continue
+		}
+		fields[f.Tag.Get("cel")] = true
+	}
+	return fields
+}()
+
+// warnNullableLogFields warns nullable log fields used without `has()` check or optional field selection (`log.?field`),
+// because they are evaluated as zero values (e.g., 0, "") when the field is `-`.
+func warnNullableLogFields(src string, ast *cel.Ast) {
+	var used, tested []string
+	celast.PreOrderVisit(ast.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() != celast.SelectKind {
+			return
+		}
+		sel := e.AsSelect()
+		if sel.Operand().Kind() != celast.IdentKind || sel.Operand().AsIdent() != "log" {
+			return
+		}
+		if !nullableLogFields[sel.FieldName()] {
+			return
+		}
+		if sel.IsTestOnly() {
+			tested = append(tested, sel.FieldName())
+			return
+		}
+		used = append(used, sel.FieldName())
+	}))
+	slices.Sort(used)
+	for _, field := range slices.Compact(used) {
+		if slices.Contains(tested, field) {
+			continue
+		}
+		slog.Warn("nullable field is used without has() check or optional field selection, zero value is used when the field is missing", "expr", src, "field", "log."+field)
+	}
+}
@@ -0,0 +1,73 @@
+package cflog2otel
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/types"
+	"github.com/samber/oops"
+)
+
+const (
+	// DefaultCELCostLimit is the default cost limit of each CEL expression evaluation.
+	DefaultCELCostLimit uint64 = 1000000
+	// DefaultCELInterruptCheckFrequency is the default number of iterations between interrupt checks in comprehensions.
+	DefaultCELInterruptCheckFrequency uint = 100
+)
+
+type celProgramConfig struct {
+	costLimit               uint64
+	interruptCheckFrequency uint
+	evalTimeout             time.Duration
+}
+
+var defaultCELProgramConfig = celProgramConfig{
+	costLimit:               DefaultCELCostLimit,
+	interruptCheckFrequency: DefaultCELInterruptCheckFrequency,
+}
+
+func (pc celProgramConfig) programOptions() []cel.ProgramOption {
+	opts := make([]cel.ProgramOption, 0, 2)
+	if pc.costLimit > 0 {
+		opts = append(opts, cel.CostLimit(pc.costLimit))
+	}
+	if pc.interruptCheckFrequency > 0 {
+		opts = append(opts, cel.InterruptCheckFrequency(pc.interruptCheckFrequency))
+	}
+	return opts
+}
+
+// CELCostEstimate is the estimated cost range of a CEL expression.
+type CELCostEstimate = checker.CostEstimate
+
+// sizes assumed for values whose size is unknown at compile time.
+const (
+	celEstimatedMaxStringSize = 8192
+	celEstimatedMaxListSize   = 256
+)
+
+// celCostEstimator estimates sizes of log values, which are unknown to CEL.
+type celCostEstimator struct{}
+
+func (celCostEstimator) EstimateSize(element checker.AstNode) *checker.SizeEstimate {
+	switch element.Type().Kind() {
+	case types.StringKind, types.BytesKind:
+		return &checker.SizeEstimate{Min: 0, Max: celEstimatedMaxStringSize}
+	case types.ListKind, types.MapKind:
+		return &checker.SizeEstimate{Min: 0, Max: celEstimatedMaxListSize}
+	}
+	return nil
+}
+
+func (celCostEstimator) EstimateCallCost(function, overloadID string, target *checker.AstNode, args []checker.AstNode) *checker.CallEstimate {
+	return nil
+}
+
+func estimateCELCost(env *cel.Env, ast *cel.Ast) (CELCostEstimate, error) {
+	est, err := env.EstimateCost(ast, celCostEstimator{})
+	if err != nil {
+		return CELCostEstimate{}, oops.Wrapf(err, "failed to estimate cost")
+	}
+	return est, nil
+}
@@ -0,0 +1,72 @@
+package cflog2otel
+
+import (
+	"slices"
+
+	"github.com/google/cel-go/cel"
+	"github.com/samber/oops"
+)
+
+// CELEnv is the CEL environment to compile expressions of the configuration.
+// it extends the builtin environment with custom functions and variables.
+type CELEnv struct {
+	env       *cel.Env
+	variables []CELVariable
+}
+
+// CELVariable is an extra variable namespace declared in CEL environment.
+// Value is called with the variables of the current log line each time an expression is evaluated.
+type CELVariable struct {
+	Name  string
+	Type  *cel.Type
+	Value func(vars *CELVariables) any
+}
+
+// builtinCELVariableNames are the variable names declared by the builtin environment.
+var builtinCELVariableNames = []string{"bucket", "object", "cloudfront", "log", "geo", "ua", "route", "defs"}
+
+// DefaultCELEnv returns the builtin CEL environment.
+func DefaultCELEnv() *CELEnv {
+	return &CELEnv{env: defaultCELEnv}
+}
+
+// NewCELEnv returns the builtin CEL environment extended with the options and the variables.
+func NewCELEnv(opts []cel.EnvOption, vars ...CELVariable) (*CELEnv, error) {
+	envOpts := slices.Clone(opts)
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		if v.Name == "" {
+			return nil, oops.Errorf("cel variable name is required")
+		}
+		if slices.Contains(builtinCELVariableNames, v.Name) || slices.Contains(names, v.Name) {
+			return nil, oops.Errorf("cel variable %q is already declared", v.Name)
+		}
+		if v.Type == nil || v.Value == nil {
+			return nil, oops.Errorf("cel variable %q: type and value are required", v.Name)
+		}
+		names = append(names, v.Name)
+		envOpts = append(envOpts, cel.Variable(v.Name, v.Type))
+	}
+	env, err := defaultCELEnv.Extend(envOpts...)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to extend CEL environment")
+	}
+	return &CELEnv{env: env, variables: slices.Clone(vars)}, nil
+}
+
+// Env returns the underlying CEL environment.
+func (e *CELEnv) Env() *cel.Env {
+	if e == nil {
+		return defaultCELEnv
+	}
+	return e.env
+}
+
+func (e *CELEnv) setVariables(m map[string]any, vars *CELVariables) {
+	if e == nil {
+		return
+	}
+	for _, v := range e.variables {
+		m[v.Name] = v.Value(vars)
+	}
+}
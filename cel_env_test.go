@@ -0,0 +1,116 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCELEnv(t *testing.T, tenant string) *cflog2otel.CELEnv {
+	t.Helper()
+	env, err := cflog2otel.NewCELEnv(
+		[]cel.EnvOption{
+			cel.Function("isStatic",
+				cel.Overload("isStatic_string", []*cel.Type{cel.StringType}, cel.BoolType,
+					cel.UnaryBinding(func(v ref.Val) ref.Val {
+						return types.Bool(strings.HasPrefix(string(v.(types.String)), "/static/"))
+					}),
+				),
+			),
+		},
+		cflog2otel.CELVariable{
+			Name: "tenant",
+			Type: cel.MapType(cel.StringType, cel.StringType),
+			Value: func(_ *cflog2otel.CELVariables) any {
+				return map[string]string{"name": tenant}
+			},
+		},
+	)
+	require.NoError(t, err)
+	return env
+}
+
+func TestConfig__WithCELEnv(t *testing.T) {
+	cfg := cflog2otel.DefaultConfig()
+	cfg.DeferCELBinding()
+	err := cfg.Load("testdata/custom_cel_env.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.NoError(t, err, "undeclared references are checked when bound")
+
+	ctx := context.Background()
+	vars := &cflog2otel.CELVariables{
+		Log: cflog2otel.CELVariablesLog{CsURIStem: aws.String("/static/app.js")},
+	}
+	_, err = cfg.Metrics[0].Filter.Eval(ctx, vars)
+	require.ErrorContains(t, err, "undeclared reference to 'isStatic'")
+
+	_, err = cfg.WithCELEnv(cflog2otel.DefaultCELEnv())
+	require.ErrorContains(t, err, "undeclared reference to 'isStatic'")
+
+	foo, err := cfg.WithCELEnv(newTestCELEnv(t, "foo"))
+	require.NoError(t, err)
+	bar, err := cfg.WithCELEnv(newTestCELEnv(t, "bar"))
+	require.NoError(t, err)
+
+	got, err := foo.Metrics[0].Filter.Eval(ctx, vars)
+	require.NoError(t, err)
+	require.True(t, got)
+
+	for name, bound := range map[string]*cflog2otel.Config{"foo": foo, "bar": bar} {
+		attrs, err := cflog2otel.ToAttributes(ctx, bound.ResourceAttributes, &cflog2otel.CELVariables{CELEnv: bound.CELEnv()})
+		require.NoError(t, err)
+		require.Len(t, attrs, 1)
+		require.Equal(t, name, attrs[0].Value.AsString())
+	}
+
+	_, err = cfg.Metrics[0].Filter.Eval(ctx, vars)
+	require.Error(t, err, "original config is not changed")
+}
+
+func TestConfig__DeferCELBinding(t *testing.T) {
+	cfg := cflog2otel.DefaultConfig()
+	cfg.DeferCELBinding()
+	err := cfg.Load("testdata/invalid_custom_cel_env_cycle.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.ErrorContains(t, err, "definitions: cycle detected: a -> b -> a", "the other expressions are checked")
+
+	cfg = cflog2otel.DefaultConfig()
+	cfg.DeferCELBinding()
+	err = cfg.Load("testdata/invalid_syntax_cel.jsonnet", cflog2otel.WithAWSConfig(aws.Config{}))
+	require.ErrorContains(t, err, "Syntax error", "syntax errors are not deferred")
+}
+
+func TestNewCELEnv__Invalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		v       cflog2otel.CELVariable
+		wantErr string
+	}{
+		{
+			name:    "builtin name",
+			v:       cflog2otel.CELVariable{Name: "log", Type: cel.StringType, Value: func(*cflog2otel.CELVariables) any { return "" }},
+			wantErr: `cel variable "log" is already declared`,
+		},
+		{
+			name:    "empty name",
+			v:       cflog2otel.CELVariable{Type: cel.StringType, Value: func(*cflog2otel.CELVariables) any { return "" }},
+			wantErr: "cel variable name is required",
+		},
+		{
+			name:    "no value",
+			v:       cflog2otel.CELVariable{Name: "tenant", Type: cel.StringType},
+			wantErr: `cel variable "tenant": type and value are required`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := cflog2otel.NewCELEnv(nil, c.v)
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package cflog2otel
+
+import "errors"
+
+type CELErrorPolicy int
+
+//go:generate enumer -type=CELErrorPolicy -trimprefix=CELErrorPolicy -transform=snake -json -text
+const (
+	CELErrorPolicyFail CELErrorPolicy = iota
+	CELErrorPolicySkipLine
+	CELErrorPolicyUseDefault
+)
+
+// ErrSkipLine is returned by CELCapable.Eval when the evaluation failed and `on_error` is `skip_line`.
+var ErrSkipLine = errors.New("skip line by on_error policy")
@@ -0,0 +1,303 @@
+package cflog2otel
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var (
+	// CELIPType is the CEL type of an IP address, created by `ip(string)`.
+	CELIPType = types.NewOpaqueType("net.IP")
+	// CELCIDRType is the CEL type of an IP prefix, created by `cidr(string)` or `ip.mask(int)`.
+	CELCIDRType = types.NewOpaqueType("net.CIDR")
+)
+
+// CELIP is the CEL value of an IP address.
+type CELIP struct {
+	netip.Addr
+}
+
+func (ip CELIP) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	switch typeDesc {
+	case reflect.TypeOf(netip.Addr{}):
+		return ip.Addr, nil
+	case reflect.TypeOf(""):
+		return ip.Addr.String(), nil
+	}
+	return nil, fmt.Errorf("type conversion error from 'net.IP' to '%v'", typeDesc)
+}
+
+func (ip CELIP) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case CELIPType:
+		return ip
+	case types.StringType:
+		return types.String(ip.Addr.String())
+	case types.TypeType:
+		return CELIPType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CELIPType, typeVal)
+}
+
+func (ip CELIP) Equal(other ref.Val) ref.Val {
+	o, ok := other.(CELIP)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(other)
+	}
+	return types.Bool(ip.Addr == o.Addr)
+}
+
+func (ip CELIP) Type() ref.Type {
+	return CELIPType
+}
+
+func (ip CELIP) Value() any {
+	return ip.Addr
+}
+
+// CELCIDR is the CEL value of an IP prefix.
+type CELCIDR struct {
+	netip.Prefix
+}
+
+func (c CELCIDR) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	switch typeDesc {
+	case reflect.TypeOf(netip.Prefix{}):
+		return c.Prefix, nil
+	case reflect.TypeOf(""):
+		return c.Prefix.String(), nil
+	}
+	return nil, fmt.Errorf("type conversion error from 'net.CIDR' to '%v'", typeDesc)
+}
+
+func (c CELCIDR) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case CELCIDRType:
+		return c
+	case types.StringType:
+		return types.String(c.Prefix.String())
+	case types.TypeType:
+		return CELCIDRType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CELCIDRType, typeVal)
+}
+
+func (c CELCIDR) Equal(other ref.Val) ref.Val {
+	o, ok := other.(CELCIDR)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(other)
+	}
+	return types.Bool(c.Prefix == o.Prefix)
+}
+
+func (c CELCIDR) Type() ref.Type {
+	return CELCIDRType
+}
+
+func (c CELCIDR) Value() any {
+	return c.Prefix
+}
+
+// NetworkCELLib returns CEL functions for IP addresses and CIDR matching.
+//
+//	ip(string) -> net.IP
+//	isIP(string) -> bool
+//	cidr(string) -> net.CIDR
+//	string(net.IP) -> string
+//	string(net.CIDR) -> string
+//	<net.IP>.family() -> int
+//	<net.IP>.isPrivate() -> bool
+//	<net.IP>.isLoopback() -> bool
+//	<net.IP>.mask(int) -> net.CIDR
+//	<net.CIDR>.contains(net.IP) -> bool
+//	<net.CIDR>.contains(string) -> bool
+//	<net.CIDR>.ip() -> net.IP
+//	<net.CIDR>.prefixLength() -> int
+func NetworkCELLib() cel.EnvOption {
+	return cel.Lib(networkCELLib{})
+}
+
+type networkCELLib struct{}
+
+func (networkCELLib) LibraryName() string {
+	return "cflog2otel.network"
+}
+
+func (networkCELLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("ip",
+			cel.Overload("ip_string", []*cel.Type{cel.StringType}, CELIPType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					s, ok := arg.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return parseCELIP(string(s))
+				}),
+			),
+			cel.MemberOverload("net_cidr_ip", []*cel.Type{CELCIDRType}, CELIPType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					c, ok := arg.(CELCIDR)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return CELIP{Addr: c.Prefix.Addr()}
+				}),
+			),
+		),
+		cel.Function("isIP",
+			cel.Overload("is_ip_string", []*cel.Type{cel.StringType}, cel.BoolType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					s, ok := arg.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					_, err := netip.ParseAddr(string(s))
+					return types.Bool(err == nil)
+				}),
+			),
+		),
+		cel.Function("cidr",
+			cel.Overload("cidr_string", []*cel.Type{cel.StringType}, CELCIDRType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					s, ok := arg.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					prefix, err := netip.ParsePrefix(string(s))
+					if err != nil {
+						return types.NewErr("cidr: invalid prefix %q", string(s))
+					}
+					return CELCIDR{Prefix: prefix.Masked()}
+				}),
+			),
+		),
+		cel.Function("string",
+			cel.Overload("string_net_ip", []*cel.Type{CELIPType}, cel.StringType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					return arg.ConvertToType(types.StringType)
+				}),
+			),
+			cel.Overload("string_net_cidr", []*cel.Type{CELCIDRType}, cel.StringType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					return arg.ConvertToType(types.StringType)
+				}),
+			),
+		),
+		cel.Function("family",
+			cel.MemberOverload("net_ip_family", []*cel.Type{CELIPType}, cel.IntType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					ip, ok := arg.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					if ip.Addr.Is4() || ip.Addr.Is4In6() {
+						return types.Int(4)
+					}
+					return types.Int(6)
+				}),
+			),
+		),
+		cel.Function("isPrivate",
+			cel.MemberOverload("net_ip_is_private", []*cel.Type{CELIPType}, cel.BoolType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					ip, ok := arg.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return types.Bool(ip.Addr.Unmap().IsPrivate())
+				}),
+			),
+		),
+		cel.Function("isLoopback",
+			cel.MemberOverload("net_ip_is_loopback", []*cel.Type{CELIPType}, cel.BoolType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					ip, ok := arg.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return types.Bool(ip.Addr.Unmap().IsLoopback())
+				}),
+			),
+		),
+		cel.Function("mask",
+			cel.MemberOverload("net_ip_mask_int", []*cel.Type{CELIPType, cel.IntType}, CELCIDRType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					ip, ok := lhs.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					bits, ok := rhs.(types.Int)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					prefix, err := ip.Addr.Unmap().Prefix(int(bits))
+					if err != nil {
+						return types.NewErr("mask: invalid prefix length %d for %s", int64(bits), ip.Addr)
+					}
+					return CELCIDR{Prefix: prefix}
+				}),
+			),
+		),
+		cel.Function("contains",
+			cel.MemberOverload("net_cidr_contains_ip", []*cel.Type{CELCIDRType, CELIPType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					c, ok := lhs.(CELCIDR)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					ip, ok := rhs.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return types.Bool(c.Prefix.Contains(ip.Addr.Unmap()))
+				}),
+			),
+			cel.MemberOverload("net_cidr_contains_string", []*cel.Type{CELCIDRType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					c, ok := lhs.(CELCIDR)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					s, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					addr, err := netip.ParseAddr(string(s))
+					if err != nil {
+						return types.NewErr("contains: invalid address %q", string(s))
+					}
+					return types.Bool(c.Prefix.Contains(addr.Unmap()))
+				}),
+			),
+		),
+		cel.Function("prefixLength",
+			cel.MemberOverload("net_cidr_prefix_length", []*cel.Type{CELCIDRType}, cel.IntType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					c, ok := arg.(CELCIDR)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return types.Int(c.Prefix.Bits())
+				}),
+			),
+		),
+	}
+}
+
+func (networkCELLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{}
+}
+
+func parseCELIP(s string) ref.Val {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return types.NewErr("ip: invalid address %q", s)
+	}
+	return CELIP{Addr: addr}
+}
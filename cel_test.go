@@ -1,9 +1,13 @@
 package cflog2otel_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -97,7 +101,7 @@ func TestCELCapable(t *testing.T) {
 			name:             "type missmatch expr type",
 			expr:             `cel('bucket.name')`,
 			variables:        &cflog2otel.CELVariables{},
-			wantUnmarshalErr: `failed to convert CEL expression value to int64`,
+			wantUnmarshalErr: `cel("bucket.name"): returns string, but int is required`,
 		},
 		testCaseCELCapable[string]{
 			name: "switch case yes",
@@ -187,8 +191,345 @@ func TestCELCapable(t *testing.T) {
 			},
 			want: "my-bucket2",
 		},
+		testCaseCELCapable[string]{
+			name: "log fields map",
+			expr: `cel('"asn" in log.fields ? log.fields["asn"] : "unknown"')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					Fields: map[string]string{
+						"asn": "16509",
+					},
+				},
+			},
+			want: "16509",
+		},
+		testCaseCELCapable[string]{
+			name: "log fields map missing key",
+			expr: `cel('"asn" in log.fields ? log.fields["asn"] : "unknown"')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					Fields: map[string]string{},
+				},
+			},
+			want: "unknown",
+		},
+		testCaseCELCapable[bool]{
+			name: "ip is private",
+			expr: `cel('isIP(log.clientIp) && ip(log.clientIp).isPrivate()')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ClientIP: ptr("10.1.2.3"),
+				},
+			},
+			want: true,
+		},
+		testCaseCELCapable[bool]{
+			name:      "cidr contains ip",
+			expr:      `cel('cidr("192.0.2.0/24").contains(ip("192.0.2.100")) && !cidr("192.0.2.0/24").contains("198.51.100.1")')`,
+			variables: &cflog2otel.CELVariables{},
+			want:      true,
+		},
+		testCaseCELCapable[bool]{
+			name: "cidr contains invalid ip string",
+			expr: `cel('cidr("192.0.2.0/24").contains(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ClientIP: ptr("unknown"),
+				},
+			},
+			wantEvalErr: `contains: invalid address "unknown"`,
+		},
+		testCaseCELCapable[string]{
+			name: "ip mask",
+			expr: `cel('isIP(log.clientIp) ? string(ip(log.clientIp).mask(24)) : "unknown"')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ClientIP: ptr("192.0.2.100"),
+				},
+			},
+			want: "192.0.2.0/24",
+		},
+		testCaseCELCapable[int64]{
+			name: "ip family",
+			expr: `cel('isIP(log.clientIp) ? ip(log.clientIp).family() : 0')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ClientIP: ptr("2001:db8::1"),
+				},
+			},
+			want: 6,
+		},
+		testCaseCELCapable[string]{
+			name:      "cidr ip and prefix length",
+			expr:      `cel('string(cidr("2001:db8::1/32").ip()) + "/" + string(cidr("2001:db8::1/32").prefixLength())')`,
+			variables: &cflog2otel.CELVariables{},
+			want:      "2001:db8::/32",
+		},
+		testCaseCELCapable[string]{
+			name: "ip without guard",
+			expr: `cel('string(ip(log.clientIp).mask(24))')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ClientIP: ptr("192.0.2.100"),
+				},
+			},
+			want: "192.0.2.0/24",
+		},
+		testCaseCELCapable[bool]{
+			name:             "switch case not bool",
+			expr:             `switch([{case: cel('log.csMethod'), value: true}, {default: false}])`,
+			variables:        &cflog2otel.CELVariables{},
+			wantUnmarshalErr: `switch case[0]: cel("log.csMethod"): returns string, but bool is required`,
+		},
+		testCaseCELCapable[float64]{
+			name:             "int value for double",
+			expr:             `cel('log.scBytes')`,
+			variables:        &cflog2otel.CELVariables{},
+			wantUnmarshalErr: `returns int, but double is required, use double() to convert`,
+		},
+		testCaseCELCapable[float64]{
+			name: "dyn value is checked at evaluation",
+			expr: `cel('dyn(log.fields["x"])')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					Fields: map[string]string{"x": "1"},
+				},
+			},
+			wantEvalErr: `failed to convert CEL expression value to float64`,
+		},
+		testCaseCELCapable[int64]{
+			name:      "optional field not set",
+			expr:      `cel('log.?scBytes.orValue(-1)')`,
+			variables: &cflog2otel.CELVariables{},
+			want:      -1,
+		},
+		testCaseCELCapable[int64]{
+			name: "optional field set",
+			expr: `cel('log.?scBytes.orValue(-1)')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					ScBytes: ptr(1024),
+				},
+			},
+			want: 1024,
+		},
+		testCaseCELCapable[string]{
+			name:        "on_error fail",
+			expr:        `cel('log.fields["asn"]')`,
+			variables:   &cflog2otel.CELVariables{},
+			wantEvalErr: "no such key: asn",
+		},
+		testCaseCELCapable[string]{
+			name:        "on_error skip_line",
+			expr:        `cel('log.fields["asn"]') + { on_error: 'skip_line' }`,
+			variables:   &cflog2otel.CELVariables{},
+			wantEvalErr: "skip line by on_error policy",
+		},
+		testCaseCELCapable[string]{
+			name:      "on_error use_default",
+			expr:      `cel('log.fields["asn"]') + { on_error: 'use_default', default: 'unknown' }`,
+			variables: &cflog2otel.CELVariables{},
+			want:      "unknown",
+		},
+		testCaseCELCapable[string]{
+			name:      "on_error use_default with switch default",
+			expr:      `switch([{case: cel('log.fields["asn"] == "16509"'), value: 'amazon'}, {default: 'other'}]) + { on_error: 'use_default' }`,
+			variables: &cflog2otel.CELVariables{},
+			want:      "other",
+		},
+		testCaseCELCapable[string]{
+			name:             "invalid on_error default type",
+			expr:             `cel('log.fields["asn"]') + { on_error: 'use_default', default: 1 }`,
+			variables:        &cflog2otel.CELVariables{},
+			wantUnmarshalErr: "on_error",
+		},
+		testCaseCELCapable[string]{
+			name: "log query map",
+			expr: `cel('"utm_source" in log.query ? log.query["utm_source"][0] : "direct"')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					Query: map[string][]string{
+						"utm_source": {"newsletter"},
+					},
+				},
+			},
+			want: "newsletter",
+		},
+		testCaseCELCapable[string]{
+			name:      "log query map not populated",
+			expr:      `cel('"utm_source" in log.query ? log.query["utm_source"][0] : "direct"')`,
+			variables: &cflog2otel.CELVariables{},
+			want:      "direct",
+		},
+		testCaseCELCapable[string]{
+			name: "log cookies map",
+			expr: `cel('"ab_test" in log.cookies ? log.cookies["ab_test"] : "none"')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{
+					Cookies: map[string]string{
+						"ab_test": "B",
+					},
+				},
+			},
+			want: "B",
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.Name(), tc.Run)
 	}
 }
+
+func TestCELCapable__LogReferences(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		want cflog2otel.CELLogReferences
+	}{
+		{
+			name: "raw value",
+			expr: `"query"`,
+			want: cflog2otel.CELLogReferences{},
+		},
+		{
+			name: "no derived fields",
+			expr: `{"expr": "log.csUriQuery"}`,
+			want: cflog2otel.CELLogReferences{Fields: []string{"csUriQuery"}},
+		},
+		{
+			name: "query",
+			expr: `{"expr": "log.query.exists(k, k == \"utm_source\") ? \"yes\" : \"no\""}`,
+			want: cflog2otel.CELLogReferences{Query: true, Fields: []string{"query"}},
+		},
+		{
+			name: "query by index",
+			expr: `{"expr": "\"utm_source\" in dyn(log)[\"query\"] ? \"yes\" : \"no\""}`,
+			want: cflog2otel.CELLogReferences{Query: true, Fields: []string{"query"}},
+		},
+		{
+			name: "cookies by optional index",
+			expr: `{"expr": "dyn(log)[?\"cookies\"].orValue({}).size() > 0 ? \"yes\" : \"no\""}`,
+			want: cflog2otel.CELLogReferences{Cookies: true, Fields: []string{"cookies"}},
+		},
+		{
+			name: "cookies by dyn select",
+			expr: `{"expr": "dyn(log).cookies.size() > 0 ? \"yes\" : \"no\""}`,
+			want: cflog2otel.CELLogReferences{Cookies: true, Fields: []string{"cookies"}},
+		},
+		{
+			name: "dynamic key",
+			expr: `{"expr": "string(size(dyn(log)[log.csMethod == \"GET\" ? \"query\" : \"cookies\"]))"}`,
+			want: cflog2otel.CELLogReferences{Query: true, Cookies: true, Fields: []string{"csMethod"}},
+		},
+		{
+			name: "cookies in switch",
+			expr: `{"switch": [{"case": "\"ab\" in log.cookies", "value_expr": "string(size(log.cookies))"}, {"default": ""}]}`,
+			want: cflog2otel.CELLogReferences{Cookies: true, Fields: []string{"cookies"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expr cflog2otel.CELCapable[string]
+			require.NoError(t, json.Unmarshal([]byte(tc.expr), &expr))
+			require.Equal(t, tc.want, expr.LogReferences())
+		})
+	}
+}
+
+func TestCELCapable__LogReferencesByIndex(t *testing.T) {
+	var expr cflog2otel.CELCapable[string]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "dyn(log)[\"query\"][\"utm_source\"][0] + \":\" + dyn(log).cookies[\"ab_test\"]"}`), &expr))
+	vars := cflog2otel.CELVariables{LogRefs: expr.LogReferences()}
+	vars.SetLogLine(cflog2otel.CELVariablesLog{
+		CsURIQuery: ptr("utm_source=newsletter"),
+		CsCookie:   ptr("session=abc;%20ab_test=B"),
+	})
+	got, err := expr.Eval(context.Background(), &vars)
+	require.NoError(t, err)
+	require.Equal(t, "newsletter:B", got)
+}
+
+func TestCELVariables__SetLogLine(t *testing.T) {
+	log := cflog2otel.CELVariablesLog{
+		CsURIQuery: ptr("utm_source=newsletter&tag=a&tag=b"),
+		CsCookie:   ptr("session=abc;%20ab_test=B"),
+	}
+	var vars cflog2otel.CELVariables
+	vars.SetLogLine(log)
+	require.Nil(t, vars.Log.Query)
+	require.Nil(t, vars.Log.Cookies)
+
+	vars.LogRefs = cflog2otel.CELLogReferences{Query: true, Cookies: true}
+	vars.SetLogLine(log)
+	require.Equal(t, map[string][]string{
+		"utm_source": {"newsletter"},
+		"tag":        {"a", "b"},
+	}, vars.Log.Query)
+	require.Equal(t, map[string]string{
+		"session": "abc",
+		"ab_test": "B",
+	}, vars.Log.Cookies)
+}
+
+func TestCELCapable__NullableFieldWarning(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	var expr cflog2otel.CELCapable[float64]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "double(log.scBytes)"}`), &expr))
+	require.Contains(t, buf.String(), "field=log.scBytes")
+
+	buf.Reset()
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "has(log.scBytes) ? double(log.scBytes) : 0.0"}`), &expr))
+	require.Empty(t, buf.String())
+}
+
+func TestConfig__CELCostLimit(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	path := filepath.Join(t.TempDir(), "config.jsonnet")
+	require.NoError(t, os.WriteFile(path, []byte(`
+local cel = std.native('cel');
+{
+  scope: { name: 'test' },
+  cel: { cost_limit: 100 },
+  metrics: [
+    {
+      name: 'http.server.requests',
+      type: 'Count',
+      filter: cel('log.fields.exists(k, k.startsWith("x-"))'),
+    },
+  ],
+}
+`), 0644))
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load(path, cflog2otel.WithAWSConfig(aws.Config{})))
+	require.Contains(t, buf.String(), "path=metrics[0].filter")
+	require.Contains(t, buf.String(), "cost_limit=100")
+
+	costs, err := cfg.EstimateCELCosts()
+	require.NoError(t, err)
+	require.Greater(t, costs["metrics[0].filter"].Max, uint64(100))
+
+	ctx := context.Background()
+	vars := &cflog2otel.CELVariables{
+		Log: cflog2otel.CELVariablesLog{
+			Fields: map[string]string{"cs(Host)": "example.com"},
+		},
+	}
+	got, err := cfg.Metrics[0].Filter.Eval(ctx, vars)
+	require.NoError(t, err)
+	require.False(t, got)
+
+	fields := make(map[string]string, 200)
+	for i := range 200 {
+		fields[fmt.Sprintf("field-%d", i)] = "value"
+	}
+	vars.Log.Fields = fields
+	_, err = cfg.Metrics[0].Filter.Eval(ctx, vars)
+	require.ErrorContains(t, err, "cost limit exceeded")
+}
@@ -0,0 +1,115 @@
+// Code generated by "enumer -type=CELErrorPolicy -trimprefix=CELErrorPolicy -transform=snake -json -text"; DO NOT EDIT.
+
+package cflog2otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const _CELErrorPolicyName = "failskip_lineuse_default"
+
+var _CELErrorPolicyIndex = [...]uint8{0, 4, 13, 24}
+
+const _CELErrorPolicyLowerName = "failskip_lineuse_default"
+
+func (i CELErrorPolicy) String() string {
+	if i < 0 || i >= CELErrorPolicy(len(_CELErrorPolicyIndex)-1) {
+		return fmt.Sprintf("CELErrorPolicy(%d)", i)
+	}
+	return _CELErrorPolicyName[_CELErrorPolicyIndex[i]:_CELErrorPolicyIndex[i+1]]
+}
+
+// An "invalid array index" compiler error signifies that the constant values have changed.
+// Re-run the stringer command to generate them again.
+func _CELErrorPolicyNoOp() {
+	var x [1]struct{}
+	_ = x[CELErrorPolicyFail-(0)]
+	_ = x[CELErrorPolicySkipLine-(1)]
+	_ = x[CELErrorPolicyUseDefault-(2)]
+}
+
+var _CELErrorPolicyValues = []CELErrorPolicy{CELErrorPolicyFail, CELErrorPolicySkipLine, CELErrorPolicyUseDefault}
+
+var _CELErrorPolicyNameToValueMap = map[string]CELErrorPolicy{
+	_CELErrorPolicyName[0:4]:   CELErrorPolicyFail,
+	_CELErrorPolicyName[4:13]:  CELErrorPolicySkipLine,
+	_CELErrorPolicyName[13:24]: CELErrorPolicyUseDefault,
+}
+
+var _CELErrorPolicyLowerNameToValueMap = map[string]CELErrorPolicy{
+	_CELErrorPolicyLowerName[0:4]:   CELErrorPolicyFail,
+	_CELErrorPolicyLowerName[4:13]:  CELErrorPolicySkipLine,
+	_CELErrorPolicyLowerName[13:24]: CELErrorPolicyUseDefault,
+}
+
+var _CELErrorPolicyNames = []string{
+	_CELErrorPolicyName[0:4],
+	_CELErrorPolicyName[4:13],
+	_CELErrorPolicyName[13:24],
+}
+
+// CELErrorPolicyString retrieves an enum value from the enum constants string name.
+// Throws an error if the param is not part of the enum.
+func CELErrorPolicyString(s string) (CELErrorPolicy, error) {
+	if val, ok := _CELErrorPolicyNameToValueMap[s]; ok {
+		return val, nil
+	}
+
+	if val, ok := _CELErrorPolicyLowerNameToValueMap[strings.ToLower(s)]; ok {
+		return val, nil
+	}
+	return 0, fmt.Errorf("%s does not belong to CELErrorPolicy values", s)
+}
+
+// CELErrorPolicyValues returns all values of the enum
+func CELErrorPolicyValues() []CELErrorPolicy {
+	return _CELErrorPolicyValues
+}
+
+// CELErrorPolicyStrings returns a slice of all String values of the enum
+func CELErrorPolicyStrings() []string {
+	strs := make([]string, len(_CELErrorPolicyNames))
+	copy(strs, _CELErrorPolicyNames)
+	return strs
+}
+
+// IsACELErrorPolicy returns "true" if the value is listed in the enum definition. "false" otherwise
+func (i CELErrorPolicy) IsACELErrorPolicy() bool {
+	for _, v := range _CELErrorPolicyValues {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface for CELErrorPolicy
+func (i CELErrorPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for CELErrorPolicy
+func (i *CELErrorPolicy) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("CELErrorPolicy should be a string, got %s", data)
+	}
+
+	var err error
+	*i, err = CELErrorPolicyString(s)
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for CELErrorPolicy
+func (i CELErrorPolicy) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for CELErrorPolicy
+func (i *CELErrorPolicy) UnmarshalText(text []byte) error {
+	var err error
+	*i, err = CELErrorPolicyString(string(text))
+	return err
+}
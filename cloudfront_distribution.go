@@ -0,0 +1,122 @@
+package cflog2otel
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/samber/oops"
+)
+
+const (
+	// DefaultCloudFrontCacheTTL is the default duration to cache distribution metadata resolved by API.
+	DefaultCloudFrontCacheTTL = time.Hour
+	// cloudFrontFailureCacheTTL is the duration to use the static metadata after the lookup failed, to avoid calling API for every object.
+	cloudFrontFailureCacheTTL = time.Minute
+)
+
+// CloudFrontAPIClient is the CloudFront API used to resolve distribution metadata.
+type CloudFrontAPIClient interface {
+	GetDistribution(ctx context.Context, params *cloudfront.GetDistributionInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetDistributionOutput, error)
+	ListTagsForResource(ctx context.Context, params *cloudfront.ListTagsForResourceInput, optFns ...func(*cloudfront.Options)) (*cloudfront.ListTagsForResourceOutput, error)
+}
+
+// CloudFrontDistributionResolver resolves metadata of distributions by CloudFront API or static config.
+// the results are cached in the resolver, so keep it across invocations.
+type CloudFrontDistributionResolver struct {
+	cfg    *CloudFrontEnrichmentConfig
+	client CloudFrontAPIClient
+	mu     sync.Mutex
+	cache  map[string]cloudFrontDistributionCacheEntry
+}
+
+type cloudFrontDistributionCacheEntry struct {
+	dist      CloudFrontDistributionConfig
+	expiresAt time.Time
+}
+
+// NewCloudFrontDistributionResolver returns a resolver. client is required only if API is enabled.
+func NewCloudFrontDistributionResolver(cfg *CloudFrontEnrichmentConfig, client CloudFrontAPIClient) (*CloudFrontDistributionResolver, error) {
+	if cfg.API && client == nil {
+		return nil, oops.Errorf("cloudfront client is required if api is enabled")
+	}
+	return &CloudFrontDistributionResolver{
+		cfg:    cfg,
+		client: client,
+		cache:  make(map[string]cloudFrontDistributionCacheEntry),
+	}, nil
+}
+
+// SetVariables sets the metadata of the distribution to `cloudfront` variable.
+func (r *CloudFrontDistributionResolver) SetVariables(ctx context.Context, vars *CELVariablesCloudFront) {
+	if r == nil || vars.DistributionID == "" {
+		return
+	}
+	dist := r.Resolve(ctx, vars.DistributionID)
+	vars.Aliases = dist.Aliases
+	vars.Comment = dist.Comment
+	vars.Tags = dist.Tags
+	vars.PriceClass = dist.PriceClass
+}
+
+// Resolve returns the metadata of the distribution. if the lookup by API failed, returns the static metadata in config.
+func (r *CloudFrontDistributionResolver) Resolve(ctx context.Context, distributionID string) CloudFrontDistributionConfig {
+	static := r.cfg.Distributions[distributionID]
+	if !r.cfg.API {
+		return static
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := flextime.Now()
+	if entry, ok := r.cache[distributionID]; ok && now.Before(entry.expiresAt) {
+		return entry.dist
+	}
+	dist, err := r.lookup(ctx, distributionID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to lookup cloudfront distribution, use static metadata", "distribution_id", distributionID, "error", err)
+		r.cache[distributionID] = cloudFrontDistributionCacheEntry{dist: static, expiresAt: now.Add(cloudFrontFailureCacheTTL)}
+		return static
+	}
+	r.cache[distributionID] = cloudFrontDistributionCacheEntry{dist: dist, expiresAt: now.Add(r.cfg.CacheTTLDuration())}
+	return dist
+}
+
+func (r *CloudFrontDistributionResolver) lookup(ctx context.Context, distributionID string) (CloudFrontDistributionConfig, error) {
+	var dist CloudFrontDistributionConfig
+	out, err := r.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{
+		Id: aws.String(distributionID),
+	})
+	if err != nil {
+		return dist, oops.Wrapf(err, "get distribution")
+	}
+	if out.Distribution == nil {
+		return dist, oops.Errorf("distribution %s not found", distributionID)
+	}
+	if dc := out.Distribution.DistributionConfig; dc != nil {
+		if dc.Aliases != nil {
+			dist.Aliases = dc.Aliases.Items
+		}
+		dist.Comment = aws.ToString(dc.Comment)
+		dist.PriceClass = string(dc.PriceClass)
+	}
+	tagsOut, err := r.client.ListTagsForResource(ctx, &cloudfront.ListTagsForResourceInput{
+		Resource: out.Distribution.ARN,
+	})
+	if err != nil {
+		return dist, oops.Wrapf(err, "list tags for resource")
+	}
+	dist.Tags = make(map[string]string)
+	if tagsOut.Tags != nil {
+		for _, tag := range tagsOut.Tags.Items {
+			if tag.Key == nil {
+				continue
+			}
+			dist.Tags[*tag.Key] = aws.ToString(tag.Value)
+		}
+	}
+	return dist, nil
+}
@@ -0,0 +1,101 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testStaticDistributions = map[string]cflog2otel.CloudFrontDistributionConfig{
+	"EMLARXS9EXAMPLE": {
+		Aliases: []string{"static.example.com"},
+		Comment: "static",
+	},
+}
+
+func TestCloudFrontDistributionResolver__Static(t *testing.T) {
+	cfg := &cflog2otel.CloudFrontEnrichmentConfig{Distributions: testStaticDistributions}
+	require.NoError(t, cfg.Validate())
+	resolver, err := cflog2otel.NewCloudFrontDistributionResolver(cfg, nil)
+	require.NoError(t, err)
+
+	vars := cflog2otel.CELVariablesCloudFront{DistributionID: "EMLARXS9EXAMPLE"}
+	resolver.SetVariables(context.Background(), &vars)
+	require.Equal(t, []string{"static.example.com"}, vars.Aliases)
+	require.Equal(t, "static", vars.Comment)
+
+	vars = cflog2otel.CELVariablesCloudFront{DistributionID: "EUNKNOWN"}
+	resolver.SetVariables(context.Background(), &vars)
+	require.Empty(t, vars.Aliases)
+}
+
+func TestCloudFrontDistributionResolver__API(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockCloudFrontAPIClient(ctrl)
+	arn := "arn:aws:cloudfront::123456789012:distribution/EMLARXS9EXAMPLE"
+	client.On("GetDistribution", mock.Anything, mock.MatchedBy(func(input *cloudfront.GetDistributionInput) bool {
+		return *input.Id == "EMLARXS9EXAMPLE"
+	})).Return(&cloudfront.GetDistributionOutput{
+		Distribution: &types.Distribution{
+			ARN: aws.String(arn),
+			DistributionConfig: &types.DistributionConfig{
+				Aliases:    &types.Aliases{Items: []string{"www.example.com"}, Quantity: aws.Int32(1)},
+				Comment:    aws.String("example site"),
+				PriceClass: types.PriceClassPriceClassAll,
+			},
+		},
+	}, nil).Twice()
+	client.On("ListTagsForResource", mock.Anything, mock.MatchedBy(func(input *cloudfront.ListTagsForResourceInput) bool {
+		return *input.Resource == arn
+	})).Return(&cloudfront.ListTagsForResourceOutput{
+		Tags: &types.Tags{Items: []types.Tag{{Key: aws.String("team"), Value: aws.String("web")}}},
+	}, nil).Twice()
+	client.On("GetDistribution", mock.Anything, mock.MatchedBy(func(input *cloudfront.GetDistributionInput) bool {
+		return *input.Id == "EFAILED"
+	})).Return(nil, errors.New("AccessDenied")).Once()
+
+	cfg := &cflog2otel.CloudFrontEnrichmentConfig{
+		API:      true,
+		CacheTTL: "10m",
+		Distributions: map[string]cflog2otel.CloudFrontDistributionConfig{
+			"EFAILED": {Aliases: []string{"fallback.example.com"}},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	resolver, err := cflog2otel.NewCloudFrontDistributionResolver(cfg, client)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Date(2019, 12, 1, 22, 56, 0, 0, time.UTC)
+	restore := flextime.Fix(now)
+	defer restore()
+	want := cflog2otel.CloudFrontDistributionConfig{
+		Aliases:    []string{"www.example.com"},
+		Comment:    "example site",
+		Tags:       map[string]string{"team": "web"},
+		PriceClass: "PriceClass_All",
+	}
+	require.Equal(t, want, resolver.Resolve(ctx, "EMLARXS9EXAMPLE"))
+	flextime.Fix(now.Add(5 * time.Minute))
+	require.Equal(t, want, resolver.Resolve(ctx, "EMLARXS9EXAMPLE"), "cached")
+	flextime.Fix(now.Add(11 * time.Minute))
+	require.Equal(t, want, resolver.Resolve(ctx, "EMLARXS9EXAMPLE"), "expired")
+
+	require.Equal(t, []string{"fallback.example.com"}, resolver.Resolve(ctx, "EFAILED").Aliases)
+	require.Equal(t, []string{"fallback.example.com"}, resolver.Resolve(ctx, "EFAILED").Aliases, "failure is cached")
+}
+
+func TestNewCloudFrontDistributionResolver__ClientRequired(t *testing.T) {
+	_, err := cflog2otel.NewCloudFrontDistributionResolver(&cflog2otel.CloudFrontEnrichmentConfig{API: true}, nil)
+	require.ErrorContains(t, err, "cloudfront client is required")
+}
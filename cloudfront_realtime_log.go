@@ -0,0 +1,92 @@
+package cflog2otel
+
+import (
+	"context"
+	"io"
+	"iter"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+// cloudFrontRealtimeLogAliases maps the field names of real-time logs to the ones of standard logs.
+var cloudFrontRealtimeLogAliases = map[string]string{
+	"cs-host":       "cs(Host)",
+	"cs-user-agent": "cs(User-Agent)",
+	"cs-referer":    "cs(Referer)",
+	"cs-cookie":     "cs(Cookie)",
+}
+
+func init() {
+	var l CELVariablesLog
+	for name := range l.CloudFrontStandardLogFieldSetters() {
+		if _, ok := cloudFrontRealtimeLogAliases[name]; !ok && !strings.Contains(name, "(") {
+			cloudFrontRealtimeLogAliases[name] = name
+		}
+	}
+}
+
+var cloudFrontRealtimeLogFormat = positionalLogFormat{
+	logType: "CloudFront Real-time Log",
+	split: func(line string) ([]string, error) {
+		return strings.Split(line, "\t"), nil
+	},
+	aliases: cloudFrontRealtimeLogAliases,
+	setters: func(l *CELVariablesLog) map[string]func(string) error {
+		return map[string]func(string) error{
+			// timestamp is the epoch seconds with milliseconds, e.g. 1573680000.123
+			"timestamp": func(s string) error {
+				sec, frac, _ := strings.Cut(s, ".")
+				secs, err := strconv.ParseInt(sec, 10, 64)
+				if err != nil {
+					return oops.Wrapf(err, "failed to parse timestamp")
+				}
+				var nsec int64
+				if frac != "" {
+					n, err := strconv.ParseInt((frac + "000000000")[:9], 10, 64)
+					if err != nil {
+						return oops.Wrapf(err, "failed to parse timestamp")
+					}
+					nsec = n
+				}
+				l.Timestamp = time.Unix(secs, nsec).UTC()
+				return nil
+			},
+		}
+	},
+}
+
+var cloudFrontRealtimeLogLine = regexp.MustCompile(`^\d{10}\.\d{3}\t`)
+
+// CloudFrontRealtimeLogParser is the LogParser of CloudFront real-time logs delivered to S3 by Kinesis Data Firehose.
+// the logs have no header, so the fields must be configured by `parse.realtime_fields` in the order of the real-time log config.
+type CloudFrontRealtimeLogParser struct{}
+
+func (CloudFrontRealtimeLogParser) Name() string {
+	return LogFormatCloudFrontRealtime
+}
+
+func (CloudFrontRealtimeLogParser) Detect(objectKey string, head []byte) bool {
+	return cloudFrontRealtimeLogLine.Match(head)
+}
+
+func (CloudFrontRealtimeLogParser) Parse(ctx context.Context, r io.Reader, cfg ParseConfig) iter.Seq2[CELVariablesLog, error] {
+	if len(cfg.RealtimeFields) == 0 {
+		return func(yield func(CELVariablesLog, error) bool) {
+			yield(CELVariablesLog{}, oops.Errorf("parse.realtime_fields is required for %s", LogFormatCloudFrontRealtime))
+		}
+	}
+	format := cloudFrontRealtimeLogFormat
+	format.minFields = len(cfg.RealtimeFields)
+	format.maxFields = len(cfg.RealtimeFields)
+	return format.parse(ctx, r, cfg.RealtimeFields)
+}
+
+func (CloudFrontRealtimeLogParser) Schema() []CELField {
+	return NewLogSchema(cloudFrontLogCELFields, append([]string{"timestamp"}, slices.Sorted(maps.Keys(cloudFrontRealtimeLogAliases))...))
+}
@@ -2,11 +2,14 @@ package cflog2otel
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -51,6 +54,19 @@ type CELVariablesLog struct {
 	ScContentLen           *int      `json:"scContentLen" cel:"scContentLen"`
 	ScRangeStart           *string   `json:"scRangeStart" cel:"scRangeStart"`
 	ScRangeEnd             *string   `json:"scRangeEnd" cel:"scRangeEnd"`
+
+	// Route is the matched template of `routes` config for CsURIStem.
+	Route string `json:"route" cel:"route"`
+
+	// Query is the parsed CsURIQuery, populated only when `log.query` is referenced by the config.
+	Query map[string][]string `json:"query,omitempty" cel:"query"`
+
+	// Cookies is the parsed CsCookie, populated only when `log.cookies` is referenced by the config.
+	Cookies map[string]string `json:"cookies,omitempty" cel:"cookies"`
+
+	// Fields holds all raw field values keyed by the W3C field name, including unknown fields.
+	// fields with `-` value are not included.
+	Fields map[string]string `json:"fields" cel:"fields"`
 }
 
 func (l *CELVariablesLog) CloudFrontStandardLogFieldSetters() map[string]func(string) error {
@@ -276,56 +292,198 @@ func toPtrFloat64(s string) (*float64, error) {
 	return &val, nil
 }
 
+// ParseLineError describes a log line that could not be parsed.
+type ParseLineError struct {
+	Line   int
+	Field  string
+	Reason string
+	Err    error
+}
+
+func (e *ParseLineError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("line %d: field %q: %s: %v", e.Line, e.Field, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Reason, e.Err)
+}
+
+func (e *ParseLineError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	ParseErrorReasonTooManyValues = "too_many_values"
+	ParseErrorReasonTooFewValues  = "too_few_values"
+	ParseErrorReasonInvalidValue  = "invalid_value"
+)
+
+// ParseStats holds the line counts of parsed log objects.
+type ParseStats struct {
+	TotalLines   int
+	SkippedLines []*ParseLineError
+}
+
+// Merge adds the counts of other to s.
+func (s *ParseStats) Merge(other *ParseStats) {
+	if other == nil {
+		return
+	}
+	s.TotalLines += other.TotalLines
+	s.SkippedLines = append(s.SkippedLines, other.SkippedLines...)
+}
+
+// ErrorRatio returns the ratio of skipped lines to total lines.
+func (s *ParseStats) ErrorRatio() float64 {
+	if s == nil || s.TotalLines == 0 {
+		return 0
+	}
+	return float64(len(s.SkippedLines)) / float64(s.TotalLines)
+}
+
 func ParseCloudFrontLog(ctx context.Context, r io.Reader) ([]CELVariablesLog, error) {
-	scanner := bufio.NewScanner(r)
-	var fields []string
-	logs := make([]CELVariablesLog, 0)
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			part := strings.SplitN(line[1:], ":", 2)
-			if len(part) != 2 {
-				slog.DebugContext(ctx, "invalid header line", "line", line)
+	logs, _, err := ParseCloudFrontLogWithConfig(ctx, r, ParseConfig{})
+	return logs, err
+}
+
+func ParseCloudFrontLogWithConfig(ctx context.Context, r io.Reader, cfg ParseConfig) ([]CELVariablesLog, *ParseStats, error) {
+	return ParseLog(ctx, CloudFrontStandardLogParser{}, r, cfg)
+}
+
+// CloudFrontStandardLogParser is the LogParser of CloudFront standard logs, the W3C format with `#Fields` header.
+type CloudFrontStandardLogParser struct{}
+
+func (CloudFrontStandardLogParser) Name() string {
+	return LogFormatCloudFrontStandard
+}
+
+func (CloudFrontStandardLogParser) Detect(objectKey string, head []byte) bool {
+	return bytes.HasPrefix(head, []byte("#Version:"))
+}
+
+func (CloudFrontStandardLogParser) Parse(ctx context.Context, r io.Reader, _ ParseConfig) iter.Seq2[CELVariablesLog, error] {
+	return func(yield func(CELVariablesLog, error) bool) {
+		scanner := bufio.NewScanner(r)
+		var fields []string
+		lineCount := 0
+		for scanner.Scan() {
+			lineCount++
+			line := scanner.Text()
+			if strings.HasPrefix(line, "#") {
+				part := strings.SplitN(line[1:], ":", 2)
+				if len(part) != 2 {
+					slog.DebugContext(ctx, "invalid header line", "line", line)
+					continue
+				}
+				key := strings.TrimSpace(part[0])
+				value := strings.TrimSpace(part[1])
+				switch key {
+				case "Version":
+					slog.DebugContext(ctx, "cloud front log version", "value", value)
+				case "Fields":
+					fields = strings.Split(value, " ")
+					slog.DebugContext(ctx, "cloud front log fields", "fields_count", len(fields))
+				}
+				continue
+			}
+			l, lineErr := parseCloudFrontLogLine(ctx, fields, line, lineCount)
+			if lineErr != nil {
+				if !yield(l, lineErr) {
+					return
+				}
 				continue
 			}
-			key := strings.TrimSpace(part[0])
-			value := strings.TrimSpace(part[1])
-			switch key {
-			case "Version":
-				slog.DebugContext(ctx, "cloud front log version", "value", value)
-			case "Fields":
-				fields = strings.Split(value, " ")
-				slog.DebugContext(ctx, "cloud front log fields", "fields_count", len(fields))
+			if !yield(l, nil) {
+				return
 			}
-			continue
 		}
-		values := strings.Split(line, "\t")
-		if len(values) > len(fields) {
-			return nil, oops.Errorf("this row has more values then fields, num of values = %d, num of feilds = %d", len(values), len(fields))
+		if err := scanner.Err(); err != nil {
+			yield(CELVariablesLog{}, oops.Wrapf(err, "failed to scan log"))
+		}
+	}
+}
+
+func (CloudFrontStandardLogParser) Schema() []CELField {
+	var l CELVariablesLog
+	var fields []string
+	for name := range l.CloudFrontStandardLogFieldSetters() {
+		fields = append(fields, name)
+	}
+	slices.Sort(fields)
+	return NewLogSchema(cloudFrontLogCELFields, fields)
+}
+
+// cloudFrontLogCELFields are the `log` fields populated from the CloudFront log fields, with the derived ones.
+var cloudFrontLogCELFields = []string{
+	"type", "date", "time", "timestamp", "xEdgeLocation", "scBytes", "clientIp", "csMethod", "csHost", "csUriStem",
+	"scStatus", "scStatusCategory", "csReferer", "csUserAgent", "csUriQuery", "csCookie", "xEdgeResultType", "xEdgeRequestId",
+	"xHostHeader", "csProtocol", "csBytes", "timeTaken", "xForwardedFor", "sslProtocol", "sslCipher", "edgeResponseResultType",
+	"csProtocolVersion", "fleStatus", "fleEncryptedFields", "cPort", "timeToFirstByte", "xEdgeDetailedResultType",
+	"scContentType", "scContentLen", "scRangeStart", "scRangeEnd", "route", "query", "cookies", "fields",
+}
+
+func parseCloudFrontLogLine(ctx context.Context, fields []string, line string, lineCount int) (CELVariablesLog, *ParseLineError) {
+	values := strings.Split(line, "\t")
+	l := CELVariablesLog{
+		Type: "CloudFront Standard Log",
+	}
+	if len(values) > len(fields) {
+		return l, &ParseLineError{
+			Line:   lineCount,
+			Reason: ParseErrorReasonTooManyValues,
+			Err:    fmt.Errorf("this row has more values then fields, num of values = %d, num of feilds = %d", len(values), len(fields)),
 		}
-		l := CELVariablesLog{
-			Type: "CloudFront Standard Log",
+	}
+	l.Fields = make(map[string]string, len(values))
+	setters := l.CloudFrontStandardLogFieldSetters()
+	for i, value := range values {
+		if value != "-" {
+			l.Fields[fields[i]] = value
 		}
-		setters := l.CloudFrontStandardLogFieldSetters()
-		for i, value := range values {
-			if i >= len(fields) {
-				continue
-			}
-			if setter, ok := setters[fields[i]]; ok {
-				err := setter(value)
-				if err != nil {
-					return nil, oops.Wrapf(err, "failed to set field value[line=%d, field=%q]", lineCount, fields[i])
+		if setter, ok := setters[fields[i]]; ok {
+			if err := setter(value); err != nil {
+				return l, &ParseLineError{
+					Line:   lineCount,
+					Field:  fields[i],
+					Reason: ParseErrorReasonInvalidValue,
+					Err:    fmt.Errorf("failed to set field value: %w", err),
 				}
-				continue
 			}
-			slog.WarnContext(ctx, "unknown field detected", "field", fields[i], "line", lineCount)
+			continue
 		}
-		logs = append(logs, l)
+		slog.DebugContext(ctx, "unknown field detected", "field", fields[i], "line", lineCount)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, oops.Wrapf(err, "failed to scan log")
+	return l, nil
+}
+
+// ParseQueryString parses cs-uri-query value into a map. malformed pairs are ignored.
+func ParseQueryString(s string) map[string][]string {
+	if s == "" || s == "-" {
+		return map[string][]string{}
+	}
+	// ParseQuery returns the pairs parsed successfully even if some pairs are malformed.
+	values, _ := url.ParseQuery(s)
+	return values
+}
+
+// ParseCookies parses cs(Cookie) value into a map. if the same name appears multiple times, the first one wins.
+func ParseCookies(s string) map[string]string {
+	cookies := make(map[string]string)
+	if s == "" || s == "-" {
+		return cookies
+	}
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		s = unescaped
+	}
+	for _, part := range strings.Split(s, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := cookies[name]; ok {
+			continue
+		}
+		cookies[name] = strings.TrimSpace(value)
 	}
-	return logs, nil
+	return cookies
 }
@@ -259,6 +259,132 @@ func TestParseCloudFrontLog(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, logs, 6)
 	for i, expectedLog := range expectedLogs {
+		require.Len(t, logs[i].Fields, 33-countNullValues(logs[i]), "index: %d", i)
+		logs[i].Fields = nil
 		require.EqualValues(t, expectedLog, logs[i], "index: %d", i)
 	}
 }
+
+func countNullValues(l cflog2otel.CELVariablesLog) int {
+	var n int
+	for _, v := range []bool{
+		l.CsReferer == nil, l.CsURIQuery == nil, l.CsCookie == nil, l.XForwardedFor == nil,
+		l.SslProtocol == nil, l.SslCipher == nil, l.FleStatus == nil, l.FleEncryptedFields == nil,
+		l.ScRangeStart == nil, l.ScRangeEnd == nil,
+	} {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+func TestParseCloudFrontLog__Fields(t *testing.T) {
+	bs, err := os.ReadFile("testdata/cf_log_extra_fields.txt")
+	require.NoError(t, err)
+	logs, err := cflog2otel.ParseCloudFrontLog(context.Background(), strings.NewReader(string(bs)))
+	require.NoError(t, err)
+	require.Len(t, logs, 6)
+	require.Equal(t, "LAX1", logs[0].Fields["x-edge-location"])
+	require.Equal(t, "Mozilla/5.0%20(Windows%20NT%2010.0;%20Win64;%20x64)%20AppleWebKit/537.36%20(KHTML,%20like%20Gecko)%20Chrome/78.0.3904.108%20Safari/537.36", logs[0].Fields["cs(User-Agent)"])
+	require.Equal(t, "0.012", logs[0].Fields["origin-fbl"])
+	require.Equal(t, "0.034", logs[0].Fields["origin-lbl"])
+	require.Equal(t, "16509", logs[0].Fields["asn"])
+	require.NotContains(t, logs[0].Fields, "cs(Referer)")
+	require.NotContains(t, logs[1].Fields, "origin-fbl")
+	require.Equal(t, "16509", logs[1].Fields["asn"])
+}
+
+func TestParseQueryString(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  map[string][]string
+	}{
+		{name: "empty", query: "-", want: map[string][]string{}},
+		{name: "single", query: "utm_source=newsletter", want: map[string][]string{"utm_source": {"newsletter"}}},
+		{name: "multiple values", query: "tag=a&tag=b&q=hello%20world", want: map[string][]string{"tag": {"a", "b"}, "q": {"hello world"}}},
+		{name: "malformed pair ignored", query: "a=1&b=%zz&c=3", want: map[string][]string{"a": {"1"}, "c": {"3"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, cflog2otel.ParseQueryString(tc.query))
+		})
+	}
+}
+
+func TestParseCookies(t *testing.T) {
+	cases := []struct {
+		name   string
+		cookie string
+		want   map[string]string
+	}{
+		{name: "empty", cookie: "-", want: map[string]string{}},
+		{name: "escaped", cookie: "session=abc;%20ab_test=B", want: map[string]string{"session": "abc", "ab_test": "B"}},
+		{name: "first one wins", cookie: "a=1; a=2; b", want: map[string]string{"a": "1", "b": ""}},
+		{name: "keep plus sign", cookie: "token=ab+c=", want: map[string]string{"token": "ab+c="}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, cflog2otel.ParseCookies(tc.cookie))
+		})
+	}
+}
+
+func TestParseCloudFrontLogWithConfig(t *testing.T) {
+	bs, err := os.ReadFile("testdata/cf_log_malformed.txt")
+	require.NoError(t, err)
+	tests := []struct {
+		name           string
+		cfg            cflog2otel.ParseConfig
+		wantErr        string
+		wantLogs       int
+		wantSkipped    []int
+		wantReasons    []string
+		wantTotalLines int
+	}{
+		{
+			name:    "fail",
+			cfg:     cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicyFail},
+			wantErr: `line 4: field "sc-bytes": invalid_value`,
+		},
+		{
+			name:           "skip",
+			cfg:            cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicySkip},
+			wantLogs:       4,
+			wantSkipped:    []int{4, 6},
+			wantReasons:    []string{cflog2otel.ParseErrorReasonInvalidValue, cflog2otel.ParseErrorReasonTooManyValues},
+			wantTotalLines: 6,
+		},
+		{
+			name:           "skip_and_count within ratio",
+			cfg:            cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicySkipAndCount, MaxErrorRatio: ptr(0.5)},
+			wantLogs:       4,
+			wantSkipped:    []int{4, 6},
+			wantReasons:    []string{cflog2otel.ParseErrorReasonInvalidValue, cflog2otel.ParseErrorReasonTooManyValues},
+			wantTotalLines: 6,
+		},
+		{
+			name:    "skip exceeds max error ratio",
+			cfg:     cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicySkip, MaxErrorRatio: ptr(0.1)},
+			wantErr: "too many malformed lines: 2 of 6 lines skipped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, stats, err := cflog2otel.ParseCloudFrontLogWithConfig(context.Background(), strings.NewReader(string(bs)), tt.cfg)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, logs, tt.wantLogs)
+			require.Equal(t, tt.wantTotalLines, stats.TotalLines)
+			require.Len(t, stats.SkippedLines, len(tt.wantSkipped))
+			for i, lineErr := range stats.SkippedLines {
+				require.Equal(t, tt.wantSkipped[i], lineErr.Line)
+				require.Equal(t, tt.wantReasons[i], lineErr.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/samber/oops"
+)
+
+// runExplain prints how the log line is aggregated: filter results, attributes, values, matched switch branches and intervals.
+func runExplain(ctx context.Context, configPath string, args []string, jsonnetOpts []cflog2otel.JsonnetOption, w io.Writer) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	var input cflog2otel.ExplainInput
+	fs.StringVar(&configPath, "config", configPath, "config file path, s3://bucket/key or ssm://parameter-name")
+	fs.StringVar(&input.LogPath, "file", "", "CloudFront standard log file, gzipped or not (required)")
+	fs.IntVar(&input.Line, "line", 0, "line number in the file, including header lines (required)")
+	fs.StringVar(&input.Bucket, "bucket", "example-bucket", "bucket name of the notification")
+	fs.StringVar(&input.ObjectKey, "object-key", "", "object key of the notification (default: base name of the log file)")
+	if err := fs.Parse(args); err != nil {
+		return oops.Wrapf(err, "failed to parse explain flags")
+	}
+	if input.LogPath == "" || input.Line <= 0 {
+		return oops.Errorf("-file and -line are required")
+	}
+	app, err := newLocalApp(ctx, configPath, jsonnetOpts)
+	if err != nil {
+		return err
+	}
+	trace, err := app.Explain(ctx, input)
+	if err != nil {
+		return oops.Wrapf(err, "failed to explain line %d", input.Line)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(trace); err != nil {
+		return oops.Wrapf(err, "failed to encode trace")
+	}
+	return nil
+}
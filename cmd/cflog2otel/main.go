@@ -39,20 +39,55 @@ func _main(ctx context.Context) error {
 		renderConfig       bool
 		localExporter      bool
 		s3URL              string
+		extStrs            flagx.StringSlice
+		tlaStrs            flagx.StringSlice
+		jpath              flagx.StringSlice
+		refreshInterval    time.Duration
 	)
 	flag.StringVar(&logLevel, "log-level", "info", "log level ($LOG_LEVEL)")
 	flag.BoolVar(&logPrettify, "log-prettify", false, "log prettify ($LOG_PRETTIFY)")
-	flag.StringVar(&configPath, "config", "cflog2otel.jsonnet", "config file path ($CONFIG)")
+	flag.StringVar(&configPath, "config", "cflog2otel.jsonnet", "config file path, s3://bucket/key or ssm://parameter-name ($CONFIG)")
+	flag.DurationVar(&refreshInterval, "config-refresh-interval", cflog2otel.DefaultConfigRefreshInterval, "minimum interval to check config changes on warm invocations ($CONFIG_REFRESH_INTERVAL)")
 	flag.BoolVar(&configValidateOnly, "config-validate-only", false, "validate config only ($CONFIG_VALIDATE_ONLY)")
 	flag.BoolVar(&renderConfig, "render-config", false, "render config only ($RENDER_CONFIG)")
 	flag.StringVar(&s3URL, "s3-url", "", "s3 notification url ($S3_URL)")
 	flag.BoolVar(&localExporter, "local-collector", false, "use with test collector, export to stdout ($LOCAL_COLLECTOR)")
+	flag.Var(&extStrs, "ext-str", "jsonnet external variable, key=value or key to read from environment variable (repeatable) ($EXT_STR)")
+	flag.Var(&tlaStrs, "tla-str", "jsonnet top-level argument, key=value or key to read from environment variable (repeatable) ($TLA_STR)")
+	flag.Var(&jpath, "jpath", "jsonnet library search path (repeatable) ($JPATH)")
 	flag.VisitAll(flagx.EnvToFlag)
 	flag.Parse()
 
 	setupLogger(logLevel, logPrettify)
-	cfg := cflog2otel.DefaultConfig()
-	if err := cfg.Load(configPath, cflog2otel.WithContext(ctx)); err != nil {
+	if flag.Arg(0) == "schema" {
+		return runSchema(flag.Args()[1:], os.Stdout)
+	}
+	jsonnetOpts := []cflog2otel.JsonnetOption{
+		cflog2otel.WithContext(ctx),
+		cflog2otel.WithJPath(jpath...),
+	}
+	for _, s := range extStrs {
+		key, value := parseJsonnetVar(s)
+		jsonnetOpts = append(jsonnetOpts, cflog2otel.WithExtStr(key, value))
+	}
+	for _, s := range tlaStrs {
+		key, value := parseJsonnetVar(s)
+		jsonnetOpts = append(jsonnetOpts, cflog2otel.WithTLAStr(key, value))
+	}
+	switch flag.Arg(0) {
+	case "test":
+		return runTest(ctx, configPath, flag.Args()[1:], jsonnetOpts, os.Stdout)
+	case "explain":
+		return runExplain(ctx, configPath, flag.Args()[1:], jsonnetOpts, os.Stdout)
+	case "replay":
+		return runReplay(ctx, configPath, flag.Args()[1:], jsonnetOpts)
+	}
+	loader := cflog2otel.NewConfigLoader(configPath,
+		cflog2otel.WithConfigJsonnetOptions(jsonnetOpts...),
+		cflog2otel.WithConfigRefreshInterval(refreshInterval),
+	)
+	cfg, err := loader.Load(ctx)
+	if err != nil {
 		return oops.Wrapf(err, "failed to load config")
 	}
 	if configValidateOnly {
@@ -66,23 +101,29 @@ func _main(ctx context.Context) error {
 		}
 		return nil
 	}
+	var collectorURL string
 	if localExporter {
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "  ")
 		collector := otlptest.NewMetricsCollector(otlptest.NewExporterWithWriter(os.Stdout))
-		cfg.Otel = cflog2otel.OtelConfig{
-			Endpoint: collector.URL,
-			GZip:     true,
-		}
-		if err := cfg.Otel.Validate(); err != nil {
-			return oops.Wrapf(err, "failed to validate otel config")
-		}
+		collectorURL = collector.URL
 		slog.Info("start local collector", "url", collector.URL)
 	}
-	app, err := cflog2otel.New(ctx, cfg)
+	build := func(ctx context.Context, cfg *cflog2otel.Config) (*cflog2otel.App, error) {
+		if collectorURL != "" {
+			cfg.Otel = cflog2otel.OtelConfig{
+				Endpoint: collectorURL,
+				GZip:     true,
+			}
+			if err := cfg.Otel.Validate(); err != nil {
+				return nil, oops.Wrapf(err, "failed to validate otel config")
+			}
+		}
+		return cflog2otel.New(ctx, cfg)
+	}
+	app, err := build(ctx, cfg)
 	if err != nil {
 		return oops.Wrapf(err, "failed to create app")
 	}
+	reloader := cflog2otel.NewReloader(loader, app, build)
 	if s3URL != "" {
 		u, err := url.Parse(s3URL)
 		if err != nil {
@@ -97,7 +138,15 @@ func _main(ctx context.Context) error {
 		}
 		lamblocal.CLISrc = strings.NewReader(dummyEvent)
 	}
-	return lamblocal.RunWithError(ctx, app.Invoke)
+	return lamblocal.RunWithError(ctx, reloader.Invoke)
+}
+
+// parseJsonnetVar parses `key=value`. if `=` is omitted, the value is read from the environment variable of the key, like jsonnet command.
+func parseJsonnetVar(s string) (string, string) {
+	if key, value, ok := strings.Cut(s, "="); ok {
+		return key, value
+	}
+	return s, os.Getenv(s)
 }
 
 func setupLogger(logLevel string, logPrettify bool) {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/samber/oops"
+)
+
+// runReplay aggregates and exports the logs in the range of hours, see App.Replay.
+func runReplay(ctx context.Context, configPath string, args []string, jsonnetOpts []cflog2otel.JsonnetOption) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var (
+		input    cflog2otel.ReplayInput
+		from, to string
+	)
+	fs.StringVar(&configPath, "config", configPath, "config file path, s3://bucket/key or ssm://parameter-name")
+	fs.StringVar(&input.Bucket, "bucket", "", "bucket name of the logs (required)")
+	fs.StringVar(&input.Prefix, "prefix", "", "prefix of the object keys before the distribution id")
+	fs.StringVar(&input.DistributionID, "distribution", "", "distribution id (required)")
+	fs.StringVar(&from, "from", "", "start hour in UTC, inclusive, e.g. 2006-01-02T15 (required)")
+	fs.StringVar(&to, "to", "", "end hour in UTC, exclusive, e.g. 2006-01-02T15 (required)")
+	fs.IntVar(&input.Concurrency, "concurrency", cflog2otel.DefaultReplayConcurrency, "number of hours replayed concurrently")
+	fs.StringVar(&input.CheckpointPath, "checkpoint", "", "checkpoint file to resume the replay")
+	if err := fs.Parse(args); err != nil {
+		return oops.Wrapf(err, "failed to parse replay flags")
+	}
+	var err error
+	if input.From, err = parseHour(from); err != nil {
+		return oops.Wrapf(err, "invalid -from")
+	}
+	if input.To, err = parseHour(to); err != nil {
+		return oops.Wrapf(err, "invalid -to")
+	}
+	app, err := newLocalApp(ctx, configPath, jsonnetOpts)
+	if err != nil {
+		return err
+	}
+	return app.Replay(ctx, input)
+}
+
+// parseHour parses the time in UTC, `2006-01-02T15`, `2006-01-02` or RFC3339.
+func parseHour(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, oops.Errorf("required")
+	}
+	for _, layout := range []string{"2006-01-02T15", "2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, oops.Errorf("%q is not 2006-01-02T15, 2006-01-02 or RFC3339", s)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/samber/oops"
+)
+
+// runSchema prints the JSON Schema of the rendered config, or the fields of CEL variables with `-cel-fields`.
+// with `-format`, the `log` fields populated by the parser of the format are printed.
+func runSchema(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	var celFields bool
+	fs.BoolVar(&celFields, "cel-fields", false, "print the fields of CEL variables with types instead of JSON Schema")
+	var format string
+	fs.StringVar(&format, "format", "", "print the `log` fields populated by the parser of the log format, e.g. alb")
+	if err := fs.Parse(args); err != nil {
+		return oops.Wrapf(err, "failed to parse schema flags")
+	}
+	var v any = cflog2otel.ConfigJSONSchema()
+	if celFields {
+		v = cflog2otel.CELFields()
+	}
+	if format != "" {
+		p, ok := cflog2otel.LookupLogParser(format)
+		if !ok {
+			return oops.Errorf("unknown log format %q", format)
+		}
+		v = p.Schema()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return oops.Wrapf(err, "failed to encode schema")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/samber/oops"
+)
+
+// runTest aggregates the sample log with the config, and reports the diff from the expected OTLP JSON and the failed assertions.
+func runTest(ctx context.Context, configPath string, args []string, jsonnetOpts []cflog2otel.JsonnetOption, w io.Writer) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var (
+		tc             cflog2otel.ConfigTestCase
+		assertionsPath string
+	)
+	fs.StringVar(&configPath, "config", configPath, "config file path, s3://bucket/key or ssm://parameter-name")
+	fs.StringVar(&tc.LogPath, "log", "", "sample CloudFront standard log file (required)")
+	fs.StringVar(&tc.ExpectedPath, "expected", "", "expected file of export requests in the OTLP JSON encoding, one object per request (not the --local-collector format)")
+	fs.StringVar(&assertionsPath, "assertions", "", "jsonnet or json file of assertions")
+	fs.StringVar(&tc.Bucket, "bucket", "example-bucket", "bucket name of the notification")
+	fs.StringVar(&tc.ObjectKey, "object-key", "", "object key of the notification (default: base name of the log file)")
+	fs.BoolVar(&tc.Update, "update", false, "rewrite the expected OTLP JSON with the actual output")
+	if err := fs.Parse(args); err != nil {
+		return oops.Wrapf(err, "failed to parse test flags")
+	}
+	if tc.LogPath == "" {
+		return oops.Errorf("-log is required")
+	}
+	if tc.ExpectedPath == "" && assertionsPath == "" {
+		return oops.Errorf("-expected or -assertions is required")
+	}
+	if assertionsPath != "" {
+		assertions, err := cflog2otel.LoadConfigTestAssertions(assertionsPath, jsonnetOpts...)
+		if err != nil {
+			return oops.Wrapf(err, "failed to load assertions")
+		}
+		tc.Assertions = assertions
+	}
+	app, err := newLocalApp(ctx, configPath, jsonnetOpts)
+	if err != nil {
+		return err
+	}
+	result, err := app.RunConfigTest(ctx, tc)
+	if err != nil {
+		return oops.Wrapf(err, "failed to run test")
+	}
+	if result.Updated {
+		fmt.Fprintf(w, "updated %s\n", tc.ExpectedPath)
+	}
+	if result.Diff != "" {
+		fmt.Fprint(w, result.Diff)
+	}
+	for _, failure := range result.Failures {
+		fmt.Fprintf(w, "FAIL: %s\n", failure)
+	}
+	if !result.Passed() {
+		return oops.Errorf("test failed")
+	}
+	fmt.Fprintln(w, "PASS")
+	return nil
+}
+
+// newLocalApp loads the config and creates the app to aggregate local log files.
+func newLocalApp(ctx context.Context, configPath string, jsonnetOpts []cflog2otel.JsonnetOption) (*cflog2otel.App, error) {
+	loader := cflog2otel.NewConfigLoader(configPath, cflog2otel.WithConfigJsonnetOptions(jsonnetOpts...))
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to load config")
+	}
+	app, err := cflog2otel.New(ctx, cfg)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to create app")
+	}
+	return app, nil
+}
@@ -0,0 +1,87 @@
+package cflog2otel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is the default number of notifications and backfill objects processed concurrently.
+const DefaultConcurrency = 4
+
+// maxDeadlineMargin is the maximum time left before the deadline of the context, e.g. Lambda timeout,
+// to stop processing and return the error instead of being killed.
+const maxDeadlineMargin = 3 * time.Second
+
+// deadlineMargin returns the margin for the remaining time, a tenth of it up to maxDeadlineMargin,
+// so that the margin never consumes the whole budget of short timeouts, e.g. the default 3s of Lambda.
+func deadlineMargin(remaining time.Duration) time.Duration {
+	return max(min(maxDeadlineMargin, remaining/10), 0)
+}
+
+// withDeadlineMargin returns the context canceled the margin before the deadline of ctx.
+func withDeadlineMargin(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-deadlineMargin(time.Until(deadline))))
+}
+
+// parallelMap calls fn for each item with at most concurrency goroutines, and returns the results in the order of items.
+// if fn returns an error, the remaining items are canceled and the first error is returned.
+func parallelMap[T, R any](ctx context.Context, concurrency int, items []T, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+	if concurrency <= 1 {
+		for i, item := range items {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			r, err := fn(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = r
+		}
+		return results, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r, err := fn(ctx, item)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -6,40 +6,119 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/url"
 	"os"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/google/cel-go/cel"
 	"github.com/samber/oops"
 )
 
 type Config struct {
-	Otel               OtelConfig        `json:"otel,omitempty"`
-	ResourceAttributes []AttributeConfig `json:"resource_attributes,omitempty"`
-	Scope              ScopeConfig       `json:"scope,omitempty"`
-	Metrics            []MetricsConfig   `json:"metrics,omitempty"`
-	Backfill           BackfillConfig    `json:"backfill,omitempty"`
-	NoSkip             bool              `json:"no_skip,omitempty"`
+	Otel               OtelConfig                   `json:"otel,omitempty"`
+	ResourceAttributes []AttributeConfig            `json:"resource_attributes,omitempty"`
+	Scope              ScopeConfig                  `json:"scope,omitempty"`
+	Metrics            []MetricsConfig              `json:"metrics,omitempty"`
+	Backfill           BackfillConfig               `json:"backfill,omitempty"`
+	Parse              ParseConfig                  `json:"parse,omitempty"`
+	Enrichment         EnrichmentConfig             `json:"enrichment,omitempty"`
+	CEL                CELConfig                    `json:"cel,omitempty"`
+	Routes             []string                     `json:"routes,omitempty"`
+	Definitions        map[string]*CELCapable[any]  `json:"definitions,omitempty"`
+	AttributeSets      map[string][]AttributeConfig `json:"attribute_sets,omitempty"`
+	NoSkip             bool                         `json:"no_skip,omitempty"`
+	Concurrency        int                          `json:"concurrency,omitempty"`
+	router             *Router
+	definitions        *CELDefinitions
+	logRefs            CELLogReferences
+	s3Refs             CELS3References
+	celEnv             *CELEnv
+	deferCELBinding    bool
 }
 
 type OtelConfig struct {
-	Headers  map[string]string `json:"headers,omitempty"`
-	Endpoint string            `json:"endpoint,omitempty"`
-	GZip     bool              `json:"gzip,omitempty"`
-	endpoint *url.URL          `json:"-"`
+	Headers          map[string]string    `json:"headers,omitempty"`
+	Endpoint         string               `json:"endpoint,omitempty"`
+	GZip             bool                 `json:"gzip,omitempty"`
+	OnPartialSuccess PartialSuccessPolicy `json:"on_partial_success,omitempty"`
+	Retry            *OtelRetryConfig     `json:"retry,omitempty"`
+	endpoint         *url.URL             `json:"-"`
+}
+
+// OtelRetryConfig is the retry of the export for the retryable errors, e.g. UNAVAILABLE.
+// if not set, the default of the exporter is used.
+type OtelRetryConfig struct {
+	Enabled         *bool  `json:"enabled,omitempty"`
+	InitialInterval string `json:"initial_interval,omitempty"`
+	MaxInterval     string `json:"max_interval,omitempty"`
+	MaxElapsedTime  string `json:"max_elapsed_time,omitempty"`
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	maxElapsedTime  time.Duration
 }
 
 type BackfillConfig struct {
-	Enabled       bool   `json:"enabled,omitempty"`
-	TimeTolerance string `json:"time_tolerance,omitempty"`
+	Enabled       bool         `json:"enabled,omitempty"`
+	Mode          BackfillMode `json:"mode,omitempty"`
+	TimeTolerance string       `json:"time_tolerance,omitempty"`
 	timeTolerance time.Duration
 }
 
+type ParseConfig struct {
+	OnError       ParseErrorPolicy `json:"on_error,omitempty"`
+	MaxErrorRatio *float64         `json:"max_error_ratio,omitempty"`
+	// Format is the name of the registered LogParser, or `auto` to detect per object. default is `cloudfront_standard`.
+	Format string `json:"format,omitempty"`
+	// RealtimeFields are the fields of CloudFront real-time logs in the order of the real-time log config.
+	RealtimeFields []string `json:"realtime_fields,omitempty"`
+}
+
+// CELConfig limits the evaluation of CEL expressions.
+type CELConfig struct {
+	CostLimit               *uint64 `json:"cost_limit,omitempty"`
+	InterruptCheckFrequency *uint   `json:"interrupt_check_frequency,omitempty"`
+	EvalTimeout             string  `json:"eval_timeout,omitempty"`
+	evalTimeout             time.Duration
+}
+
+type EnrichmentConfig struct {
+	GeoIP      *GeoIPConfig                `json:"geoip,omitempty"`
+	UserAgent  *UserAgentConfig            `json:"user_agent,omitempty"`
+	CloudFront *CloudFrontEnrichmentConfig `json:"cloudfront,omitempty"`
+}
+
+type GeoIPConfig struct {
+	Database    string `json:"database,omitempty"`
+	ASNDatabase string `json:"asn_database,omitempty"`
+}
+
+type UserAgentConfig struct {
+	Rules string `json:"rules,omitempty" jsonschema:"required"`
+}
+
+// CloudFrontEnrichmentConfig resolves metadata of distributions for `cloudfront` variable.
+type CloudFrontEnrichmentConfig struct {
+	// API enables lookup by GetDistribution and ListTagsForResource.
+	API      bool   `json:"api,omitempty"`
+	CacheTTL string `json:"cache_ttl,omitempty"`
+	// Distributions is the static metadata keyed by distribution ID, used when API is disabled or the lookup failed.
+	Distributions map[string]CloudFrontDistributionConfig `json:"distributions,omitempty"`
+	cacheTTL      time.Duration
+}
+
+type CloudFrontDistributionConfig struct {
+	Aliases    []string          `json:"aliases,omitempty"`
+	Comment    string            `json:"comment,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	PriceClass string            `json:"price_class,omitempty"`
+}
+
 type AttributeConfig struct {
-	Key   string           `json:"key,omitempty"`
-	Value *CELCapable[any] `json:"value,omitempty"`
+	Key   string           `json:"key,omitempty" jsonschema:"required"`
+	Value *CELCapable[any] `json:"value,omitempty" jsonschema:"required"`
 }
 
 type ScopeConfig struct {
@@ -49,12 +128,13 @@ type ScopeConfig struct {
 }
 
 type MetricsConfig struct {
-	Name              string               `json:"name,omitempty"`
+	Name              string               `json:"name,omitempty" jsonschema:"required"`
 	Description       string               `json:"description,omitempty"`
 	Interval          string               `json:"interval,omitempty"`
 	Unit              string               `json:"unit,omitempty"`
 	Type              AggregationType      `json:"type,omitempty"`
 	Attributes        []AttributeConfig    `json:"attributes,omitempty"`
+	AttributeSets     []string             `json:"attribute_sets,omitempty"`
 	Filter            *CELCapable[bool]    `json:"filter,omitempty"`
 	Value             *CELCapable[float64] `json:"value,omitempty"`
 	IsMonotonic       bool                 `json:"is_monotonic,omitempty"`
@@ -63,6 +143,7 @@ type MetricsConfig struct {
 	NoMinMax          bool                 `json:"no_min_max,omitempty"`
 	EmitZero          [][]any              `json:"emit_zero,omitempty"` // Now unused
 	aggregateInterval time.Duration        `json:"-"`
+	attributes        []AttributeConfig
 }
 
 func DefaultConfig() *Config {
@@ -78,19 +159,130 @@ func (c *Config) Load(path string, opts ...JsonnetOption) error {
 	if err != nil {
 		return oops.Errorf("failed to evaluate JSONnet file: %w", err)
 	}
-	dec := json.NewDecoder(strings.NewReader(jsonStr))
-	dec.DisallowUnknownFields()
-	err = dec.Decode(c)
-	if err != nil {
+	return c.decode(jsonStr)
+}
+
+// decode decodes the evaluated JSON and validates the config.
+func (c *Config) decode(jsonStr string) error {
+	// the fields including CEL capable fields are decoded one by one, to report the path of the error,
+	// because json.Decoder does not report the path of errors returned by UnmarshalJSON.
+	type Alias Config
+	aux := struct {
+		*Alias
+		ResourceAttributes []json.RawMessage            `json:"resource_attributes,omitempty"`
+		Metrics            []json.RawMessage            `json:"metrics,omitempty"`
+		Definitions        map[string]json.RawMessage   `json:"definitions,omitempty"`
+		AttributeSets      map[string][]json.RawMessage `json:"attribute_sets,omitempty"`
+	}{
+		Alias: (*Alias)(c),
+	}
+	if err := decodeConfigField([]byte(jsonStr), &aux, ""); err != nil {
+		return oops.Wrapf(err, "failed to unmarshal JSON")
+	}
+	if err := c.decodeCELFields(aux.ResourceAttributes, aux.Metrics, aux.Definitions, aux.AttributeSets); err != nil {
+		var celErr *CELExpressionError
+		if errors.As(err, &celErr) {
+			return oops.Wrap(err)
+		}
 		return oops.Wrapf(err, "failed to unmarshal JSON")
 	}
 	return c.Validate()
 }
 
+func (c *Config) decodeCELFields(resourceAttributes, metrics []json.RawMessage, definitions map[string]json.RawMessage, attributeSets map[string][]json.RawMessage) error {
+	var err error
+	if c.ResourceAttributes, err = decodeConfigSlice[AttributeConfig](resourceAttributes, "resource_attributes"); err != nil {
+		return err
+	}
+	if c.Metrics, err = decodeConfigSlice[MetricsConfig](metrics, "metrics"); err != nil {
+		return err
+	}
+	c.Definitions = nil
+	if definitions != nil {
+		c.Definitions = make(map[string]*CELCapable[any], len(definitions))
+		for _, name := range slices.Sorted(maps.Keys(definitions)) {
+			var expr *CELCapable[any]
+			if err := decodeConfigField(definitions[name], &expr, fmt.Sprintf("definitions[%q]", name)); err != nil {
+				return err
+			}
+			c.Definitions[name] = expr
+		}
+	}
+	c.AttributeSets = nil
+	if attributeSets != nil {
+		c.AttributeSets = make(map[string][]AttributeConfig, len(attributeSets))
+		for _, name := range slices.Sorted(maps.Keys(attributeSets)) {
+			attrs, err := decodeConfigSlice[AttributeConfig](attributeSets[name], fmt.Sprintf("attribute_sets[%q]", name))
+			if err != nil {
+				return err
+			}
+			c.AttributeSets[name] = attrs
+		}
+	}
+	return nil
+}
+
+// configPathError is the error of the field at the path, such as `metrics[0].filter`.
+type configPathError struct {
+	path string
+	err  error
+}
+
+func (e *configPathError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *configPathError) Unwrap() error {
+	return e.err
+}
+
+// withConfigPath prefixes the path to the error, joining the path of the nested field,
+// e.g. `metrics[0]` and `filter` are joined to `metrics[0].filter`.
+func withConfigPath(err error, path string) error {
+	if path == "" {
+		return err
+	}
+	pe, ok := err.(*configPathError)
+	if !ok {
+		return &configPathError{path: path, err: err}
+	}
+	if strings.HasPrefix(pe.path, "[") {
+		return &configPathError{path: path + pe.path, err: pe.err}
+	}
+	return &configPathError{path: path + "." + pe.path, err: pe.err}
+}
+
+// decodeConfigField decodes the field disallowing unknown fields, and prefixes the path to the error.
+func decodeConfigField(data []byte, v any, path string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return withConfigPath(err, path)
+	}
+	return nil
+}
+
+// decodeConfigSlice decodes the items one by one, and prefixes the path with the index to the error.
+func decodeConfigSlice[T any](raws []json.RawMessage, path string) ([]T, error) {
+	if raws == nil {
+		return nil, nil
+	}
+	items := make([]T, len(raws))
+	for i, raw := range raws {
+		if err := decodeConfigField(raw, &items[i], fmt.Sprintf("[%d]", i)); err != nil {
+			return nil, withConfigPath(err, path)
+		}
+	}
+	return items, nil
+}
+
 func (c *Config) Validate() error {
 	if err := c.Otel.Validate(); err != nil {
 		return oops.Wrapf(err, "otel")
 	}
+	if c.Concurrency < 0 {
+		return oops.Errorf("concurrency must be positive")
+	}
 	for i, a := range c.ResourceAttributes {
 		if err := a.Validate(); err != nil {
 			return oops.Wrapf(err, "resource_attributes[%d]", i)
@@ -100,18 +292,357 @@ func (c *Config) Validate() error {
 	if err := c.Backfill.Validate(); err != nil {
 		return oops.Wrapf(err, "backfill")
 	}
+	if err := c.Parse.Validate(); err != nil {
+		return oops.Wrapf(err, "parse")
+	}
+	if err := c.Enrichment.Validate(); err != nil {
+		return oops.Wrapf(err, "enrichment")
+	}
+	router, err := NewRouter(c.Routes)
+	if err != nil {
+		return err
+	}
+	c.router = router
+	if err := c.CEL.Validate(); err != nil {
+		return oops.Wrapf(err, "cel")
+	}
+	for name, attrs := range c.AttributeSets {
+		for i, a := range attrs {
+			if err := a.Validate(); err != nil {
+				return oops.Wrapf(err, "attribute_sets[%q][%d]", name, i)
+			}
+		}
+	}
 	if err := c.Scope.Validate(); err != nil {
 		return oops.Wrapf(err, "scope")
 	}
 	for i, m := range c.Metrics {
+		if err := m.resolveAttributeSets(c.AttributeSets); err != nil {
+			return oops.Wrapf(err, "metrics[%d]", i)
+		}
 		if err := m.Validate(); err != nil {
 			return oops.Wrapf(err, "metrics[%d]", i)
 		}
 		c.Metrics[i] = m
 	}
+	if c.Backfill.Enabled && c.Backfill.Mode == BackfillModeInterval {
+		// the intervals must be complete in the objects of an hour.
+		for i, m := range c.Metrics {
+			if time.Hour%m.AggregateInterval() != 0 {
+				return oops.Errorf("metrics[%d]: interval %s must divide 1h for backfill mode interval", i, m.Interval)
+			}
+		}
+	}
+	if err := c.bindCEL(); err != nil {
+		return err
+	}
+	c.logRefs = c.collectLogReferences()
+	c.s3Refs = c.collectS3References()
+	if err := c.checkGeoIPReferences(); err != nil {
+		return err
+	}
+	if err := c.checkLogSchema(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkGeoIPReferences checks `geo` is not referenced without `enrichment.geoip`, which would always return empty results.
+func (c *Config) checkGeoIPReferences() error {
+	if c.Enrichment.GeoIP != nil {
+		return nil
+	}
+	exprs := c.celExpressions()
+	paths := make([]string, 0, len(exprs))
+	for path, e := range exprs {
+		if e.expr.GeoIPReferenced() {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	slices.Sort(paths)
+	return oops.Errorf("%s: geo is referenced, but enrichment.geoip is not configured", paths[0])
+}
+
+// checkLogSchema checks the referenced log fields are populated by the parser of `parse.format`.
+func (c *Config) checkLogSchema() error {
+	parser, ok := c.Parse.Parser()
+	if !ok {
+		return nil
+	}
+	available := logSchemaFields(parser.Schema())
+	for _, field := range c.logRefs.Fields {
+		if !slices.Contains(available, field) {
+			return oops.Errorf("log.%s is not provided by parse.format %s", field, parser.Name())
+		}
+	}
+	if parser.Name() != LogFormatCloudFrontStandard && c.Backfill.Enabled {
+		return oops.Errorf("backfill is supported only for parse.format %s", LogFormatCloudFrontStandard)
+	}
+	return nil
+}
+
+// celExpression is a CEL capable field in the config.
+type celExpression interface {
+	LogReferences() CELLogReferences
+	S3References() CELS3References
+	GeoIPReferenced() bool
+	DefinitionReferences() []string
+	CheckType(env *cel.Env, want ...*cel.Type) error
+	EstimateCost() (CELCostEstimate, error)
+	bind(env *cel.Env, pc celProgramConfig) error
+	bindError() error
+}
+
+type celExpressionEntry struct {
+	expr celExpression
+	// want is the required output types. nil means the type parameter of CELCapable.
+	want []*cel.Type
+}
+
+// celExpressions returns all CEL capable fields in the config keyed by the field path.
+func (c *Config) celExpressions() map[string]celExpressionEntry {
+	exprs := make(map[string]celExpressionEntry)
+	addAttributes := func(prefix string, attrs []AttributeConfig) {
+		for i, a := range attrs {
+			if a.Value != nil {
+				exprs[fmt.Sprintf("%s[%d].value", prefix, i)] = celExpressionEntry{expr: a.Value, want: celScalarTypes}
+			}
+		}
+	}
+	addAttributes("resource_attributes", c.ResourceAttributes)
+	for name, attrs := range c.AttributeSets {
+		addAttributes(fmt.Sprintf("attribute_sets[%q]", name), attrs)
+	}
+	for name, expr := range c.Definitions {
+		if expr != nil {
+			exprs[fmt.Sprintf("definitions[%q]", name)] = celExpressionEntry{expr: expr}
+		}
+	}
+	for i, m := range c.Metrics {
+		addAttributes(fmt.Sprintf("metrics[%d].attributes", i), m.Attributes)
+		if m.Filter != nil {
+			exprs[fmt.Sprintf("metrics[%d].filter", i)] = celExpressionEntry{expr: m.Filter}
+		}
+		if m.Value != nil {
+			exprs[fmt.Sprintf("metrics[%d].value", i)] = celExpressionEntry{expr: m.Value}
+		}
+	}
+	return exprs
+}
+
+// checkTypes checks the output types which need the whole config,
+// such as expressions referencing definitions and attribute values.
+func (c *Config) checkTypes() error {
+	env := c.definitions.Env()
+	exprs := c.celExpressions()
+	paths := make([]string, 0, len(exprs))
+	for path := range exprs {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		e := exprs[path]
+		if e.expr.bindError() != nil {
+			// deferred until bound.
+			continue
+		}
+		refs := e.expr.DefinitionReferences()
+		for _, name := range refs {
+			if !c.definitions.Has(name) {
+				return oops.Errorf("%s: unknown definition %q", path, name)
+			}
+		}
+		if len(refs) == 0 && e.want == nil {
+			// already checked when bound.
+			continue
+		}
+		if err := e.expr.CheckType(env, e.want...); err != nil {
+			return oops.Wrapf(err, "%s", path)
+		}
+	}
 	return nil
 }
 
+// Router returns the router built from `routes`.
+func (c *Config) Router() *Router {
+	return c.router
+}
+
+// bindCEL compiles all CEL expressions with the environment and `cel` config, and checks them with the whole config.
+// if the config is not bound to an environment, the expressions are compiled with the default environment.
+// with DeferCELBinding, the expressions referencing undeclared functions or variables are deferred until bound by WithCELEnv,
+// and the others are checked.
+func (c *Config) bindCEL() error {
+	env := c.celEnv.Env()
+	pc := c.CEL.programConfig()
+	exprs := c.celExpressions()
+	paths := make([]string, 0, len(exprs))
+	for path := range exprs {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	var deferred []string
+	for _, path := range paths {
+		if err := exprs[path].expr.bind(env, pc); err != nil {
+			if c.celEnv == nil && c.deferCELBinding && isCELUndeclaredReference(err) {
+				deferred = append(deferred, path)
+				continue
+			}
+			return oops.Wrapf(err, "%s", path)
+		}
+	}
+	if len(deferred) > 0 {
+		slog.Debug("CEL expressions reference undeclared functions or variables, they are checked when bound to the environment", "paths", deferred)
+	}
+	definitions, err := newCELDefinitions(env, c.Definitions)
+	if err != nil {
+		return err
+	}
+	c.definitions = definitions
+	if err := c.checkTypes(); err != nil {
+		return err
+	}
+	costs, err := c.EstimateCELCosts()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		est, ok := costs[path]
+		if !ok {
+			continue
+		}
+		slog.Debug("estimated CEL cost", "path", path, "min", est.Min, "max", est.Max)
+		if pc.costLimit > 0 && est.Max > pc.costLimit {
+			slog.Warn("estimated worst-case CEL cost exceeds cost_limit, evaluation may fail", "path", path, "max", est.Max, "cost_limit", pc.costLimit)
+		}
+	}
+	return nil
+}
+
+// WithCELEnv returns a copy of the config bound to the environment.
+// CEL expressions are copied and compiled with the environment, so the original config is not changed.
+func (c *Config) WithCELEnv(env *CELEnv) (*Config, error) {
+	if env == nil {
+		env = DefaultCELEnv()
+	}
+	bound := *c
+	bound.celEnv = env
+	bound.ResourceAttributes = cloneAttributeConfigs(c.ResourceAttributes)
+	if c.AttributeSets != nil {
+		bound.AttributeSets = make(map[string][]AttributeConfig, len(c.AttributeSets))
+		for name, attrs := range c.AttributeSets {
+			bound.AttributeSets[name] = cloneAttributeConfigs(attrs)
+		}
+	}
+	if c.Definitions != nil {
+		bound.Definitions = make(map[string]*CELCapable[any], len(c.Definitions))
+		for name, expr := range c.Definitions {
+			bound.Definitions[name] = expr.clone()
+		}
+	}
+	bound.Metrics = make([]MetricsConfig, len(c.Metrics))
+	for i, m := range c.Metrics {
+		m.Attributes = cloneAttributeConfigs(m.Attributes)
+		m.Filter = m.Filter.clone()
+		m.Value = m.Value.clone()
+		if err := m.resolveAttributeSets(bound.AttributeSets); err != nil {
+			return nil, oops.Wrapf(err, "metrics[%d]", i)
+		}
+		bound.Metrics[i] = m
+	}
+	if err := bound.bindCEL(); err != nil {
+		return nil, err
+	}
+	bound.logRefs = bound.collectLogReferences()
+	bound.s3Refs = bound.collectS3References()
+	if err := bound.checkGeoIPReferences(); err != nil {
+		return nil, err
+	}
+	return &bound, nil
+}
+
+func cloneAttributeConfigs(attrs []AttributeConfig) []AttributeConfig {
+	if attrs == nil {
+		return nil
+	}
+	cloned := make([]AttributeConfig, len(attrs))
+	for i, a := range attrs {
+		cloned[i] = AttributeConfig{Key: a.Key, Value: a.Value.clone()}
+	}
+	return cloned
+}
+
+// DeferCELBinding makes Load accept CEL expressions referencing functions or variables not declared in the default environment,
+// such as the custom functions or variables of New. they are checked when bound by WithCELEnv.
+// the other errors are not deferred, and the other expressions are checked as usual.
+func (c *Config) DeferCELBinding() {
+	c.deferCELBinding = true
+}
+
+// CELEnv returns the environment which the config is bound to. nil means the config is not bound.
+func (c *Config) CELEnv() *CELEnv {
+	return c.celEnv
+}
+
+// EstimateCELCosts returns the estimated cost of each CEL expression keyed by the field path.
+func (c *Config) EstimateCELCosts() (map[string]CELCostEstimate, error) {
+	exprs := c.celExpressions()
+	costs := make(map[string]CELCostEstimate, len(exprs))
+	for path, e := range exprs {
+		if e.expr.bindError() != nil {
+			continue
+		}
+		est, err := e.expr.EstimateCost()
+		if err != nil {
+			return nil, oops.Wrapf(err, "%s", path)
+		}
+		costs[path] = est
+	}
+	return costs, nil
+}
+
+// CELDefinitions returns the definitions built from `definitions`.
+func (c *Config) CELDefinitions() *CELDefinitions {
+	return c.definitions
+}
+
+// LogReferences returns derived log fields referenced by any expression in the config.
+func (c *Config) LogReferences() CELLogReferences {
+	return c.logRefs
+}
+
+func (c *Config) collectLogReferences() CELLogReferences {
+	var refs CELLogReferences
+	for _, e := range c.celExpressions() {
+		refs = refs.Merge(e.expr.LogReferences())
+	}
+	return refs
+}
+
+// S3References returns S3 tags and metadata referenced by any expression in the config.
+func (c *Config) S3References() CELS3References {
+	return c.s3Refs
+}
+
+func (c *Config) collectS3References() CELS3References {
+	var refs CELS3References
+	for _, e := range c.celExpressions() {
+		refs = refs.Merge(e.expr.S3References())
+	}
+	return refs
+}
+
+// ConcurrencyValue returns the concurrency, DefaultConcurrency if not set.
+func (c *Config) ConcurrencyValue() int {
+	if c.Concurrency == 0 {
+		return DefaultConcurrency
+	}
+	return c.Concurrency
+}
+
 func (c *ScopeConfig) Validate() error {
 	return nil
 }
@@ -120,6 +651,32 @@ func (c *MetricsConfig) AggregateInterval() time.Duration {
 	return c.aggregateInterval
 }
 
+// ResolvedAttributes returns the attributes of `attribute_sets` followed by `attributes`.
+func (c *MetricsConfig) ResolvedAttributes() []AttributeConfig {
+	if c.attributes == nil {
+		return c.Attributes
+	}
+	return c.attributes
+}
+
+func (c *MetricsConfig) resolveAttributeSets(sets map[string][]AttributeConfig) error {
+	if len(c.AttributeSets) == 0 {
+		c.attributes = nil
+		return nil
+	}
+	attrs := make([]AttributeConfig, 0, len(c.Attributes))
+	for _, name := range c.AttributeSets {
+		set, ok := sets[name]
+		if !ok {
+			return oops.Errorf("unknown attribute set %q", name)
+		}
+		attrs = append(attrs, set...)
+	}
+	// attributes of the metric are appended last, so they take precedence over the same key in attribute sets.
+	c.attributes = append(attrs, c.Attributes...)
+	return nil
+}
+
 func (c *MetricsConfig) Validate() error {
 	if c.Name == "" {
 		return oops.Errorf("name is required")
@@ -186,6 +743,9 @@ func (c *MetricsConfig) UnmarshalJSON(data []byte) error {
 	type Alias MetricsConfig
 	aux := struct {
 		*Alias
+		Attributes []json.RawMessage `json:"attributes,omitempty"`
+		Filter     json.RawMessage   `json:"filter,omitempty"`
+		Value      json.RawMessage   `json:"value,omitempty"`
 	}{
 		Alias: (*Alias)(c),
 	}
@@ -198,6 +758,22 @@ func (c *MetricsConfig) UnmarshalJSON(data []byte) error {
 		}
 		return err
 	}
+	var err error
+	if c.Attributes, err = decodeConfigSlice[AttributeConfig](aux.Attributes, "attributes"); err != nil {
+		return err
+	}
+	c.Filter = nil
+	if aux.Filter != nil {
+		if err := decodeConfigField(aux.Filter, &c.Filter, "filter"); err != nil {
+			return err
+		}
+	}
+	c.Value = nil
+	if aux.Value != nil {
+		if err := decodeConfigField(aux.Value, &c.Value, "value"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -246,6 +822,7 @@ func (c *AttributeConfig) UnmarshalJSON(data []byte) error {
 	type Alias AttributeConfig
 	aux := struct {
 		*Alias
+		Value json.RawMessage `json:"value,omitempty"`
 	}{
 		Alias: (*Alias)(c),
 	}
@@ -257,6 +834,12 @@ func (c *AttributeConfig) UnmarshalJSON(data []byte) error {
 		}
 		return err
 	}
+	c.Value = nil
+	if aux.Value != nil {
+		if err := decodeConfigField(aux.Value, &c.Value, "value"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -304,6 +887,62 @@ func (c *OtelConfig) Validate() error {
 	if err := c.SetEndpointURL(c.Endpoint); err != nil {
 		return err
 	}
+	if !c.OnPartialSuccess.IsAPartialSuccessPolicy() {
+		return oops.Errorf("unsupported on_partial_success: %s", c.OnPartialSuccess)
+	}
+	if c.Retry != nil {
+		if err := c.Retry.Validate(); err != nil {
+			return oops.Wrapf(err, "retry")
+		}
+	}
+	return nil
+}
+
+func (c *OtelRetryConfig) UnmarshalJSON(data []byte) error {
+	type Alias OtelRetryConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *OtelRetryConfig) Validate() error {
+	if c.Enabled == nil {
+		enabled := true
+		c.Enabled = &enabled
+	}
+	for _, d := range []struct {
+		name  string
+		value *string
+		def   string
+		dest  *time.Duration
+	}{
+		{"initial_interval", &c.InitialInterval, "5s", &c.initialInterval},
+		{"max_interval", &c.MaxInterval, "30s", &c.maxInterval},
+		{"max_elapsed_time", &c.MaxElapsedTime, "1m", &c.maxElapsedTime},
+	} {
+		if *d.value == "" {
+			*d.value = d.def
+		}
+		v, err := time.ParseDuration(*d.value)
+		if err != nil {
+			return oops.Wrapf(err, "%s", d.name)
+		}
+		if v < 0 {
+			return oops.Errorf("%s must not be negative", d.name)
+		}
+		*d.dest = v
+	}
 	return nil
 }
 
@@ -326,6 +965,9 @@ func (c *BackfillConfig) UnmarshalJSON(data []byte) error {
 }
 
 func (c *BackfillConfig) Validate() error {
+	if !c.Mode.IsABackfillMode() {
+		return oops.Errorf("unsupported mode: %s", c.Mode)
+	}
 	if c.TimeTolerance == "" {
 		c.TimeTolerance = "1h"
 	}
@@ -340,3 +982,248 @@ func (c *BackfillConfig) Validate() error {
 func (c *BackfillConfig) TimeToleranceDuration() time.Duration {
 	return c.timeTolerance
 }
+
+func (c *CELConfig) UnmarshalJSON(data []byte) error {
+	type Alias CELConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *CELConfig) Validate() error {
+	if c.EvalTimeout != "" {
+		d, err := time.ParseDuration(c.EvalTimeout)
+		if err != nil {
+			return oops.Wrapf(err, "invalid eval_timeout")
+		}
+		if d <= 0 {
+			return oops.Errorf("eval_timeout must be positive")
+		}
+		c.evalTimeout = d
+	}
+	return nil
+}
+
+func (c *CELConfig) programConfig() celProgramConfig {
+	pc := defaultCELProgramConfig
+	if c.CostLimit != nil {
+		pc.costLimit = *c.CostLimit
+	}
+	if c.InterruptCheckFrequency != nil {
+		pc.interruptCheckFrequency = *c.InterruptCheckFrequency
+	}
+	pc.evalTimeout = c.evalTimeout
+	return pc
+}
+
+func (c *ParseConfig) UnmarshalJSON(data []byte) error {
+	type Alias ParseConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *ParseConfig) Validate() error {
+	if !c.OnError.IsAParseErrorPolicy() {
+		return oops.Errorf("unsupported on_error: %s", c.OnError)
+	}
+	if c.MaxErrorRatio != nil && (*c.MaxErrorRatio < 0 || *c.MaxErrorRatio > 1) {
+		return oops.Errorf("max_error_ratio must be between 0 and 1")
+	}
+	if c.Format == "" {
+		c.Format = LogFormatCloudFrontStandard
+	}
+	if _, ok := LookupLogParser(c.Format); !ok && c.Format != LogFormatAuto {
+		return oops.Errorf("unsupported format: %s", c.Format)
+	}
+	if c.Format == LogFormatCloudFrontRealtime && len(c.RealtimeFields) == 0 {
+		return oops.Errorf("realtime_fields is required for format %s", c.Format)
+	}
+	return nil
+}
+
+// Parser returns the LogParser of the format, false if the format is `auto`.
+func (c *ParseConfig) Parser() (LogParser, bool) {
+	format := c.Format
+	if format == "" {
+		format = LogFormatCloudFrontStandard
+	}
+	return LookupLogParser(format)
+}
+
+// MaxErrorRatioValue returns the maximum ratio of skipped lines per object.
+// If max_error_ratio is not set, there is no limit.
+func (c *ParseConfig) MaxErrorRatioValue() float64 {
+	if c.MaxErrorRatio == nil {
+		return 1
+	}
+	return *c.MaxErrorRatio
+}
+
+func (c *EnrichmentConfig) UnmarshalJSON(data []byte) error {
+	type Alias EnrichmentConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *EnrichmentConfig) Validate() error {
+	if c.GeoIP != nil {
+		if err := c.GeoIP.Validate(); err != nil {
+			return oops.Wrapf(err, "geoip")
+		}
+	}
+	if c.UserAgent != nil {
+		if err := c.UserAgent.Validate(); err != nil {
+			return oops.Wrapf(err, "user_agent")
+		}
+	}
+	if c.CloudFront != nil {
+		if err := c.CloudFront.Validate(); err != nil {
+			return oops.Wrapf(err, "cloudfront")
+		}
+	}
+	return nil
+}
+
+func (c *GeoIPConfig) UnmarshalJSON(data []byte) error {
+	type Alias GeoIPConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *GeoIPConfig) Validate() error {
+	if c.Database == "" && c.ASNDatabase == "" {
+		return oops.Errorf("database or asn_database is required")
+	}
+	return nil
+}
+
+func (c *UserAgentConfig) UnmarshalJSON(data []byte) error {
+	type Alias UserAgentConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *UserAgentConfig) Validate() error {
+	if c.Rules == "" {
+		return oops.Errorf("rules is required")
+	}
+	return nil
+}
+
+func (c *CloudFrontEnrichmentConfig) UnmarshalJSON(data []byte) error {
+	type Alias CloudFrontEnrichmentConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *CloudFrontEnrichmentConfig) Validate() error {
+	if !c.API && len(c.Distributions) == 0 {
+		return oops.Errorf("api or distributions is required")
+	}
+	c.cacheTTL = DefaultCloudFrontCacheTTL
+	if c.CacheTTL != "" {
+		d, err := time.ParseDuration(c.CacheTTL)
+		if err != nil {
+			return oops.Wrapf(err, "invalid cache_ttl")
+		}
+		if d <= 0 {
+			return oops.Errorf("cache_ttl must be positive")
+		}
+		c.cacheTTL = d
+	}
+	return nil
+}
+
+// CacheTTLDuration returns the duration to cache the metadata resolved by API.
+func (c *CloudFrontEnrichmentConfig) CacheTTLDuration() time.Duration {
+	return c.cacheTTL
+}
+
+func (c *CloudFrontDistributionConfig) UnmarshalJSON(data []byte) error {
+	type Alias CloudFrontDistributionConfig
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		if cannotUseErr, ok := IsCannotUseCELNativeFunction(err, data, []string{}); ok {
+			return oops.Wrap(cannotUseErr)
+		}
+		return err
+	}
+	return nil
+}
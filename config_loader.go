@@ -0,0 +1,347 @@
+package cflog2otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/samber/oops"
+)
+
+// DefaultConfigRefreshInterval is the default minimum interval to check whether the config is changed.
+const DefaultConfigRefreshInterval = time.Minute
+
+// ConfigS3APIClient is the S3 API used to load the config from S3.
+type ConfigS3APIClient interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// SSMAPIClient is the SSM API used to load the config from SSM parameter.
+type SSMAPIClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ConfigLoader loads the config from a local path, `s3://bucket/key` or `ssm://parameter-name`,
+// and detects changes by the modification time of the file, ETag of the object or version of the parameter.
+type ConfigLoader struct {
+	location        string
+	jsonnetOpts     []JsonnetOption
+	s3Client        ConfigS3APIClient
+	ssmClient       SSMAPIClient
+	refreshInterval time.Duration
+	deferCELBinding bool
+	mu              sync.Mutex
+	version         string
+	checkedAt       time.Time
+}
+
+type ConfigLoaderOption func(*ConfigLoader)
+
+// WithConfigJsonnetOptions sets the options to evaluate the config.
+func WithConfigJsonnetOptions(opts ...JsonnetOption) ConfigLoaderOption {
+	return func(l *ConfigLoader) {
+		l.jsonnetOpts = append(l.jsonnetOpts, opts...)
+	}
+}
+
+// WithConfigS3Client sets the S3 client to load the config. if not set, the client is created from the default AWS config.
+func WithConfigS3Client(client ConfigS3APIClient) ConfigLoaderOption {
+	return func(l *ConfigLoader) {
+		l.s3Client = client
+	}
+}
+
+// WithConfigSSMClient sets the SSM client to load the config. if not set, the client is created from the default AWS config.
+func WithConfigSSMClient(client SSMAPIClient) ConfigLoaderOption {
+	return func(l *ConfigLoader) {
+		l.ssmClient = client
+	}
+}
+
+// WithConfigRefreshInterval sets the minimum interval to check whether the config is changed.
+func WithConfigRefreshInterval(d time.Duration) ConfigLoaderOption {
+	return func(l *ConfigLoader) {
+		l.refreshInterval = d
+	}
+}
+
+// WithConfigDeferCELBinding defers the check of CEL expressions referencing the custom functions or variables
+// until App is built. see Config.DeferCELBinding.
+func WithConfigDeferCELBinding() ConfigLoaderOption {
+	return func(l *ConfigLoader) {
+		l.deferCELBinding = true
+	}
+}
+
+func NewConfigLoader(location string, opts ...ConfigLoaderOption) *ConfigLoader {
+	l := &ConfigLoader{
+		location:        location,
+		refreshInterval: DefaultConfigRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Location returns the location of the config.
+func (l *ConfigLoader) Location() string {
+	return l.location
+}
+
+// Load loads and validates the config.
+func (l *ConfigLoader) Load(ctx context.Context) (*Config, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cfg, version, err := l.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.version = version
+	l.checkedAt = flextime.Now()
+	return cfg, nil
+}
+
+// Reload returns the new config and its version if the config is changed since the last committed version.
+// the config is nil if not changed. the change is checked at most once per refresh interval.
+// the version is not recorded until Commit, so if the new config is invalid or not used,
+// the config is loaded again at the next check.
+func (l *ConfigLoader) Reload(ctx context.Context) (*Config, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := flextime.Now()
+	if now.Sub(l.checkedAt) < l.refreshInterval {
+		return nil, "", nil
+	}
+	l.checkedAt = now
+	version, err := l.currentVersion(ctx)
+	if err != nil {
+		return nil, "", oops.Wrapf(err, "failed to check config version")
+	}
+	if version == l.version {
+		return nil, "", nil
+	}
+	slog.InfoContext(ctx, "config is changed, reloading", "location", l.location, "version", version)
+	cfg, version, err := l.load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, version, nil
+}
+
+// Commit records the version returned by Reload as loaded, after the config is used successfully.
+func (l *ConfigLoader) Commit(version string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version = version
+}
+
+func (l *ConfigLoader) load(ctx context.Context) (*Config, string, error) {
+	cfg := DefaultConfig()
+	if l.deferCELBinding {
+		cfg.DeferCELBinding()
+	}
+	switch {
+	case strings.HasPrefix(l.location, "s3://"):
+		bucket, key, err := parseS3URL(l.location)
+		if err != nil {
+			return nil, "", err
+		}
+		client, err := l.s3(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil {
+			return nil, "", oops.Wrapf(err, "get %s", l.location)
+		}
+		defer out.Body.Close()
+		src, err := io.ReadAll(out.Body)
+		if err != nil {
+			return nil, "", oops.Wrapf(err, "read %s", l.location)
+		}
+		options := newJsonnetOptions(l.jsonnetOpts...)
+		vm := makeVM(options)
+		// the main file is served from the importer cache, so that imports are resolved relative to its prefix.
+		vm.Importer(&s3Importer{
+			ctx:      ctx,
+			client:   client,
+			fallback: &jsonnet.FileImporter{JPaths: options.jpath},
+			cache: map[string]jsonnet.Contents{
+				l.location: jsonnet.MakeContentsRaw(src),
+			},
+		})
+		jsonStr, err := vm.EvaluateFile(l.location)
+		if err != nil {
+			return nil, "", oops.Errorf("failed to evaluate JSONnet file: %w", err)
+		}
+		if err := cfg.decode(jsonStr); err != nil {
+			return nil, "", err
+		}
+		return cfg, aws.ToString(out.ETag), nil
+	case strings.HasPrefix(l.location, "ssm://"):
+		param, err := l.getParameter(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		vm := MakeVM(l.jsonnetOpts...)
+		jsonStr, err := vm.EvaluateAnonymousSnippet(l.location, aws.ToString(param.Value))
+		if err != nil {
+			return nil, "", oops.Errorf("failed to evaluate JSONnet file: %w", err)
+		}
+		if err := cfg.decode(jsonStr); err != nil {
+			return nil, "", err
+		}
+		return cfg, fmt.Sprint(param.Version), nil
+	}
+	version, err := l.currentVersion(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cfg.Load(l.location, l.jsonnetOpts...); err != nil {
+		return nil, "", err
+	}
+	return cfg, version, nil
+}
+
+// currentVersion returns the version of the config without loading it.
+func (l *ConfigLoader) currentVersion(ctx context.Context) (string, error) {
+	switch {
+	case strings.HasPrefix(l.location, "s3://"):
+		bucket, key, err := parseS3URL(l.location)
+		if err != nil {
+			return "", err
+		}
+		client, err := l.s3(ctx)
+		if err != nil {
+			return "", err
+		}
+		out, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil {
+			return "", oops.Wrapf(err, "head %s", l.location)
+		}
+		return aws.ToString(out.ETag), nil
+	case strings.HasPrefix(l.location, "ssm://"):
+		param, err := l.getParameter(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(param.Version), nil
+	}
+	info, err := os.Stat(l.location)
+	if err != nil {
+		return "", oops.Wrapf(err, "stat %s", l.location)
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+func (l *ConfigLoader) getParameter(ctx context.Context) (*ssmtypes.Parameter, error) {
+	if l.ssmClient == nil {
+		awsCfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to load AWS config")
+		}
+		l.ssmClient = ssm.NewFromConfig(awsCfg)
+	}
+	name := strings.TrimPrefix(l.location, "ssm://")
+	if !strings.HasPrefix(name, "/") && strings.Contains(name, "/") {
+		// ssm:///path/to/param and ssm://path/to/param are the same parameter `/path/to/param`.
+		name = "/" + name
+	}
+	out, err := l.ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, oops.Wrapf(err, "get parameter %s", name)
+	}
+	if out.Parameter == nil {
+		return nil, oops.Errorf("parameter %s not found", name)
+	}
+	return out.Parameter, nil
+}
+
+func (l *ConfigLoader) s3(ctx context.Context) (ConfigS3APIClient, error) {
+	if l.s3Client == nil {
+		awsCfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to load AWS config")
+		}
+		l.s3Client = s3.NewFromConfig(awsCfg)
+	}
+	return l.s3Client, nil
+}
+
+func parseS3URL(str string) (string, string, error) {
+	u, err := url.Parse(str)
+	if err != nil {
+		return "", "", oops.Wrapf(err, "parse %s", str)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", oops.Errorf("invalid s3 url %s", str)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// s3Importer resolves imports relative to the S3 prefix of the importing file.
+// if the file is not found in S3, it falls back to the local library search paths.
+type s3Importer struct {
+	ctx      context.Context
+	client   ConfigS3APIClient
+	fallback jsonnet.Importer
+	cache    map[string]jsonnet.Contents
+}
+
+func (i *s3Importer) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	if !strings.HasPrefix(importedFrom, "s3://") && !strings.HasPrefix(importedPath, "s3://") {
+		return i.fallback.Import(importedFrom, importedPath)
+	}
+	foundAt := importedPath
+	if !strings.HasPrefix(importedPath, "s3://") {
+		bucket, key, err := parseS3URL(importedFrom)
+		if err != nil {
+			return jsonnet.Contents{}, "", err
+		}
+		foundAt = fmt.Sprintf("s3://%s/%s", bucket, path.Join(path.Dir(key), importedPath))
+	}
+	if contents, ok := i.cache[foundAt]; ok {
+		return contents, foundAt, nil
+	}
+	bucket, key, err := parseS3URL(foundAt)
+	if err != nil {
+		return jsonnet.Contents{}, "", err
+	}
+	out, err := i.client.GetObject(i.ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) && !strings.HasPrefix(importedPath, "s3://") {
+			return i.fallback.Import("", importedPath)
+		}
+		return jsonnet.Contents{}, "", oops.Wrapf(err, "get %s", foundAt)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return jsonnet.Contents{}, "", oops.Wrapf(err, "read %s", foundAt)
+	}
+	contents := jsonnet.MakeContentsRaw(data)
+	i.cache[foundAt] = contents
+	return contents, foundAt, nil
+}
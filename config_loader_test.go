@@ -0,0 +1,252 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testLoaderConfig = `
+local common = import 'lib/common.libsonnet';
+common {
+  metrics: [common.requestCount('%s')],
+}
+`
+
+const testLoaderLibrary = `
+{
+  scope: { name: 'test' },
+  requestCount(name):: { name: name, type: 'Count' },
+}
+`
+
+func matchS3Key(key string) any {
+	return mock.MatchedBy(func(input any) bool {
+		switch input := input.(type) {
+		case *s3.GetObjectInput:
+			return *input.Bucket == "config-bucket" && *input.Key == key
+		case *s3.HeadObjectInput:
+			return *input.Bucket == "config-bucket" && *input.Key == key
+		}
+		return false
+	})
+}
+
+func s3Object(body string, etag string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(body)),
+		ETag: aws.String(etag),
+	}
+}
+
+func TestConfigLoader__S3(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	client.On("GetObject", mock.Anything, matchS3Key("configs/cflog2otel.jsonnet")).
+		Return(s3Object(strings.ReplaceAll(testLoaderConfig, "%s", "v1"), `"etag-1"`), nil).Once()
+	for range 2 {
+		client.On("GetObject", mock.Anything, matchS3Key("configs/lib/common.libsonnet")).
+			Return(s3Object(testLoaderLibrary, `"etag-lib"`), nil).Once()
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	restore := flextime.Fix(now)
+	defer restore()
+	loader := cflog2otel.NewConfigLoader("s3://config-bucket/configs/cflog2otel.jsonnet",
+		cflog2otel.WithConfigS3Client(client),
+		cflog2otel.WithConfigJsonnetOptions(cflog2otel.WithAWSConfig(aws.Config{})),
+		cflog2otel.WithConfigRefreshInterval(time.Minute),
+	)
+	ctx := context.Background()
+	cfg, err := loader.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1", cfg.Metrics[0].Name)
+
+	// not checked within refresh interval
+	flextime.Fix(now.Add(30 * time.Second))
+	cfg, version, err := loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+	require.Empty(t, version)
+
+	// not changed
+	client.On("HeadObject", mock.Anything, matchS3Key("configs/cflog2otel.jsonnet")).
+		Return(&s3.HeadObjectOutput{ETag: aws.String(`"etag-1"`)}, nil).Once()
+	flextime.Fix(now.Add(2 * time.Minute))
+	cfg, _, err = loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	// invalid config is not swapped
+	client.On("HeadObject", mock.Anything, matchS3Key("configs/cflog2otel.jsonnet")).
+		Return(&s3.HeadObjectOutput{ETag: aws.String(`"etag-2"`)}, nil).Times(3)
+	client.On("GetObject", mock.Anything, matchS3Key("configs/cflog2otel.jsonnet")).
+		Return(s3Object(`{ metrics: [{ type: 'Count' }] }`, `"etag-2"`), nil).Once()
+	flextime.Fix(now.Add(4 * time.Minute))
+	cfg, _, err = loader.Reload(ctx)
+	require.ErrorContains(t, err, "name is required")
+	require.Nil(t, cfg)
+
+	// retried at the next check
+	client.On("GetObject", mock.Anything, matchS3Key("configs/cflog2otel.jsonnet")).
+		Return(s3Object(strings.ReplaceAll(testLoaderConfig, "%s", "v2"), `"etag-2"`), nil).Once()
+	flextime.Fix(now.Add(6 * time.Minute))
+	cfg, version, err = loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v2", cfg.Metrics[0].Name)
+	require.Equal(t, `"etag-2"`, version)
+	loader.Commit(version)
+
+	// committed version is not reloaded
+	flextime.Fix(now.Add(8 * time.Minute))
+	cfg, _, err = loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+}
+
+func TestConfigLoader__SSM(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockSSMAPIClient(ctrl)
+	parameter := func(version int64, name string) *ssm.GetParameterOutput {
+		return &ssm.GetParameterOutput{
+			Parameter: &ssmtypes.Parameter{
+				Name:    aws.String("/cflog2otel/config"),
+				Value:   aws.String(`{ scope: { name: 'test' }, metrics: [{ name: '` + name + `', type: 'Count' }] }`),
+				Version: version,
+			},
+		}
+	}
+	isConfigParameter := mock.MatchedBy(func(input *ssm.GetParameterInput) bool {
+		return *input.Name == "/cflog2otel/config" && *input.WithDecryption
+	})
+	client.On("GetParameter", mock.Anything, isConfigParameter).Return(parameter(1, "v1"), nil).Twice()
+	client.On("GetParameter", mock.Anything, isConfigParameter).Return(parameter(2, "v2"), nil).Twice()
+
+	loader := cflog2otel.NewConfigLoader("ssm:///cflog2otel/config",
+		cflog2otel.WithConfigSSMClient(client),
+		cflog2otel.WithConfigJsonnetOptions(cflog2otel.WithAWSConfig(aws.Config{})),
+		cflog2otel.WithConfigRefreshInterval(0),
+	)
+	ctx := context.Background()
+	cfg, err := loader.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1", cfg.Metrics[0].Name)
+	cfg, _, err = loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+	cfg, version, err := loader.Reload(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v2", cfg.Metrics[0].Name)
+	require.Equal(t, "2", version)
+}
+
+func TestReloader(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	ssmClient := newMockSSMAPIClient(ctrl)
+	ssmClient.On("GetParameter", mock.Anything, mock.Anything).Return(&ssm.GetParameterOutput{
+		Parameter: &ssmtypes.Parameter{
+			Value:   aws.String(`{ scope: { name: 'test' }, metrics: [{ name: 'v1', type: 'Count' }] }`),
+			Version: 1,
+		},
+	}, nil).Once()
+	ssmClient.On("GetParameter", mock.Anything, mock.Anything).Return(&ssm.GetParameterOutput{
+		Parameter: &ssmtypes.Parameter{
+			Value:   aws.String(`{ scope: { name: 'test' }, metrics: [{ name: 'v2', type: 'Count', filter: { expr: 'undefined_function()' } }] }`),
+			Version: 2,
+		},
+	}, nil).Twice()
+
+	loader := cflog2otel.NewConfigLoader("ssm://cflog2otel-config",
+		cflog2otel.WithConfigSSMClient(ssmClient),
+		cflog2otel.WithConfigJsonnetOptions(cflog2otel.WithAWSConfig(aws.Config{})),
+		cflog2otel.WithConfigRefreshInterval(0),
+		cflog2otel.WithConfigDeferCELBinding(),
+	)
+	ctx := context.Background()
+	cfg, err := loader.Load(ctx)
+	require.NoError(t, err)
+	build := func(ctx context.Context, cfg *cflog2otel.Config) (*cflog2otel.App, error) {
+		return cflog2otel.NewWithClient(cfg, client)
+	}
+	app, err := build(ctx, cfg)
+	require.NoError(t, err)
+	reloader := cflog2otel.NewReloader(loader, app, build)
+
+	// the config is valid by itself, but App can not be built because of the undeclared function.
+	swapped, err := reloader.Reload(ctx)
+	require.ErrorContains(t, err, "undeclared reference to 'undefined_function'")
+	require.False(t, swapped)
+	require.Same(t, app, reloader.App())
+}
+
+func TestReloader__RetryBuild(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	ssmClient := newMockSSMAPIClient(ctrl)
+	parameter := func(version int64, name string) *ssm.GetParameterOutput {
+		return &ssm.GetParameterOutput{
+			Parameter: &ssmtypes.Parameter{
+				Value:   aws.String(`{ scope: { name: 'test' }, metrics: [{ name: '` + name + `', type: 'Count' }] }`),
+				Version: version,
+			},
+		}
+	}
+	ssmClient.On("GetParameter", mock.Anything, mock.Anything).Return(parameter(1, "v1"), nil).Once()
+	// checked and loaded twice, then checked once after committed.
+	ssmClient.On("GetParameter", mock.Anything, mock.Anything).Return(parameter(2, "v2"), nil).Times(5)
+
+	loader := cflog2otel.NewConfigLoader("ssm://cflog2otel-config",
+		cflog2otel.WithConfigSSMClient(ssmClient),
+		cflog2otel.WithConfigJsonnetOptions(cflog2otel.WithAWSConfig(aws.Config{})),
+		cflog2otel.WithConfigRefreshInterval(0),
+	)
+	ctx := context.Background()
+	cfg, err := loader.Load(ctx)
+	require.NoError(t, err)
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+	builds := 0
+	build := func(ctx context.Context, cfg *cflog2otel.Config) (*cflog2otel.App, error) {
+		builds++
+		if builds == 1 {
+			return nil, errors.New("transient error")
+		}
+		return cflog2otel.NewWithClient(cfg, client)
+	}
+	reloader := cflog2otel.NewReloader(loader, app, build)
+
+	swapped, err := reloader.Reload(ctx)
+	require.ErrorContains(t, err, "transient error")
+	require.False(t, swapped)
+	require.Same(t, app, reloader.App())
+
+	// the failed version is built again.
+	swapped, err = reloader.Reload(ctx)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	require.NotSame(t, app, reloader.App())
+	require.Equal(t, 2, builds)
+
+	// the built version is committed.
+	swapped, err = reloader.Reload(ctx)
+	require.NoError(t, err)
+	require.False(t, swapped)
+	require.Equal(t, 2, builds)
+}
@@ -18,6 +18,9 @@ var testConfigs = []string{
 	`testdata/backfil_config.jsonnet`,
 	`testdata/request_time_histogram_custom_buckets.jsonnet`,
 	`testdata/switch_with_cel_value.jsonnet`,
+	`testdata/http_route.jsonnet`,
+	`testdata/definitions.jsonnet`,
+	`testdata/on_error.jsonnet`,
 }
 
 func TestConfigLoad__Success(t *testing.T) {
@@ -38,6 +41,27 @@ func TestConfigLoad__Failed(t *testing.T) {
 		{`testdata/invalid_unknown_field.jsonnet`, `unknown field "fiter"`},
 		{`testdata/invalid_cel.jsonnet`, `undefined field 'csURIStem'`},
 		{`testdata/invalid_not_cel_capable.jsonnet`, `cannot use CEL native function in metrics[*].name`},
+		{`testdata/invalid_routes.jsonnet`, `routes[0]: must start with '/'`},
+		{`testdata/invalid_parse_on_error.jsonnet`, `ignore does not belong to ParseErrorPolicy values`},
+		{`testdata/invalid_definitions_cycle.jsonnet`, `definitions: cycle detected: a -> b -> c -> a`},
+		{`testdata/invalid_unknown_definition.jsonnet`, `metrics[0].filter: unknown definition "statusCategory"`},
+		{`testdata/invalid_definition_type.jsonnet`, `metrics[0].filter: cel("defs.statusClass"): returns string, but bool is required`},
+		{`testdata/invalid_unknown_attribute_set.jsonnet`, `metrics[0]: unknown attribute set "commons"`},
+		{`testdata/invalid_on_error.jsonnet`, `on_error: ignore does not belong to CELErrorPolicy values`},
+		{`testdata/invalid_cel_eval_timeout.jsonnet`, `cel: invalid eval_timeout`},
+		{`testdata/invalid_cloudfront_enrichment.jsonnet`, `enrichment: cloudfront: api or distributions is required`},
+		{`testdata/invalid_filter_type.jsonnet`, `metrics[0].filter: cel("log.csUriStem"): returns string, but bool is required`},
+		{`testdata/invalid_value_type.jsonnet`, `metrics[0].value: cel("log.scBytes"): returns int, but double is required, use double() to convert`},
+		{`testdata/invalid_value_type_same_as_filter.jsonnet`, `metrics[1].value: cel("log.scStatus >= 400"): returns bool, but double is required`},
+		{`testdata/invalid_attribute_type.jsonnet`, `metrics[0].attributes[1].value: cel("log.fields"): returns map(string, string), but string or int or double or bool or null_type is required`},
+		{`testdata/invalid_concurrency.jsonnet`, `concurrency must be positive`},
+		{`testdata/invalid_backfill_interval.jsonnet`, `metrics[0]: interval 7m must divide 1h for backfill mode interval`},
+		{`testdata/invalid_cel_typo_with_cycle.jsonnet`, `metrics[0].filter: cel("lgo.scStatus == 200"): failed to compile CEL expression: ERROR: <input>:1:1: undeclared reference to 'lgo'`},
+		{`testdata/custom_cel_env.jsonnet`, `undeclared reference to 'isStatic'`},
+		{`testdata/invalid_log_format.jsonnet`, `unsupported format: elb`},
+		{`testdata/invalid_log_field_for_format.jsonnet`, `log.xEdgeLocation is not provided by parse.format alb`},
+		{`testdata/invalid_realtime_fields.jsonnet`, `realtime_fields is required for format cloudfront_realtime`},
+		{`testdata/invalid_geoip_without_enrichment.jsonnet`, `metrics[0].attributes[0].value: geo is referenced, but enrichment.geoip is not configured`},
 	}
 	for _, c := range testFailedConfig {
 		t.Run(c[0], func(t *testing.T) {
@@ -0,0 +1,260 @@
+package cflog2otel
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/samber/oops"
+)
+
+// CELDefinitions is a set of named CEL expressions referenced as `defs.<name>` in other expressions.
+// each definition is evaluated at most once per log line.
+type CELDefinitions struct {
+	exprs map[string]*CELCapable[any]
+	types map[string]*cel.Type
+	env   *cel.Env
+}
+
+// NewCELDefinitions returns definitions after checking that referenced definitions exist and have no cycle.
+// the output type of each definition is inferred, so `defs.<name>` is statically type checked.
+func NewCELDefinitions(exprs map[string]*CELCapable[any]) (*CELDefinitions, error) {
+	return newCELDefinitions(defaultCELEnv, exprs)
+}
+
+func newCELDefinitions(base *cel.Env, exprs map[string]*CELCapable[any]) (*CELDefinitions, error) {
+	names := make([]string, 0, len(exprs))
+	for name, expr := range exprs {
+		if expr == nil {
+			return nil, oops.Errorf("definitions[%q]: value is required", name)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, dep := range exprs[name].DefinitionReferences() {
+			if _, ok := exprs[dep]; !ok {
+				return nil, oops.Errorf("definitions[%q]: unknown definition %q", name, dep)
+			}
+		}
+	}
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(exprs))
+	// order is sorted so that dependencies come first.
+	order := make([]string, 0, len(exprs))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			i := slices.Index(path, name)
+			return oops.Errorf("definitions: cycle detected: %s", strings.Join(append(path[i:], name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range exprs[name].DefinitionReferences() {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	d := &CELDefinitions{
+		exprs: exprs,
+		types: make(map[string]*cel.Type, len(exprs)),
+		env:   base,
+	}
+	for _, name := range order {
+		t, err := celDefinitionOutputType(d.env, exprs[name])
+		if err != nil {
+			return nil, oops.Wrapf(err, "definitions[%q]", name)
+		}
+		d.types[name] = t
+		env, err := d.env.Extend(cel.Variable("defs."+name, t))
+		if err != nil {
+			return nil, oops.Wrapf(err, "definitions[%q]", name)
+		}
+		d.env = env
+	}
+	return d, nil
+}
+
+// celDefinitionOutputType returns the output type of the definition. if the branches of switch return different types, returns dyn.
+func celDefinitionOutputType(env *cel.Env, expr *CELCapable[any]) (*cel.Type, error) {
+	if expr.bindErr != nil {
+		// deferred until bound, the type is known at that time.
+		return cel.DynType, nil
+	}
+	if err := expr.CheckType(env); err != nil {
+		return nil, err
+	}
+	var out *cel.Type
+	merge := func(t *cel.Type) {
+		if out == nil {
+			out = t
+			return
+		}
+		if !out.IsExactType(t) {
+			out = cel.DynType
+		}
+	}
+	for _, src := range expr.sources {
+		if src.isCase {
+			continue
+		}
+		ast, err := compileCEL(env, src.expr)
+		if err != nil {
+			return nil, err
+		}
+		merge(ast.OutputType())
+	}
+	switch {
+	case len(expr.sources) == 0:
+		merge(celTypeOfValue(expr.value))
+	case len(expr.switchCases) > 0:
+		for i, prog := range expr.switchCaseValueProgs {
+			if prog == nil {
+				merge(celTypeOfValue(expr.switchCaseValues[i]))
+			}
+		}
+		if expr.switchDefaultProg == nil {
+			merge(celTypeOfValue(expr.switchDefault))
+		}
+	}
+	return out, nil
+}
+
+func celTypeOfValue(v any) *cel.Type {
+	switch v.(type) {
+	case nil:
+		return cel.NullType
+	case string:
+		return cel.StringType
+	case bool:
+		return cel.BoolType
+	case float64:
+		return cel.DoubleType
+	case int64:
+		return cel.IntType
+	}
+	return cel.DynType
+}
+
+// Has reports whether the definition exists.
+func (d *CELDefinitions) Has(name string) bool {
+	if d == nil {
+		return false
+	}
+	_, ok := d.exprs[name]
+	return ok
+}
+
+// Env returns the CEL environment declaring `defs.<name>` with the inferred types.
+func (d *CELDefinitions) Env() *cel.Env {
+	if d == nil {
+		return defaultCELEnv
+	}
+	return d.env
+}
+
+// evalDefinition evaluates the definition with the context of the expression referring to it,
+// so that the cancellation and the timeout of the expression also apply to the definition.
+func (v *CELVariables) evalDefinition(ctx context.Context, name string) ref.Val {
+	if val, ok := v.defsCache[name]; ok {
+		if val == nil {
+			return types.NewErr("definition %q refers to itself", name)
+		}
+		return val
+	}
+	if !v.Definitions.Has(name) {
+		return types.NewErr("unknown definition %q", name)
+	}
+	if v.defsCache == nil {
+		v.defsCache = make(map[string]ref.Val)
+	}
+	// mark as evaluating to detect self reference.
+	v.defsCache[name] = nil
+	// the branch of the definition is not the branch of the referring expression in the trace.
+	ctx = context.WithValue(ctx, celEvalTraceKey{}, nil)
+	out, err := v.Definitions.exprs[name].Eval(ctx, v)
+	var val ref.Val
+	if err != nil {
+		val = types.WrapErr(oops.Wrapf(err, "defs.%s", name))
+		delete(v.defsCache, name)
+		return val
+	}
+	val = types.DefaultTypeAdapter.NativeToValue(out)
+	v.defsCache[name] = val
+	return val
+}
+
+// celDefinitionsValue is the CEL value of `defs` variable bound to the variables of the current log line.
+type celDefinitionsValue struct {
+	ctx  context.Context
+	vars *CELVariables
+}
+
+var celDefinitionsType = cel.MapType(cel.StringType, cel.DynType)
+
+func (d celDefinitionsValue) Get(index ref.Val) ref.Val {
+	name, ok := index.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(index)
+	}
+	return d.vars.evalDefinition(d.ctx, string(name))
+}
+
+func (d celDefinitionsValue) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, oops.Errorf("type conversion error from 'defs' to '%v'", typeDesc)
+}
+
+func (d celDefinitionsValue) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return types.MapType
+	}
+	return types.NewErr("type conversion error from 'defs' to '%s'", typeVal)
+}
+
+func (d celDefinitionsValue) Equal(other ref.Val) ref.Val {
+	o, ok := other.(celDefinitionsValue)
+	return types.Bool(ok && o.vars == d.vars)
+}
+
+func (d celDefinitionsValue) Type() ref.Type {
+	return types.MapType
+}
+
+func (d celDefinitionsValue) Value() any {
+	return d
+}
+
+// collectDefinitionReferences returns definition names referenced as `defs.name`, `defs.?name` or `defs["name"]`.
+func collectDefinitionReferences(a *cel.Ast) []string {
+	var refs []string
+	add := func(name string) {
+		if !slices.Contains(refs, name) {
+			refs = append(refs, name)
+		}
+	}
+	celast.PreOrderVisit(a.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if operand, field, ok := celFieldAccess(e); ok && operand.AsIdent() == "defs" {
+			add(field)
+		}
+	}))
+	return refs
+}
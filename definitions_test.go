@@ -0,0 +1,108 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCELDefinitions(t *testing.T) {
+	cases := []struct {
+		name    string
+		defs    map[string]string
+		wantErr string
+	}{
+		{
+			name: "no references",
+			defs: map[string]string{"a": `"a"`},
+		},
+		{
+			name: "index access",
+			defs: map[string]string{"a": `"a"`, "b": `defs["a"] + "b"`},
+		},
+		{
+			name:    "self reference",
+			defs:    map[string]string{"a": `defs.a`},
+			wantErr: `definitions: cycle detected: a -> a`,
+		},
+		{
+			name:    "unknown definition",
+			defs:    map[string]string{"a": `defs["b"]`},
+			wantErr: `definitions["a"]: unknown definition "b"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			exprs := make(map[string]*cflog2otel.CELCapable[any], len(tc.defs))
+			for name, src := range tc.defs {
+				bs, err := json.Marshal(map[string]string{"expr": src})
+				require.NoError(t, err)
+				var expr cflog2otel.CELCapable[any]
+				require.NoError(t, json.Unmarshal(bs, &expr))
+				exprs[name] = &expr
+			}
+			defs, err := cflog2otel.NewCELDefinitions(exprs)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, defs.Env())
+		})
+	}
+}
+
+func TestCELDefinitions__EvalPerLogLine(t *testing.T) {
+	var expr cflog2otel.CELCapable[string]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "defs.method + defs.method"}`), &expr))
+	var def cflog2otel.CELCapable[any]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "log.csMethod + \"!\""}`), &def))
+	defs, err := cflog2otel.NewCELDefinitions(map[string]*cflog2otel.CELCapable[any]{
+		"method": &def,
+	})
+	require.NoError(t, err)
+	vars := &cflog2otel.CELVariables{Definitions: defs}
+	ctx := context.Background()
+
+	vars.SetLogLine(cflog2otel.CELVariablesLog{CsMethod: ptr("GET")})
+	got, err := expr.Eval(ctx, vars)
+	require.NoError(t, err)
+	require.Equal(t, "GET!GET!", got)
+
+	vars.SetLogLine(cflog2otel.CELVariablesLog{CsMethod: ptr("POST")})
+	got, err = expr.Eval(ctx, vars)
+	require.NoError(t, err)
+	require.Equal(t, "POST!POST!", got)
+}
+
+func TestCELDefinitions__EvalWithContext(t *testing.T) {
+	var expr cflog2otel.CELCapable[int64]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "defs.total"}`), &expr))
+	var def cflog2otel.CELCapable[any]
+	// the interrupt is checked every 100 iterations of comprehensions by default.
+	src := "[" + strings.TrimSuffix(strings.Repeat("1,", 200), ",") + "].map(x, x * 2).size()"
+	bs, err := json.Marshal(map[string]string{"expr": src})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(bs, &def))
+	defs, err := cflog2otel.NewCELDefinitions(map[string]*cflog2otel.CELCapable[any]{
+		"total": &def,
+	})
+	require.NoError(t, err)
+	vars := &cflog2otel.CELVariables{Definitions: defs}
+	vars.SetLogLine(cflog2otel.CELVariablesLog{})
+
+	got, err := expr.Eval(context.Background(), vars)
+	require.NoError(t, err)
+	require.EqualValues(t, 200, got)
+
+	// the definition is interrupted by the context of the referring expression.
+	vars.SetLogLine(cflog2otel.CELVariablesLog{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = expr.Eval(ctx, vars)
+	require.ErrorContains(t, err, "defs.total")
+}
@@ -0,0 +1,149 @@
+package cflog2otel
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"iter"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// albLogFields are the fields of ALB access logs.
+// see https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+var albLogFields = []string{
+	"type", "time", "elb", "client:port", "target:port", "request_processing_time", "target_processing_time",
+	"response_processing_time", "elb_status_code", "target_status_code", "received_bytes", "sent_bytes", "request",
+	"user_agent", "ssl_cipher", "ssl_protocol", "target_group_arn", "trace_id", "domain_name", "chosen_cert_arn",
+	"matched_rule_priority", "request_creation_time", "actions_executed", "redirect_url", "error_reason",
+	"target:port_list", "target_status_code_list", "classification", "classification_reason", "conn_trace_id",
+}
+
+var albLogFormat = positionalLogFormat{
+	logType:   "ALB Access Log",
+	split:     splitLogFields,
+	minFields: 13,
+	aliases: map[string]string{
+		"elb_status_code": "sc-status",
+		"received_bytes":  "cs-bytes",
+		"sent_bytes":      "sc-bytes",
+		"user_agent":      "cs(User-Agent)",
+		"ssl_cipher":      "ssl-cipher",
+		"ssl_protocol":    "ssl-protocol",
+		"domain_name":     "x-host-header",
+	},
+	setters: func(l *CELVariablesLog) map[string]func(string) error {
+		return map[string]func(string) error{
+			"time": func(s string) error {
+				return l.setTimestamp(time.RFC3339Nano, s)
+			},
+			"client:port": l.setClientAddress,
+			"request":     l.setRequestLine,
+			// the processing times are -1 if the request is not dispatched to the target.
+			"response_processing_time": func(s string) error {
+				var total float64
+				for _, name := range []string{"request_processing_time", "target_processing_time", "response_processing_time"} {
+					v, err := toPtrFloat64(l.Fields[name])
+					if err != nil || v == nil || *v < 0 {
+						return err
+					}
+					total += *v
+				}
+				l.TimeTaken = &total
+				return nil
+			},
+		}
+	},
+}
+
+var albLogTypes = regexp.MustCompile(`^(http|https|h2|grpcs|ws|wss) \d{4}-\d{2}-\d{2}T`)
+
+// ALBLogParser is the LogParser of Application Load Balancer access logs.
+// `log.timeTaken` is the sum of the request, target and response processing times.
+type ALBLogParser struct{}
+
+func (ALBLogParser) Name() string {
+	return LogFormatALB
+}
+
+func (ALBLogParser) Detect(objectKey string, head []byte) bool {
+	if strings.Contains(objectKey, "_elasticloadbalancing_") && strings.Contains(objectKey, "_app.") {
+		return true
+	}
+	return albLogTypes.Match(head)
+}
+
+func (ALBLogParser) Parse(ctx context.Context, r io.Reader, _ ParseConfig) iter.Seq2[CELVariablesLog, error] {
+	return albLogFormat.parse(ctx, r, albLogFields)
+}
+
+func (ALBLogParser) Schema() []CELField {
+	return NewLogSchema([]string{
+		"type", "date", "time", "timestamp", "clientIp", "cPort", "scStatus", "scStatusCategory", "csBytes", "scBytes",
+		"csMethod", "csProtocol", "csHost", "csUriStem", "csUriQuery", "csProtocolVersion", "csUserAgent",
+		"sslCipher", "sslProtocol", "xHostHeader", "timeTaken", "route", "query", "fields",
+	}, albLogFields)
+}
+
+// nlbLogFields are the fields of NLB access logs, which are written only for TLS listeners.
+// see https://docs.aws.amazon.com/elasticloadbalancing/latest/network/load-balancer-access-logs.html
+var nlbLogFields = []string{
+	"type", "version", "time", "elb", "listener", "client:port", "destination:port", "connection_time",
+	"tls_handshake_time", "received_bytes", "sent_bytes", "incoming_tls_alert", "chosen_cert_arn", "chosen_cert_serial",
+	"tls_cipher", "tls_protocol_version", "tls_named_group", "domain_name", "alpn_fe_protocol", "alpn_be_protocol",
+	"alpn_client_preference_list", "tls_connection_creation_time",
+}
+
+var nlbLogFormat = positionalLogFormat{
+	logType:   "NLB Access Log",
+	split:     splitLogFields,
+	minFields: 18,
+	aliases: map[string]string{
+		"received_bytes":       "cs-bytes",
+		"sent_bytes":           "sc-bytes",
+		"tls_cipher":           "ssl-cipher",
+		"tls_protocol_version": "ssl-protocol",
+		"domain_name":          "x-host-header",
+	},
+	setters: func(l *CELVariablesLog) map[string]func(string) error {
+		return map[string]func(string) error{
+			"time": func(s string) error {
+				// the time has no time zone, and is in UTC.
+				return l.setTimestamp("2006-01-02T15:04:05", s)
+			},
+			"client:port": l.setClientAddress,
+			"connection_time": func(s string) error {
+				v, err := toPtrSeconds(s)
+				l.TimeTaken = v
+				return err
+			},
+		}
+	},
+}
+
+// NLBLogParser is the LogParser of Network Load Balancer access logs.
+// `log.timeTaken` is the connection time in seconds.
+type NLBLogParser struct{}
+
+func (NLBLogParser) Name() string {
+	return LogFormatNLB
+}
+
+func (NLBLogParser) Detect(objectKey string, head []byte) bool {
+	if strings.Contains(objectKey, "_elasticloadbalancing_") && strings.Contains(objectKey, "_net.") {
+		return true
+	}
+	return bytes.HasPrefix(head, []byte("tls "))
+}
+
+func (NLBLogParser) Parse(ctx context.Context, r io.Reader, _ ParseConfig) iter.Seq2[CELVariablesLog, error] {
+	return nlbLogFormat.parse(ctx, r, nlbLogFields)
+}
+
+func (NLBLogParser) Schema() []CELField {
+	return NewLogSchema([]string{
+		"type", "date", "time", "timestamp", "clientIp", "cPort", "csBytes", "scBytes", "sslCipher", "sslProtocol",
+		"xHostHeader", "timeTaken", "fields",
+	}, nlbLogFields)
+}
@@ -0,0 +1,158 @@
+package cflog2otel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+// AggregateTrace records how each log line is aggregated, for explaining unexpected metric values.
+// Aggregate records the trace if it is set to the context by WithAggregateTrace.
+type AggregateTrace struct {
+	Lines []*LineTrace `json:"lines"`
+}
+
+// LineTrace is the trace of a log line.
+type LineTrace struct {
+	Timestamp          time.Time        `json:"timestamp"`
+	ResourceAttributes []AttributeTrace `json:"resource_attributes,omitempty"`
+	// Skipped is the reason if the line is skipped by resource attributes.
+	Skipped string        `json:"skipped,omitempty"`
+	Metrics []MetricTrace `json:"metrics,omitempty"`
+}
+
+// MetricTrace is the trace of a metric for a log line.
+type MetricTrace struct {
+	Name       string           `json:"name"`
+	Filter     *CELEvalTrace    `json:"filter,omitempty"`
+	Attributes []AttributeTrace `json:"attributes,omitempty"`
+	Value      *CELEvalTrace    `json:"value,omitempty"`
+	// StartTime and Time are the interval of the data point, which the line is aggregated to.
+	StartTime *time.Time `json:"start_time,omitempty"`
+	Time      *time.Time `json:"time,omitempty"`
+	// Skipped is the reason if the line is not aggregated to the metric.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// AttributeTrace is the trace of an attribute.
+type AttributeTrace struct {
+	Key string `json:"key"`
+	CELEvalTrace
+}
+
+// CELEvalTrace is the trace of CELCapable.Eval.
+type CELEvalTrace struct {
+	// Branch is `literal`, `expr`, `switch[i]` for the matched case, `default` for switch default,
+	// or `on_error` if the default value of on_error policy is used.
+	Branch string `json:"branch,omitempty"`
+	// Expr is the expression of the branch, the case expression for switch.
+	Expr  string `json:"expr,omitempty"`
+	Value any    `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+type aggregateTraceKey struct{}
+
+type celEvalTraceKey struct{}
+
+// WithAggregateTrace returns the context to record the trace of Aggregate.
+func WithAggregateTrace(ctx context.Context, trace *AggregateTrace) context.Context {
+	return context.WithValue(ctx, aggregateTraceKey{}, trace)
+}
+
+func aggregateTraceFromContext(ctx context.Context) *AggregateTrace {
+	trace, _ := ctx.Value(aggregateTraceKey{}).(*AggregateTrace)
+	return trace
+}
+
+func (t *AggregateTrace) startLine(l CELVariablesLog) *LineTrace {
+	if t == nil {
+		return nil
+	}
+	lt := &LineTrace{Timestamp: l.Timestamp}
+	t.Lines = append(t.Lines, lt)
+	return lt
+}
+
+// startMetric returns the trace of the metric, nil if not tracing.
+func (lt *LineTrace) startMetric(name string) *MetricTrace {
+	if lt == nil {
+		return nil
+	}
+	lt.Metrics = append(lt.Metrics, MetricTrace{Name: name})
+	return &lt.Metrics[len(lt.Metrics)-1]
+}
+
+// skip records the reason why the line is not aggregated.
+func (mt *MetricTrace) skip(reason string) {
+	if mt == nil {
+		return
+	}
+	mt.Skipped = reason
+}
+
+// recordCELBranch records the evaluated branch to the trace in the context.
+func recordCELBranch(ctx context.Context, branch string, expr string) {
+	if t, ok := ctx.Value(celEvalTraceKey{}).(*CELEvalTrace); ok {
+		t.Branch = branch
+		t.Expr = expr
+	}
+}
+
+// recordCELSwitchCase records the matched switch case to the trace in the context.
+// the branch name is formatted only when tracing, not to allocate on every evaluation.
+func recordCELSwitchCase(ctx context.Context, i int, expr string) {
+	if t, ok := ctx.Value(celEvalTraceKey{}).(*CELEvalTrace); ok {
+		t.Branch = fmt.Sprintf("switch[%d]", i)
+		t.Expr = expr
+	}
+}
+
+// evalWithTrace evaluates the expression, and returns the trace if tracing is true.
+func evalWithTrace[T any](ctx context.Context, expr *CELCapable[T], vars *CELVariables, tracing bool) (T, *CELEvalTrace, error) {
+	if !tracing {
+		value, err := expr.Eval(ctx, vars)
+		return value, nil, err
+	}
+	trace := &CELEvalTrace{}
+	value, err := expr.Eval(context.WithValue(ctx, celEvalTraceKey{}, trace), vars)
+	trace.Value = value
+	if err != nil {
+		trace.Value = nil
+		trace.Error = err.Error()
+	}
+	return value, trace, err
+}
+
+// ExplainInput is the log line to explain.
+type ExplainInput struct {
+	// LogPath is the path of the CloudFront standard log file, gzipped or not.
+	LogPath string
+	// Line is the 1-based line number in the file, including header lines.
+	Line int
+	// Bucket and ObjectKey are the S3 location of the log in the notification.
+	// if ObjectKey is empty, the base name of LogPath is used.
+	Bucket    string
+	ObjectKey string
+}
+
+// Explain aggregates the log line in the same way as the invocation, and returns the trace of the evaluation.
+func (app *App) Explain(ctx context.Context, input ExplainInput) (*LineTrace, error) {
+	if input.Line <= 0 {
+		return nil, oops.Errorf("line must be positive")
+	}
+	bs, err := readLocalLog(input.LogPath, input.Line)
+	if err != nil {
+		return nil, err
+	}
+	trace := &AggregateTrace{}
+	if _, err := app.aggregateLocalLogBytes(WithAggregateTrace(ctx, trace), bs, input.LogPath, input.Bucket, input.ObjectKey); err != nil {
+		return nil, err
+	}
+	if len(trace.Lines) == 0 {
+		return nil, oops.Errorf("line %d is not aggregated", input.Line)
+	}
+	return trace.Lines[0], nil
+}
@@ -0,0 +1,89 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp__Explain(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		line   int
+		check  func(t *testing.T, trace *cflog2otel.LineTrace)
+	}{
+		{
+			name:   "filter rejected",
+			config: "testdata/request_count_for_5xx.jsonnet",
+			line:   3,
+			check: func(t *testing.T, trace *cflog2otel.LineTrace) {
+				require.Len(t, trace.Metrics, 1)
+				mt := trace.Metrics[0]
+				require.Equal(t, "filter rejected", mt.Skipped)
+				require.Equal(t, &cflog2otel.CELEvalTrace{Branch: "expr", Expr: `log.scStatusCategory == "5xx"`, Value: false}, mt.Filter)
+				require.Nil(t, mt.Time)
+			},
+		},
+		{
+			name:   "filter accepted",
+			config: "testdata/request_count_for_5xx.jsonnet",
+			line:   6,
+			check: func(t *testing.T, trace *cflog2otel.LineTrace) {
+				mt := trace.Metrics[0]
+				require.Empty(t, mt.Skipped)
+				require.Equal(t, true, mt.Filter.Value)
+				require.NotNil(t, mt.Time)
+				require.Equal(t, trace.Timestamp.Truncate(time.Minute), *mt.StartTime)
+				require.Equal(t, trace.Timestamp.Truncate(time.Minute).Add(time.Minute), *mt.Time)
+			},
+		},
+		{
+			name:   "switch branch",
+			config: "testdata/switch_case.jsonnet",
+			line:   4,
+			check: func(t *testing.T, trace *cflog2otel.LineTrace) {
+				require.Contains(t, trace.ResourceAttributes, cflog2otel.AttributeTrace{
+					Key:          "aws.cloudfront.distribution_id",
+					CELEvalTrace: cflog2otel.CELEvalTrace{Branch: "expr", Expr: "cloudfront.distributionId", Value: "EMLARXS9EXAMPLE"},
+				})
+				require.Contains(t, trace.Metrics[0].Attributes, cflog2otel.AttributeTrace{
+					Key:          "cloudfront.origin",
+					CELEvalTrace: cflog2otel.CELEvalTrace{Branch: "switch[0]", Expr: `log.csUriStem.startsWith("/index.html")`, Value: "S3"},
+				})
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := newMockControler(t)
+			defer ctrl.Finish()
+			cfg := cflog2otel.DefaultConfig()
+			require.NoError(t, cfg.Load(c.config, cflog2otel.WithAWSConfig(aws.Config{})))
+			app, err := cflog2otel.NewWithClient(cfg, newMockS3APIClient(ctrl))
+			require.NoError(t, err)
+			trace, err := app.Explain(context.Background(), cflog2otel.ExplainInput{
+				LogPath:   "testdata/cf_log.txt",
+				Line:      c.line,
+				ObjectKey: "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz",
+			})
+			require.NoError(t, err)
+			c.check(t, trace)
+		})
+	}
+}
+
+func TestApp__Explain__HeaderLine(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load("testdata/switch_case.jsonnet", cflog2otel.WithAWSConfig(aws.Config{})))
+	app, err := cflog2otel.NewWithClient(cfg, newMockS3APIClient(ctrl))
+	require.NoError(t, err)
+	_, err = app.Explain(context.Background(), cflog2otel.ExplainInput{LogPath: "testdata/cf_log.txt", Line: 2})
+	require.ErrorContains(t, err, "line 2 is a header line")
+}
@@ -0,0 +1,252 @@
+package cflog2otel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/samber/oops"
+)
+
+// GeoIPDatabase is a set of MaxMind DB readers for country and ASN lookups.
+type GeoIPDatabase struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// LoadGeoIPDatabase loads MaxMind DB files from local paths or s3:// URLs.
+func LoadGeoIPDatabase(ctx context.Context, cfg *GeoIPConfig, downloader *manager.Downloader) (*GeoIPDatabase, error) {
+	db := &GeoIPDatabase{}
+	if cfg.Database != "" {
+		r, err := openMaxMindDB(ctx, cfg.Database, downloader)
+		if err != nil {
+			return nil, oops.Wrapf(err, "database")
+		}
+		db.country = r
+		db.asn = r
+	}
+	if cfg.ASNDatabase != "" {
+		r, err := openMaxMindDB(ctx, cfg.ASNDatabase, downloader)
+		if err != nil {
+			return nil, oops.Wrapf(err, "asn_database")
+		}
+		db.asn = r
+	}
+	return db, nil
+}
+
+func openMaxMindDB(ctx context.Context, path string, downloader *manager.Downloader) (*maxminddb.Reader, error) {
+	data, err := readLocalOrS3File(ctx, path, downloader)
+	if err != nil {
+		return nil, err
+	}
+	r, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, oops.Wrapf(err, "open %s", path)
+	}
+	slog.InfoContext(ctx, "loaded geoip database", "path", path, "database_type", r.Metadata.DatabaseType)
+	return r, nil
+}
+
+// readLocalOrS3File reads a local file or s3://bucket/key object.
+func readLocalOrS3File(ctx context.Context, path string, downloader *manager.Downloader) ([]byte, error) {
+	if !strings.HasPrefix(path, "s3://") {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, oops.Wrapf(err, "read %s", path)
+		}
+		return bs, nil
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, oops.Wrapf(err, "parse %s", path)
+	}
+	if downloader == nil {
+		return nil, oops.Errorf("can not download %s without S3 client", path)
+	}
+	buffer := NewWriteAtBuffer()
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if _, err := downloader.Download(ctx, buffer, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}); err != nil {
+		return nil, oops.Wrapf(err, "download %s", path)
+	}
+	return buffer.Bytes(), nil
+}
+
+// NewLookup returns a CEL value for `geo` variable. lookup results are cached in the returned value,
+// so create a new one for each invocation.
+func (db *GeoIPDatabase) NewLookup() *CELGeoIP {
+	return &CELGeoIP{
+		db:    db,
+		cache: make(map[netip.Addr]geoIPRecord),
+	}
+}
+
+type geoIPRecord struct {
+	Country string
+	ASN     int64
+	ASNOrg  string
+}
+
+type maxMindRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// CELGeoIPType is the CEL type of `geo` variable.
+var CELGeoIPType = types.NewOpaqueType("cflog2otel.GeoIP")
+
+// CELGeoIP is the CEL value of `geo` variable.
+type CELGeoIP struct {
+	db    *GeoIPDatabase
+	mu    sync.Mutex
+	cache map[netip.Addr]geoIPRecord
+}
+
+func (g *CELGeoIP) lookup(addr netip.Addr) geoIPRecord {
+	if g == nil || g.db == nil {
+		return geoIPRecord{}
+	}
+	addr = addr.Unmap()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if rec, ok := g.cache[addr]; ok {
+		return rec
+	}
+	var rec geoIPRecord
+	ip := net.IP(addr.AsSlice())
+	if g.db.country != nil {
+		var r maxMindRecord
+		if err := g.db.country.Lookup(ip, &r); err != nil {
+			slog.Debug("failed to lookup geoip database", "ip", addr, "error", err)
+		}
+		rec.Country = r.Country.ISOCode
+		if rec.Country == "" {
+			rec.Country = r.RegisteredCountry.ISOCode
+		}
+	}
+	if g.db.asn != nil {
+		var r maxMindRecord
+		if err := g.db.asn.Lookup(ip, &r); err != nil {
+			slog.Debug("failed to lookup asn database", "ip", addr, "error", err)
+		}
+		rec.ASN = int64(r.AutonomousSystemNumber)
+		rec.ASNOrg = r.AutonomousSystemOrganization
+	}
+	g.cache[addr] = rec
+	return rec
+}
+
+func (g *CELGeoIP) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", CELGeoIPType, typeDesc)
+}
+
+func (g *CELGeoIP) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return CELGeoIPType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CELGeoIPType, typeVal)
+}
+
+func (g *CELGeoIP) Equal(other ref.Val) ref.Val {
+	return types.Bool(g == other)
+}
+
+func (g *CELGeoIP) Type() ref.Type {
+	return CELGeoIPType
+}
+
+func (g *CELGeoIP) Value() any {
+	return g
+}
+
+// GeoIPCELLib returns CEL functions for `geo` variable.
+//
+//	geo.country(string or net.IP) -> string
+//	geo.asn(string or net.IP) -> int
+//	geo.asnOrg(string or net.IP) -> string
+//
+// If the address is invalid or not found, returns empty string or 0.
+func GeoIPCELLib() cel.EnvOption {
+	return cel.Lib(geoIPCELLib{})
+}
+
+type geoIPCELLib struct{}
+
+func (geoIPCELLib) LibraryName() string {
+	return "cflog2otel.geoip"
+}
+
+func (geoIPCELLib) CompileOptions() []cel.EnvOption {
+	overloads := func(name string, resultType *cel.Type, fn func(geoIPRecord) ref.Val) cel.EnvOption {
+		return cel.Function(name,
+			cel.MemberOverload("geoip_"+name+"_string", []*cel.Type{CELGeoIPType, cel.StringType}, resultType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					g, ok := lhs.(*CELGeoIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					s, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					addr, err := netip.ParseAddr(string(s))
+					if err != nil {
+						return fn(geoIPRecord{})
+					}
+					return fn(g.lookup(addr))
+				}),
+			),
+			cel.MemberOverload("geoip_"+name+"_net_ip", []*cel.Type{CELGeoIPType, CELIPType}, resultType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					g, ok := lhs.(*CELGeoIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					ip, ok := rhs.(CELIP)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return fn(g.lookup(ip.Addr))
+				}),
+			),
+		)
+	}
+	return []cel.EnvOption{
+		cel.Variable("geo", CELGeoIPType),
+		overloads("country", cel.StringType, func(rec geoIPRecord) ref.Val {
+			return types.String(rec.Country)
+		}),
+		overloads("asn", cel.IntType, func(rec geoIPRecord) ref.Val {
+			return types.Int(rec.ASN)
+		}),
+		overloads("asnOrg", cel.StringType, func(rec geoIPRecord) ref.Val {
+			return types.String(rec.ASNOrg)
+		}),
+	}
+}
+
+func (geoIPCELLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{}
+}
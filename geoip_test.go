@@ -0,0 +1,92 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoIPLookup(t *testing.T) {
+	ctx := context.Background()
+	db, err := cflog2otel.LoadGeoIPDatabase(ctx, &cflog2otel.GeoIPConfig{
+		Database: "testdata/geoip.mmdb",
+	}, nil)
+	require.NoError(t, err)
+	geoip := db.NewLookup()
+	cases := []testCase{
+		testCaseCELCapable[string]{
+			name: "country",
+			expr: `cel('geo.country(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("192.0.2.100")},
+				GeoIP: geoip,
+			},
+			want: "US",
+		},
+		testCaseCELCapable[string]{
+			name: "registered country fallback",
+			expr: `cel('isIP(log.clientIp) ? geo.country(ip(log.clientIp)) : ""')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("198.51.100.1")},
+				GeoIP: geoip,
+			},
+			want: "JP",
+		},
+		testCaseCELCapable[string]{
+			name: "country ipv6",
+			expr: `cel('geo.country(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("2001:db8::1")},
+				GeoIP: geoip,
+			},
+			want: "DE",
+		},
+		testCaseCELCapable[int64]{
+			name: "asn",
+			expr: `cel('geo.asn(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("198.51.100.1")},
+				GeoIP: geoip,
+			},
+			want: 64497,
+		},
+		testCaseCELCapable[string]{
+			name: "asn org",
+			expr: `cel('geo.asnOrg(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("192.0.2.100")},
+				GeoIP: geoip,
+			},
+			want: "Example US Network",
+		},
+		testCaseCELCapable[string]{
+			name: "not found",
+			expr: `cel('geo.country(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log:   cflog2otel.CELVariablesLog{ClientIP: ptr("203.0.113.1")},
+				GeoIP: geoip,
+			},
+			want: "",
+		},
+		testCaseCELCapable[string]{
+			name: "without database",
+			expr: `cel('geo.country(log.clientIp)')`,
+			variables: &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{ClientIP: ptr("192.0.2.100")},
+			},
+			want: "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name(), tc.Run)
+	}
+}
+
+func TestLoadGeoIPDatabase__NotFound(t *testing.T) {
+	_, err := cflog2otel.LoadGeoIPDatabase(context.Background(), &cflog2otel.GeoIPConfig{
+		Database: "testdata/not_found.mmdb",
+	}, nil)
+	require.ErrorContains(t, err, "read testdata/not_found.mmdb")
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/fujiwara/ssm-lookup/ssm"
 	jsonnet "github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
@@ -17,9 +18,13 @@ import (
 )
 
 type jsonnetOptions struct {
-	awsCfg *aws.Config
-	ctx    context.Context
-	cache  *sync.Map
+	awsCfg               *aws.Config
+	ctx                  context.Context
+	cache                *sync.Map
+	secretsManagerClient SecretsManagerAPIClient
+	extVars              map[string]string
+	tlaVars              map[string]string
+	jpath                []string
 }
 
 type JsonnetOption func(*jsonnetOptions)
@@ -42,14 +47,53 @@ func WithCache(cache *sync.Map) JsonnetOption {
 	}
 }
 
-func MakeVM(opts ...JsonnetOption) *jsonnet.VM {
+// WithSecretsManagerClient sets the client for `secretsmanager` native functions.
+// if not set, the client is created from the AWS config.
+func WithSecretsManagerClient(client SecretsManagerAPIClient) JsonnetOption {
+	return func(o *jsonnetOptions) {
+		o.secretsManagerClient = client
+	}
+}
+
+// WithExtStr sets the external variable, like `jsonnet --ext-str key=value`.
+func WithExtStr(key, value string) JsonnetOption {
+	return func(o *jsonnetOptions) {
+		o.extVars[key] = value
+	}
+}
+
+// WithTLAStr sets the top-level argument, like `jsonnet --tla-str key=value`.
+func WithTLAStr(key, value string) JsonnetOption {
+	return func(o *jsonnetOptions) {
+		o.tlaVars[key] = value
+	}
+}
+
+// WithJPath adds the library search paths, like `jsonnet --jpath dir`.
+func WithJPath(paths ...string) JsonnetOption {
+	return func(o *jsonnetOptions) {
+		o.jpath = append(o.jpath, paths...)
+	}
+}
+
+func newJsonnetOptions(opts ...JsonnetOption) jsonnetOptions {
 	options := jsonnetOptions{
-		ctx:   context.Background(),
-		cache: &sync.Map{},
+		ctx:     context.Background(),
+		cache:   &sync.Map{},
+		extVars: make(map[string]string),
+		tlaVars: make(map[string]string),
 	}
 	for _, opt := range opts {
 		opt(&options)
 	}
+	return options
+}
+
+func MakeVM(opts ...JsonnetOption) *jsonnet.VM {
+	return makeVM(newJsonnetOptions(opts...))
+}
+
+func makeVM(options jsonnetOptions) *jsonnet.VM {
 	vm := jsonnet.MakeVM()
 	for _, nf := range NativeFunctions {
 		vm.NativeFunction(nf)
@@ -65,6 +109,21 @@ func MakeVM(opts ...JsonnetOption) *jsonnet.VM {
 	for _, nf := range ssmlookup.JsonnetNativeFuncs(options.ctx) {
 		vm.NativeFunction(nf)
 	}
+	if options.secretsManagerClient == nil {
+		options.secretsManagerClient = secretsmanager.NewFromConfig(*options.awsCfg)
+	}
+	for _, nf := range SecretsManagerNativeFunctions(options.ctx, options.secretsManagerClient, options.cache) {
+		vm.NativeFunction(nf)
+	}
+	for key, value := range options.extVars {
+		vm.ExtVar(key, value)
+	}
+	for key, value := range options.tlaVars {
+		vm.TLAVar(key, value)
+	}
+	if len(options.jpath) > 0 {
+		vm.Importer(&jsonnet.FileImporter{JPaths: options.jpath})
+	}
 	return vm
 }
 
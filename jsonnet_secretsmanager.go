@@ -0,0 +1,87 @@
+package cflog2otel
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/samber/oops"
+)
+
+// SecretsManagerAPIClient is the Secrets Manager API used by `secretsmanager` native functions.
+type SecretsManagerAPIClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SecretsManagerNativeFunctions returns native functions to read secrets:
+// `secretsmanager(secretId)` returns the secret string, and `secretsmanager_json(secretId, key)` returns the value of the key in the JSON secret string.
+// secret values are cached in the cache, shared with ssm native functions.
+func SecretsManagerNativeFunctions(ctx context.Context, client SecretsManagerAPIClient, cache *sync.Map) []*jsonnet.NativeFunction {
+	getSecret := func(secretID string) (string, error) {
+		cacheKey := "secretsmanager:" + secretID
+		if v, ok := cache.Load(cacheKey); ok {
+			return v.(string), nil
+		}
+		out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretID),
+		})
+		if err != nil {
+			return "", oops.Wrapf(err, "get secret value %s", secretID)
+		}
+		if out.SecretString == nil {
+			return "", oops.Errorf("secret %s has no secret string", secretID)
+		}
+		cache.Store(cacheKey, *out.SecretString)
+		return *out.SecretString, nil
+	}
+	return []*jsonnet.NativeFunction{
+		{
+			Name:   "secretsmanager",
+			Params: []ast.Identifier{"secretId"},
+			Func: func(args []interface{}) (interface{}, error) {
+				if len(args) != 1 {
+					return nil, oops.Errorf("secretsmanager: invalid arguments length expected 1 got %d", len(args))
+				}
+				secretID, ok := args[0].(string)
+				if !ok {
+					return nil, oops.Errorf("secretsmanager: invalid arguments, expected string got %T", args[0])
+				}
+				return getSecret(secretID)
+			},
+		},
+		{
+			Name:   "secretsmanager_json",
+			Params: []ast.Identifier{"secretId", "key"},
+			Func: func(args []interface{}) (interface{}, error) {
+				if len(args) != 2 {
+					return nil, oops.Errorf("secretsmanager_json: invalid arguments length expected 2 got %d", len(args))
+				}
+				secretID, ok := args[0].(string)
+				if !ok {
+					return nil, oops.Errorf("secretsmanager_json: invalid 1st arguments, expected string got %T", args[0])
+				}
+				key, ok := args[1].(string)
+				if !ok {
+					return nil, oops.Errorf("secretsmanager_json: invalid 2nd arguments, expected string got %T", args[1])
+				}
+				str, err := getSecret(secretID)
+				if err != nil {
+					return nil, err
+				}
+				var values map[string]any
+				if err := json.Unmarshal([]byte(str), &values); err != nil {
+					return nil, oops.Wrapf(err, "secretsmanager_json: secret %s is not a JSON object", secretID)
+				}
+				value, ok := values[key]
+				if !ok {
+					return nil, oops.Errorf("secretsmanager_json: key %s not found in secret %s", key, secretID)
+				}
+				return value, nil
+			},
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package cflog2otel_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLoad__JsonnetFeatures(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockSecretsManagerAPIClient(ctrl)
+	client.On("GetSecretValue", mock.Anything, mock.MatchedBy(func(input *secretsmanager.GetSecretValueInput) bool {
+		return *input.SecretId == "otel/api"
+	})).Return(&secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"key": "api-key-value"}`),
+	}, nil).Once()
+	client.On("GetSecretValue", mock.Anything, mock.MatchedBy(func(input *secretsmanager.GetSecretValueInput) bool {
+		return *input.SecretId == "otel/token"
+	})).Return(&secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String("token-value"),
+	}, nil).Once()
+
+	opts := []cflog2otel.JsonnetOption{
+		cflog2otel.WithAWSConfig(aws.Config{}),
+		cflog2otel.WithCache(&sync.Map{}),
+		cflog2otel.WithSecretsManagerClient(client),
+		cflog2otel.WithJPath("testdata/lib"),
+		cflog2otel.WithExtStr("env", "production"),
+		cflog2otel.WithTLAStr("service", "example"),
+	}
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load("testdata/jsonnet_features.jsonnet", opts...))
+	require.Equal(t, "cflog2otel", cfg.Scope.Name)
+	require.Equal(t, map[string]string{"Api-Key": "api-key-value", "Token": "token-value"}, cfg.Otel.Headers)
+	require.Len(t, cfg.ResourceAttributes, 2)
+	require.Len(t, cfg.Metrics, 1)
+	require.Equal(t, "http.server.requests", cfg.Metrics[0].Name)
+
+	vm := cflog2otel.MakeVM(opts...)
+	got, err := vm.EvaluateAnonymousSnippet("cached.jsonnet", `std.native('secretsmanager')('otel/token')`)
+	require.NoError(t, err, "secret is cached by WithCache")
+	require.JSONEq(t, `"token-value"`, got)
+}
+
+func TestMakeVM__SecretsManagerJSONKeyNotFound(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockSecretsManagerAPIClient(ctrl)
+	client.On("GetSecretValue", mock.Anything, mock.Anything).Return(&secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"key": "value"}`),
+	}, nil).Once()
+	vm := cflog2otel.MakeVM(cflog2otel.WithAWSConfig(aws.Config{}), cflog2otel.WithSecretsManagerClient(client))
+	_, err := vm.EvaluateAnonymousSnippet("test.jsonnet", `std.native('secretsmanager_json')('otel/api', 'missing')`)
+	require.ErrorContains(t, err, "key missing not found in secret otel/api")
+}
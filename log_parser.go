@@ -0,0 +1,397 @@
+package cflog2otel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+// LogParser parses a log format into `log` records, so that the same aggregation can be used for other AWS logs.
+// all formats share CELVariablesLog, and each parser populates the fields reported by Schema.
+type LogParser interface {
+	// Name is the format name used in `parse.format`.
+	Name() string
+	// Detect reports whether the object is in the format, by the object key and the head of the decompressed content.
+	Detect(objectKey string, head []byte) bool
+	// Parse returns the iterator of the records. malformed lines are yielded as *ParseLineError,
+	// and the other errors stop the parsing.
+	Parse(ctx context.Context, r io.Reader, cfg ParseConfig) iter.Seq2[CELVariablesLog, error]
+	// Schema returns the CEL-visible `log` fields populated by the parser.
+	Schema() []CELField
+}
+
+const (
+	// LogFormatAuto detects the format of each object by the registered parsers.
+	LogFormatAuto               = "auto"
+	LogFormatCloudFrontStandard = "cloudfront_standard"
+	LogFormatCloudFrontRealtime = "cloudfront_realtime"
+	LogFormatALB                = "alb"
+	LogFormatNLB                = "nlb"
+	LogFormatS3Access           = "s3_access"
+)
+
+var (
+	logParsersMu sync.RWMutex
+	// logParsers are in the order of detection.
+	logParsers []LogParser
+)
+
+func init() {
+	for _, p := range []LogParser{
+		CloudFrontStandardLogParser{},
+		ALBLogParser{},
+		NLBLogParser{},
+		S3AccessLogParser{},
+		CloudFrontRealtimeLogParser{},
+	} {
+		if err := RegisterLogParser(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterLogParser registers the parser for `parse.format`. it must be called before loading the config.
+func RegisterLogParser(p LogParser) error {
+	logParsersMu.Lock()
+	defer logParsersMu.Unlock()
+	name := p.Name()
+	if name == "" || name == LogFormatAuto {
+		return oops.Errorf("invalid log format name %q", name)
+	}
+	if slices.ContainsFunc(logParsers, func(registered LogParser) bool { return registered.Name() == name }) {
+		return oops.Errorf("log format %q is already registered", name)
+	}
+	logParsers = append(logParsers, p)
+	return nil
+}
+
+// LookupLogParser returns the registered parser of the format name.
+func LookupLogParser(name string) (LogParser, bool) {
+	logParsersMu.RLock()
+	defer logParsersMu.RUnlock()
+	idx := slices.IndexFunc(logParsers, func(p LogParser) bool { return p.Name() == name })
+	if idx < 0 {
+		return nil, false
+	}
+	return logParsers[idx], true
+}
+
+// LogParsers returns the registered parsers in the order of detection.
+func LogParsers() []LogParser {
+	logParsersMu.RLock()
+	defer logParsersMu.RUnlock()
+	return slices.Clone(logParsers)
+}
+
+// DetectLogParser returns the first registered parser which detects the object.
+func DetectLogParser(objectKey string, head []byte) (LogParser, bool) {
+	for _, p := range LogParsers() {
+		if p.Detect(objectKey, head) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// detectLogParser detects the parser by the object key and the head of the content.
+// the returned reader reads the content from the beginning.
+func detectLogParser(objectKey string, r io.Reader) (LogParser, io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4096)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, oops.Wrapf(err, "failed to read log")
+	}
+	p, ok := DetectLogParser(objectKey, head)
+	if !ok {
+		return nil, nil, oops.Errorf("unknown log format of %s", objectKey)
+	}
+	return p, br, nil
+}
+
+// ParseLog parses the log with the parser, and handles malformed lines by the `on_error` policy of cfg.
+func ParseLog(ctx context.Context, p LogParser, r io.Reader, cfg ParseConfig) ([]CELVariablesLog, *ParseStats, error) {
+	logs := make([]CELVariablesLog, 0)
+	stats := &ParseStats{}
+	for l, err := range p.Parse(ctx, r, cfg) {
+		var lineErr *ParseLineError
+		if err != nil && !errors.As(err, &lineErr) {
+			return nil, nil, err
+		}
+		stats.TotalLines++
+		if lineErr != nil {
+			if cfg.OnError == ParseErrorPolicyFail {
+				return nil, nil, oops.Wrap(lineErr)
+			}
+			slog.WarnContext(ctx, "skipping malformed log line", "format", p.Name(), "line", lineErr.Line, "field", lineErr.Field, "reason", lineErr.Reason, "error", lineErr.Err)
+			stats.SkippedLines = append(stats.SkippedLines, lineErr)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	if ratio := stats.ErrorRatio(); ratio > cfg.MaxErrorRatioValue() {
+		return nil, nil, oops.Errorf("too many malformed lines: %d of %d lines skipped (ratio %.3f > max_error_ratio %.3f)", len(stats.SkippedLines), stats.TotalLines, ratio, cfg.MaxErrorRatioValue())
+	}
+	return logs, stats, nil
+}
+
+// NewLogSchema returns the schema of the `log` fields by the CEL names, e.g. `scStatus`,
+// and the keys of `log.fields` populated by the parser.
+func NewLogSchema(fields []string, rawFields []string) []CELField {
+	var schema []CELField
+	for _, f := range CELFields() {
+		name, ok := strings.CutPrefix(f.Name, "log.")
+		if !ok || !slices.Contains(fields, name) {
+			continue
+		}
+		schema = append(schema, f)
+	}
+	for _, name := range rawFields {
+		schema = append(schema, CELField{Name: `log.fields["` + name + `"]`, Type: "string", Nullable: true})
+	}
+	return schema
+}
+
+// logSchemaFields returns the CEL names of the typed `log` fields in the schema.
+func logSchemaFields(schema []CELField) []string {
+	var fields []string
+	for _, f := range schema {
+		name, ok := strings.CutPrefix(f.Name, "log.")
+		if !ok || strings.HasPrefix(name, "fields[") {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// splitLogFields splits the space separated line, `"..."` and `[...]` are the single fields without the quotes.
+// `\"` in the quoted field is unescaped.
+func splitLogFields(line string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+		case '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' && j+1 < len(line) && line[j+1] == '"' {
+					j++
+				}
+				b.WriteByte(line[j])
+			}
+			if j >= len(line) {
+				return nil, oops.Errorf("unterminated quoted field at %d", i)
+			}
+			fields = append(fields, b.String())
+			i = j + 1
+		case '[':
+			j := strings.IndexByte(line[i:], ']')
+			if j < 0 {
+				return nil, oops.Errorf("unterminated bracketed field at %d", i)
+			}
+			fields = append(fields, line[i+1:i+j])
+			i += j + 1
+		default:
+			j := strings.IndexByte(line[i:], ' ')
+			if j < 0 {
+				j = len(line) - i
+			}
+			fields = append(fields, line[i:i+j])
+			i += j
+		}
+	}
+	return fields, nil
+}
+
+// positionalLogFormat is the format of the fields without header, e.g. ELB and S3 server access logs.
+type positionalLogFormat struct {
+	logType string
+	// split splits the line into the values.
+	split func(line string) ([]string, error)
+	// minFields is the number of required values. the fields added later may be missing in the older logs,
+	// and the values after the known fields are ignored.
+	minFields int
+	// maxFields is the number of allowed values, if not zero.
+	maxFields int
+	// aliases maps the field name to the one of CloudFront standard logs, which has the same meaning.
+	aliases map[string]string
+	// setters are the format specific setters, preferred over aliases.
+	setters func(l *CELVariablesLog) map[string]func(string) error
+}
+
+func (f positionalLogFormat) parse(ctx context.Context, r io.Reader, fields []string) iter.Seq2[CELVariablesLog, error] {
+	return func(yield func(CELVariablesLog, error) bool) {
+		scanner := bufio.NewScanner(r)
+		lineCount := 0
+		for scanner.Scan() {
+			lineCount++
+			line := scanner.Text()
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			l, lineErr := f.parseLine(ctx, fields, line, lineCount)
+			if lineErr != nil {
+				if !yield(l, lineErr) {
+					return
+				}
+				continue
+			}
+			if !yield(l, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(CELVariablesLog{}, oops.Wrapf(err, "failed to scan log"))
+		}
+	}
+}
+
+func (f positionalLogFormat) parseLine(ctx context.Context, fields []string, line string, lineCount int) (CELVariablesLog, *ParseLineError) {
+	l := CELVariablesLog{
+		Type: f.logType,
+	}
+	values, err := f.split(line)
+	if err != nil {
+		return l, &ParseLineError{
+			Line:   lineCount,
+			Reason: ParseErrorReasonInvalidValue,
+			Err:    err,
+		}
+	}
+	if len(values) < f.minFields {
+		return l, &ParseLineError{
+			Line:   lineCount,
+			Reason: ParseErrorReasonTooFewValues,
+			Err:    fmt.Errorf("this row has less values than required fields, num of values = %d, num of required fields = %d", len(values), f.minFields),
+		}
+	}
+	if f.maxFields > 0 && len(values) > f.maxFields {
+		return l, &ParseLineError{
+			Line:   lineCount,
+			Reason: ParseErrorReasonTooManyValues,
+			Err:    fmt.Errorf("this row has more values then fields, num of values = %d, num of feilds = %d", len(values), f.maxFields),
+		}
+	}
+	l.Fields = make(map[string]string, len(values))
+	cfSetters := l.CloudFrontStandardLogFieldSetters()
+	var setters map[string]func(string) error
+	if f.setters != nil {
+		setters = f.setters(&l)
+	}
+	for i, value := range values {
+		if i >= len(fields) {
+			slog.DebugContext(ctx, "unknown field detected", "index", i, "line", lineCount)
+			break
+		}
+		name := fields[i]
+		if value != "-" && value != "" {
+			l.Fields[name] = value
+		}
+		setter, ok := setters[name]
+		if !ok {
+			setter, ok = cfSetters[f.aliases[name]]
+		}
+		if !ok {
+			continue
+		}
+		if err := setter(value); err != nil {
+			return l, &ParseLineError{
+				Line:   lineCount,
+				Field:  name,
+				Reason: ParseErrorReasonInvalidValue,
+				Err:    fmt.Errorf("failed to set field value: %w", err),
+			}
+		}
+	}
+	if l.Date == "" && !l.Timestamp.IsZero() {
+		l.Date = l.Timestamp.Format("2006-01-02")
+		l.Time = l.Timestamp.Format("15:04:05")
+	}
+	return l, nil
+}
+
+// setTimestamp sets the timestamp in UTC.
+func (l *CELVariablesLog) setTimestamp(layout string, s string) error {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return oops.Wrapf(err, "failed to parse time")
+	}
+	l.Timestamp = t.UTC()
+	return nil
+}
+
+// setClientAddress sets the client IP and port of `ip:port`.
+func (l *CELVariablesLog) setClientAddress(s string) error {
+	if s == "-" {
+		return nil
+	}
+	idx := strings.LastIndexByte(s, ':')
+	if idx < 0 {
+		return oops.Errorf("invalid address %q", s)
+	}
+	ip := strings.Trim(s[:idx], "[]")
+	port, err := strconv.Atoi(s[idx+1:])
+	if err != nil {
+		return oops.Wrapf(err, "invalid port")
+	}
+	l.ClientIP = &ip
+	l.CPort = &port
+	return nil
+}
+
+// setRequestLine sets the method, URI and protocol version of `METHOD URI PROTOCOL`.
+// if URI is absolute, the scheme and host are also set.
+func (l *CELVariablesLog) setRequestLine(s string) error {
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 3)
+	if len(parts) != 3 {
+		if s == "-" {
+			return nil
+		}
+		return oops.Errorf("invalid request line %q", s)
+	}
+	l.CsMethod = toPtrString(parts[0])
+	l.CsProtocolVersion = toPtrString(parts[2])
+	uri := parts[1]
+	if uri == "-" {
+		return nil
+	}
+	if scheme, rest, ok := strings.Cut(uri, "://"); ok {
+		host, path, _ := strings.Cut(rest, "/")
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		l.CsProtocol = &scheme
+		l.CsHost = &host
+		uri = "/" + path
+	}
+	stem, query, hasQuery := strings.Cut(uri, "?")
+	l.CsURIStem = &stem
+	if hasQuery {
+		l.CsURIQuery = &query
+	}
+	return nil
+}
+
+// toPtrSeconds converts the milliseconds to the seconds.
+func toPtrSeconds(ms string) (*float64, error) {
+	v, err := toPtrFloat64(ms)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	seconds := *v / 1000
+	return &seconds, nil
+}
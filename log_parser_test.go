@@ -0,0 +1,248 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLog(t *testing.T) {
+	tests := []struct {
+		format string
+		path   string
+		cfg    cflog2otel.ParseConfig
+		check  func(t *testing.T, logs []cflog2otel.CELVariablesLog)
+	}{
+		{
+			format: cflog2otel.LogFormatALB,
+			path:   "testdata/alb_log.txt",
+			check: func(t *testing.T, logs []cflog2otel.CELVariablesLog) {
+				require.Len(t, logs, 3)
+				l := logs[0]
+				require.Equal(t, "ALB Access Log", l.Type)
+				require.Equal(t, time.Date(2019, 12, 1, 22, 42, 31, 123456000, time.UTC), l.Timestamp)
+				require.Equal(t, "2019-12-01", l.Date)
+				require.Equal(t, "22:42:31", l.Time)
+				require.Equal(t, ptr("192.168.131.39"), l.ClientIP)
+				require.Equal(t, ptr(2817), l.CPort)
+				require.Equal(t, ptr("GET"), l.CsMethod)
+				require.Equal(t, ptr("http"), l.CsProtocol)
+				require.Equal(t, ptr("www.example.com"), l.CsHost)
+				require.Equal(t, ptr("/index.html"), l.CsURIStem)
+				require.Equal(t, ptr("page=1"), l.CsURIQuery)
+				require.Equal(t, ptr("HTTP/1.1"), l.CsProtocolVersion)
+				require.Equal(t, ptr(200), l.ScStatus)
+				require.Equal(t, ptr("2xx"), l.ScStatusCategory)
+				require.Equal(t, ptr(34), l.CsBytes)
+				require.Equal(t, ptr(366), l.ScBytes)
+				require.Equal(t, ptr("curl/7.46.0"), l.CsUserAgent)
+				require.InDelta(t, 0.001, *l.TimeTaken, 1e-9)
+				require.Equal(t, "my-targets/73e2d6bc24d8a067", strings.TrimPrefix(l.Fields["target_group_arn"], "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/"))
+
+				require.Equal(t, ptr(502), logs[1].ScStatus)
+				require.InDelta(t, 0.201, *logs[1].TimeTaken, 1e-9)
+				require.Equal(t, ptr("TLSv1.2"), logs[1].SslProtocol)
+				// not dispatched to the target
+				require.Nil(t, logs[2].TimeTaken)
+				require.Equal(t, ptr("id=1"), logs[2].CsURIQuery)
+			},
+		},
+		{
+			format: cflog2otel.LogFormatNLB,
+			path:   "testdata/nlb_log.txt",
+			check: func(t *testing.T, logs []cflog2otel.CELVariablesLog) {
+				require.Len(t, logs, 2)
+				l := logs[1]
+				require.Equal(t, "NLB Access Log", l.Type)
+				require.Equal(t, time.Date(2019, 12, 1, 22, 42, 33, 0, time.UTC), l.Timestamp)
+				require.Equal(t, ptr("72.21.218.155"), l.ClientIP)
+				require.Equal(t, ptr(51342), l.CPort)
+				require.Equal(t, ptr(120), l.CsBytes)
+				require.Equal(t, ptr(4096), l.ScBytes)
+				require.Equal(t, ptr("tlsv12"), l.SslProtocol)
+				require.InDelta(t, 1.25, *l.TimeTaken, 1e-9)
+				require.Equal(t, "h2", l.Fields["alpn_fe_protocol"])
+				require.NotContains(t, l.Fields, "alpn_client_preference_list")
+			},
+		},
+		{
+			format: cflog2otel.LogFormatS3Access,
+			path:   "testdata/s3_access_log.txt",
+			check: func(t *testing.T, logs []cflog2otel.CELVariablesLog) {
+				require.Len(t, logs, 2)
+				l := logs[0]
+				require.Equal(t, "S3 Server Access Log", l.Type)
+				require.Equal(t, time.Date(2019, 12, 1, 22, 42, 31, 0, time.UTC), l.Timestamp)
+				require.Equal(t, ptr("192.0.2.3"), l.ClientIP)
+				require.Equal(t, ptr("GET"), l.CsMethod)
+				require.Equal(t, ptr("/awsexamplebucket1/images/photo.jpg"), l.CsURIStem)
+				require.Equal(t, ptr("versionId=1"), l.CsURIQuery)
+				require.Equal(t, ptr(200), l.ScStatus)
+				require.Equal(t, ptr(113), l.ScBytes)
+				require.InDelta(t, 0.07, *l.TimeTaken, 1e-9)
+				require.InDelta(t, 0.01, *l.TimeToFirstByte, 1e-9)
+				require.Equal(t, ptr("awsexamplebucket1.s3.us-west-1.amazonaws.com"), l.CsHost)
+				require.Equal(t, "REST.GET.OBJECT", l.Fields["operation"])
+
+				require.Equal(t, ptr("4xx"), logs[1].ScStatusCategory)
+				require.Equal(t, "NoSuchKey", logs[1].Fields["error_code"])
+				require.Nil(t, logs[1].TimeToFirstByte)
+			},
+		},
+		{
+			format: cflog2otel.LogFormatCloudFrontRealtime,
+			path:   "testdata/cf_realtime_log.txt",
+			cfg: cflog2otel.ParseConfig{
+				RealtimeFields: []string{"timestamp", "c-ip", "sc-status", "cs-method", "cs-host", "cs-uri-stem", "x-edge-location", "time-taken"},
+			},
+			check: func(t *testing.T, logs []cflog2otel.CELVariablesLog) {
+				require.Len(t, logs, 2)
+				l := logs[0]
+				require.Equal(t, "CloudFront Real-time Log", l.Type)
+				require.Equal(t, time.Date(2019, 12, 1, 22, 42, 31, 123000000, time.UTC), l.Timestamp)
+				require.Equal(t, "22:42:31", l.Time)
+				require.Equal(t, ptr("192.0.2.100"), l.ClientIP)
+				require.Equal(t, ptr(200), l.ScStatus)
+				require.Equal(t, ptr("d111111abcdef8.cloudfront.net"), l.CsHost)
+				require.Equal(t, ptr("/index.html"), l.CsURIStem)
+				require.Equal(t, ptr("LAX1"), l.EdgeLocation)
+				require.InDelta(t, 0.001, *l.TimeTaken, 1e-9)
+				require.Equal(t, ptr("5xx"), logs[1].ScStatusCategory)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			p, ok := cflog2otel.LookupLogParser(tt.format)
+			require.True(t, ok)
+			f, err := os.Open(tt.path)
+			require.NoError(t, err)
+			defer f.Close()
+			logs, stats, err := cflog2otel.ParseLog(context.Background(), p, f, tt.cfg)
+			require.NoError(t, err)
+			require.Empty(t, stats.SkippedLines)
+			tt.check(t, logs)
+		})
+	}
+}
+
+func TestParseLog__Malformed(t *testing.T) {
+	p, ok := cflog2otel.LookupLogParser(cflog2otel.LogFormatALB)
+	require.True(t, ok)
+	input := "http 2019-12-01T22:42:31.123456Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817\n" +
+		"http invalid-time app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 \"GET http://www.example.com:80/ HTTP/1.1\"\n"
+	_, stats, err := cflog2otel.ParseLog(context.Background(), p, strings.NewReader(input), cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicySkip})
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.TotalLines)
+	require.Len(t, stats.SkippedLines, 2)
+	require.Equal(t, cflog2otel.ParseErrorReasonTooFewValues, stats.SkippedLines[0].Reason)
+	require.Equal(t, cflog2otel.ParseErrorReasonInvalidValue, stats.SkippedLines[1].Reason)
+	require.Equal(t, "time", stats.SkippedLines[1].Field)
+
+	_, _, err = cflog2otel.ParseLog(context.Background(), p, strings.NewReader(input), cflog2otel.ParseConfig{OnError: cflog2otel.ParseErrorPolicyFail})
+	require.ErrorContains(t, err, "line 1: too_few_values")
+}
+
+func TestDetectLogParser(t *testing.T) {
+	head := func(path string) []byte {
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return bs
+	}
+	tests := []struct {
+		name      string
+		objectKey string
+		head      []byte
+		want      string
+	}{
+		{
+			name:      "cloudfront standard",
+			objectKey: "logs/E2K2LNL5N3WR51.2019-12-01-22.abcdef12.gz",
+			head:      head("testdata/cf_log.txt"),
+			want:      cflog2otel.LogFormatCloudFrontStandard,
+		},
+		{
+			name:      "alb by key",
+			objectKey: "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2019/12/01/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20191201T2245Z_192.0.2.1_2soosksi.log.gz",
+			want:      cflog2otel.LogFormatALB,
+		},
+		{
+			name: "alb by content",
+			head: head("testdata/alb_log.txt"),
+			want: cflog2otel.LogFormatALB,
+		},
+		{
+			name:      "nlb by key",
+			objectKey: "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2019/12/01/123456789012_elasticloadbalancing_us-east-2_net.my-network-loadbalancer.c6e77e28c25b2234_20191201T2245Z_3c9e1c1b.log.gz",
+			want:      cflog2otel.LogFormatNLB,
+		},
+		{
+			name: "nlb by content",
+			head: head("testdata/nlb_log.txt"),
+			want: cflog2otel.LogFormatNLB,
+		},
+		{
+			name:      "s3 access by key",
+			objectKey: "s3-access/2019-12-01-22-42-31-7E4B8E9D3D1A2B3C",
+			want:      cflog2otel.LogFormatS3Access,
+		},
+		{
+			name: "s3 access by content",
+			head: head("testdata/s3_access_log.txt"),
+			want: cflog2otel.LogFormatS3Access,
+		},
+		{
+			name: "cloudfront realtime",
+			head: head("testdata/cf_realtime_log.txt"),
+			want: cflog2otel.LogFormatCloudFrontRealtime,
+		},
+		{
+			name:      "unknown",
+			objectKey: "logs/unknown.txt",
+			head:      []byte("hello world\n"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := cflog2otel.DetectLogParser(tt.objectKey, tt.head)
+			if tt.want == "" {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tt.want, p.Name())
+		})
+	}
+}
+
+func TestRegisterLogParser(t *testing.T) {
+	err := cflog2otel.RegisterLogParser(cflog2otel.ALBLogParser{})
+	require.ErrorContains(t, err, `log format "alb" is already registered`)
+}
+
+func TestLogParserSchema(t *testing.T) {
+	for _, p := range cflog2otel.LogParsers() {
+		t.Run(p.Name(), func(t *testing.T) {
+			names := make(map[string]bool)
+			for _, f := range p.Schema() {
+				names[f.Name] = true
+			}
+			require.True(t, names["log.timestamp"], "log.timestamp is always populated")
+			require.True(t, names["log.type"])
+		})
+	}
+	p, ok := cflog2otel.LookupLogParser(cflog2otel.LogFormatALB)
+	require.True(t, ok)
+	var names []string
+	for _, f := range p.Schema() {
+		names = append(names, f.Name)
+	}
+	require.Contains(t, names, "log.scStatus")
+	require.Contains(t, names, `log.fields["target_group_arn"]`)
+	require.NotContains(t, names, "log.xEdgeLocation")
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/mashiike/cflog2otel"
 	"github.com/stretchr/testify/mock"
 )
@@ -68,3 +71,153 @@ func (m *mockS3APIClient) ListObjectsV2(ctx context.Context, input *s3.ListObjec
 	m.tb.Errorf("unexpected type %T", output)
 	return nil, ret.Error(1)
 }
+
+func (m *mockS3APIClient) HeadObject(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("HeadObject", "bucket", *input.Bucket, "key", *input.Key)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*s3.HeadObjectOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+func (m *mockS3APIClient) GetObjectTagging(ctx context.Context, input *s3.GetObjectTaggingInput, opts ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("GetObjectTagging", "bucket", *input.Bucket, "key", *input.Key)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*s3.GetObjectTaggingOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+func (m *mockS3APIClient) GetBucketTagging(ctx context.Context, input *s3.GetBucketTaggingInput, opts ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("GetBucketTagging", "bucket", *input.Bucket)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*s3.GetBucketTaggingOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+type mockCloudFrontAPIClient struct {
+	mock.Mock
+	tb testing.TB
+}
+
+func newMockCloudFrontAPIClient(ctrl *mockControler) *mockCloudFrontAPIClient {
+	m := &mockCloudFrontAPIClient{
+		tb: ctrl.tb,
+	}
+	ctrl.objects = append(ctrl.objects, m)
+	return m
+}
+
+var _ cflog2otel.CloudFrontAPIClient = (*mockCloudFrontAPIClient)(nil)
+
+func (m *mockCloudFrontAPIClient) GetDistribution(ctx context.Context, input *cloudfront.GetDistributionInput, opts ...func(*cloudfront.Options)) (*cloudfront.GetDistributionOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("GetDistribution", "id", *input.Id)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*cloudfront.GetDistributionOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+func (m *mockCloudFrontAPIClient) ListTagsForResource(ctx context.Context, input *cloudfront.ListTagsForResourceInput, opts ...func(*cloudfront.Options)) (*cloudfront.ListTagsForResourceOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("ListTagsForResource", "resource", *input.Resource)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*cloudfront.ListTagsForResourceOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+type mockSecretsManagerAPIClient struct {
+	mock.Mock
+	tb testing.TB
+}
+
+func newMockSecretsManagerAPIClient(ctrl *mockControler) *mockSecretsManagerAPIClient {
+	m := &mockSecretsManagerAPIClient{
+		tb: ctrl.tb,
+	}
+	ctrl.objects = append(ctrl.objects, m)
+	return m
+}
+
+var _ cflog2otel.SecretsManagerAPIClient = (*mockSecretsManagerAPIClient)(nil)
+
+func (m *mockSecretsManagerAPIClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, opts ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("GetSecretValue", "secret_id", *input.SecretId)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*secretsmanager.GetSecretValueOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
+
+type mockSSMAPIClient struct {
+	mock.Mock
+	tb testing.TB
+}
+
+func newMockSSMAPIClient(ctrl *mockControler) *mockSSMAPIClient {
+	m := &mockSSMAPIClient{
+		tb: ctrl.tb,
+	}
+	ctrl.objects = append(ctrl.objects, m)
+	return m
+}
+
+var _ cflog2otel.SSMAPIClient = (*mockSSMAPIClient)(nil)
+
+func (m *mockSSMAPIClient) GetParameter(ctx context.Context, input *ssm.GetParameterInput, opts ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	m.tb.Helper()
+	m.tb.Log("GetParameter", "name", *input.Name)
+	ret := m.Called(ctx, input)
+	output := ret.Get(0)
+	if output == nil {
+		return nil, ret.Error(1)
+	}
+	if o, ok := output.(*ssm.GetParameterOutput); ok {
+		return o, ret.Error(1)
+	}
+	m.tb.Errorf("unexpected type %T", output)
+	return nil, ret.Error(1)
+}
@@ -0,0 +1,96 @@
+package cflog2otel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/samber/oops"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// PartialSuccessError is returned by the export if the backend rejected a part of the data points,
+// and `otel.on_partial_success` is `fail`.
+type PartialSuccessError struct {
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+func (e *PartialSuccessError) Error() string {
+	return fmt.Sprintf("partial success: %d data points rejected: %s", e.RejectedDataPoints, e.ErrorMessage)
+}
+
+// otelExporter is the OTLP exporter which handles the partial success according to the policy.
+type otelExporter struct {
+	*otlpmetricgrpc.Exporter
+	onPartialSuccess PartialSuccessPolicy
+}
+
+func newOtelExporter(ctx context.Context, oc OtelConfig) (*otelExporter, string, error) {
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithDialOption(grpc.WithUnaryInterceptor(partialSuccessInterceptor)),
+	}
+	if len(oc.Headers) > 0 {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(oc.Headers))
+	}
+	if oc.GZip {
+		opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+	}
+	if oc.Retry != nil {
+		opts = append(opts, otlpmetricgrpc.WithRetry(oc.Retry.retryConfig()))
+	}
+	endpointURL := oc.EndpointURL().String()
+	opts = append(opts, otlpmetricgrpc.WithEndpointURL(endpointURL))
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return &otelExporter{Exporter: exporter, onPartialSuccess: oc.OnPartialSuccess}, endpointURL, nil
+}
+
+type partialSuccessKey struct{}
+
+// partialSuccessInterceptor records the partial success of the response to the context,
+// because the exporter passes it to the global error handler instead of returning.
+func partialSuccessInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err != nil {
+		return err
+	}
+	ps, ok := ctx.Value(partialSuccessKey{}).(*PartialSuccessError)
+	if !ok {
+		return nil
+	}
+	if resp, ok := reply.(*collectormetrics.ExportMetricsServiceResponse); ok && resp.GetPartialSuccess() != nil {
+		ps.RejectedDataPoints = resp.GetPartialSuccess().GetRejectedDataPoints()
+		ps.ErrorMessage = resp.GetPartialSuccess().GetErrorMessage()
+	}
+	return nil
+}
+
+func (e *otelExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	ps := &PartialSuccessError{}
+	if err := e.Exporter.Export(context.WithValue(ctx, partialSuccessKey{}, ps), rm); err != nil {
+		return err
+	}
+	if ps.RejectedDataPoints == 0 && ps.ErrorMessage == "" {
+		return nil
+	}
+	if e.onPartialSuccess == PartialSuccessPolicyFail {
+		return oops.Wrap(ps)
+	}
+	slog.WarnContext(ctx, "metrics partially rejected", "rejected_data_points", ps.RejectedDataPoints, "error_message", ps.ErrorMessage)
+	return nil
+}
+
+func (c *OtelRetryConfig) retryConfig() otlpmetricgrpc.RetryConfig {
+	return otlpmetricgrpc.RetryConfig{
+		Enabled:         *c.Enabled,
+		InitialInterval: c.initialInterval,
+		MaxInterval:     c.maxInterval,
+		MaxElapsedTime:  c.maxElapsedTime,
+	}
+}
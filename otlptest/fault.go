@@ -0,0 +1,123 @@
+package otlptest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Option configures the collectors.
+type Option func(*options)
+
+type options struct {
+	faults []Fault
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithFaults scripts the responses of the collector, the n-th request gets the n-th fault.
+// the requests after the script are passed to the exporter as usual.
+func WithFaults(faults ...Fault) Option {
+	return func(o *options) {
+		o.faults = append(o.faults, faults...)
+	}
+}
+
+// Fault is the scripted response for a request.
+type Fault struct {
+	// Delay is the time to wait before responding. the wait is canceled with the request.
+	Delay time.Duration
+	// Code is the status code of the error response. if codes.OK, the request is passed to the exporter.
+	Code    codes.Code
+	Message string
+	// RejectedDataPoints and ErrorMessage are set to the partial success of the response, if Code is codes.OK.
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+// Unavailable returns the fault of UNAVAILABLE, which is retryable by the exporters.
+func Unavailable() Fault {
+	return Fault{Code: codes.Unavailable, Message: "unavailable"}
+}
+
+// ResourceExhausted returns the fault of RESOURCE_EXHAUSTED.
+func ResourceExhausted() Fault {
+	return Fault{Code: codes.ResourceExhausted, Message: "resource exhausted"}
+}
+
+// PartialSuccess returns the fault which accepts the request, but reports the rejected data points.
+func PartialSuccess(rejectedDataPoints int64, errorMessage string) Fault {
+	return Fault{RejectedDataPoints: rejectedDataPoints, ErrorMessage: errorMessage}
+}
+
+// Slow returns the fault which accepts the request after the delay.
+func Slow(delay time.Duration) Fault {
+	return Fault{Delay: delay}
+}
+
+// faultInjector is the Exporter which responds with the scripted faults, before the exporter.
+type faultInjector struct {
+	exporter Exporter
+
+	mu     sync.Mutex
+	faults []Fault
+}
+
+func withFaultInjector(exporter Exporter, faults []Fault) Exporter {
+	if len(faults) == 0 {
+		return exporter
+	}
+	return &faultInjector{exporter: exporter, faults: faults}
+}
+
+func (fi *faultInjector) next() (Fault, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(fi.faults) == 0 {
+		return Fault{}, false
+	}
+	f := fi.faults[0]
+	fi.faults = fi.faults[1:]
+	return f, true
+}
+
+func (fi *faultInjector) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	f, ok := fi.next()
+	if !ok {
+		return fi.exporter.Export(ctx, req)
+	}
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if f.Code != codes.OK {
+		return nil, status.Error(f.Code, f.Message)
+	}
+	resp, err := fi.exporter.Export(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if f.RejectedDataPoints != 0 || f.ErrorMessage != "" {
+		if resp == nil {
+			resp = &collectormetrics.ExportMetricsServiceResponse{}
+		}
+		resp.PartialSuccess = &collectormetrics.ExportMetricsPartialSuccess{
+			RejectedDataPoints: f.RejectedDataPoints,
+			ErrorMessage:       f.ErrorMessage,
+		}
+	}
+	return resp, nil
+}
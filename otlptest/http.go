@@ -0,0 +1,151 @@
+package otlptest
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// MetricsPath is the default URL path of OTLP/HTTP metrics.
+const MetricsPath = "/v1/metrics"
+
+// HTTPMetricsCollector is the OTLP/HTTP variant of MetricsCollector.
+// it accepts both binary protobuf and JSON encoded requests at MetricsPath, and gzip content encoding.
+type HTTPMetricsCollector struct {
+	URL    string
+	server *httptest.Server
+}
+
+func NewHTTPMetricsCollector(exporter Exporter, opts ...Option) *HTTPMetricsCollector {
+	server := NewUnstartedHTTPMetricsCollector(exporter, opts...)
+	server.Start()
+	return server
+}
+
+func NewUnstartedHTTPMetricsCollector(exporter Exporter, opts ...Option) *HTTPMetricsCollector {
+	o := newOptions(opts)
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, &metricsHandler{exporter: withFaultInjector(exporter, o.faults)})
+	return &HTTPMetricsCollector{
+		server: httptest.NewUnstartedServer(mux),
+	}
+}
+
+func (mc *HTTPMetricsCollector) Start() {
+	if mc.URL != "" {
+		panic("Server already started")
+	}
+	mc.server.Start()
+	mc.URL = mc.server.URL
+}
+
+func (mc *HTTPMetricsCollector) Close() {
+	mc.server.Close()
+}
+
+type metricsHandler struct {
+	exporter Exporter
+}
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeStatus(w, contentType, status.New(codes.InvalidArgument, err.Error()))
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+	bs, err := io.ReadAll(body)
+	if err != nil {
+		writeStatus(w, contentType, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+	req := &collectormetrics.ExportMetricsServiceRequest{}
+	switch contentType {
+	case contentTypeJSON:
+		err = protojson.Unmarshal(bs, req)
+	case contentTypeProtobuf:
+		err = proto.Unmarshal(bs, req)
+	default:
+		http.Error(w, "unsupported content type: "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		writeStatus(w, contentType, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+	resp, err := h.exporter.Export(r.Context(), req)
+	if err != nil {
+		writeStatus(w, contentType, status.Convert(err))
+		return
+	}
+	if resp == nil {
+		resp = &collectormetrics.ExportMetricsServiceResponse{}
+	}
+	writeMessage(w, contentType, http.StatusOK, resp)
+}
+
+// writeStatus writes the error response, the HTTP status code is mapped from the gRPC code as OTLP/HTTP specification.
+func writeStatus(w http.ResponseWriter, contentType string, s *status.Status) {
+	code := http.StatusInternalServerError
+	switch s.Code() {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	}
+	writeMessage(w, contentType, code, s.Proto())
+}
+
+func writeMessage(w http.ResponseWriter, contentType string, code int, m proto.Message) {
+	var (
+		bs  []byte
+		err error
+	)
+	if contentType == contentTypeJSON {
+		bs, err = protojson.Marshal(m)
+	} else {
+		contentType = contentTypeProtobuf
+		bs, err = proto.Marshal(m)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	if _, err := w.Write(bs); err != nil {
+		slog.Error("Failed to write response", "error", err)
+	}
+}
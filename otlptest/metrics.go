@@ -60,14 +60,15 @@ func NewExporterWithWriter(w io.Writer) Exporter {
 	})
 }
 
-func NewMetricsCollector(exporter Exporter) *MetricsCollector {
-	server := NewUnstartedMetricsCollector(exporter)
+func NewMetricsCollector(exporter Exporter, opts ...Option) *MetricsCollector {
+	server := NewUnstartedMetricsCollector(exporter, opts...)
 	server.Start()
 	return server
 }
 
-func NewUnstartedMetricsCollector(exporter Exporter) *MetricsCollector {
-	serviceServer := newServiceServer(exporter)
+func NewUnstartedMetricsCollector(exporter Exporter, opts ...Option) *MetricsCollector {
+	o := newOptions(opts)
+	serviceServer := newServiceServer(withFaultInjector(exporter, o.faults))
 	server := grpc.NewServer()
 	collectormetrics.RegisterMetricsServiceServer(server, serviceServer)
 	return &MetricsCollector{
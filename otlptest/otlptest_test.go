@@ -0,0 +1,226 @@
+package otlptest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mashiike/cflog2otel/otlptest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func intDataPoint(value int64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, Value: &metricspb.NumberDataPoint_AsInt{AsInt: value}}
+}
+
+func newRequest() *collectormetrics.ExportMetricsServiceRequest {
+	return &collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{stringAttr("service.name", "Amazon CloudFront"), stringAttr("aws.region", "us-east-1")},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{
+						Metrics: []*metricspb.Metric{
+							{
+								Name: "http.server.requests",
+								Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+									DataPoints: []*metricspb.NumberDataPoint{
+										intDataPoint(3, stringAttr("status", "2xx"), stringAttr("method", "GET")),
+										intDataPoint(2, stringAttr("status", "5xx"), stringAttr("method", "GET")),
+										intDataPoint(1, stringAttr("status", "2xx"), stringAttr("method", "POST")),
+									},
+								}},
+							},
+							{
+								Name: "http.server.duration",
+								Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+									DataPoints: []*metricspb.HistogramDataPoint{
+										{Attributes: []*commonpb.KeyValue{stringAttr("status", "2xx")}, Count: 2, Sum: proto.Float64(0.5)},
+									},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestHTTPMetricsCollector(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		marshal     func(proto.Message) ([]byte, error)
+		gzip        bool
+	}{
+		{name: "protobuf", contentType: "application/x-protobuf", marshal: proto.Marshal},
+		{name: "json", contentType: "application/json", marshal: protojson.Marshal},
+		{name: "gzip", contentType: "application/x-protobuf", marshal: proto.Marshal, gzip: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := otlptest.NewRecorder()
+			server := otlptest.NewHTTPMetricsCollector(recorder)
+			defer server.Close()
+
+			bs, err := c.marshal(newRequest())
+			require.NoError(t, err)
+			if c.gzip {
+				var buf bytes.Buffer
+				gw := gzip.NewWriter(&buf)
+				_, err := gw.Write(bs)
+				require.NoError(t, err)
+				require.NoError(t, gw.Close())
+				bs = buf.Bytes()
+			}
+			req, err := http.NewRequest(http.MethodPost, server.URL+otlptest.MetricsPath, bytes.NewReader(bs))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", c.contentType)
+			if c.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, c.contentType, resp.Header.Get("Content-Type"))
+
+			reqs := recorder.Requests()
+			require.Len(t, reqs, 1)
+			otlptest.AssertEqual(t, newRequest(), reqs[0])
+		})
+	}
+}
+
+func TestHTTPMetricsCollector__Error(t *testing.T) {
+	server := otlptest.NewHTTPMetricsCollector(otlptest.ExporterFunc(
+		func(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+			return nil, status.Error(codes.Unavailable, "try later")
+		},
+	))
+	defer server.Close()
+	bs, err := proto.Marshal(newRequest())
+	require.NoError(t, err)
+	resp, err := http.Post(server.URL+otlptest.MetricsPath, "application/x-protobuf", bytes.NewReader(bs))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+otlptest.MetricsPath, "text/plain", bytes.NewReader(bs))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func TestSumDataPoints(t *testing.T) {
+	reqs := []*collectormetrics.ExportMetricsServiceRequest{newRequest(), newRequest()}
+	metrics := otlptest.FindMetrics(reqs, "http.server.requests")
+	require.Len(t, metrics, 2)
+	require.EqualValues(t, 12, otlptest.SumDataPoints(metrics))
+	require.EqualValues(t, 8, otlptest.SumDataPoints(metrics, attribute.String("status", "2xx")))
+	require.EqualValues(t, 2, otlptest.SumDataPoints(metrics, attribute.String("status", "2xx"), attribute.String("method", "POST")))
+	require.EqualValues(t, 0, otlptest.SumDataPoints(metrics, attribute.Int("status", 200)))
+	require.EqualValues(t, 1, otlptest.SumDataPoints(otlptest.FindMetrics(reqs, "http.server.duration")))
+	require.Empty(t, otlptest.FindMetrics(reqs, "unknown"))
+	otlptest.AssertSum(t, reqs, "http.server.requests", 4, attribute.String("status", "5xx"))
+}
+
+type fakeT struct {
+	errors int
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(string, ...any) { t.errors++ }
+
+func TestEqual__IgnoreAttributeOrder(t *testing.T) {
+	expected := newRequest()
+	actual := newRequest()
+	attrs := actual.ResourceMetrics[0].Resource.Attributes
+	attrs[0], attrs[1] = attrs[1], attrs[0]
+	dps := actual.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints
+	dps[0].Attributes[0], dps[0].Attributes[1] = dps[0].Attributes[1], dps[0].Attributes[0]
+	require.True(t, otlptest.Equal(expected, actual))
+	// Normalize does not modify the original request.
+	require.Equal(t, "aws.region", actual.ResourceMetrics[0].Resource.Attributes[0].Key)
+
+	dps[1].Value = &metricspb.NumberDataPoint_AsInt{AsInt: 3}
+	require.False(t, otlptest.Equal(expected, actual))
+	ft := &fakeT{}
+	require.False(t, otlptest.AssertEqual(ft, expected, actual))
+	require.Equal(t, 1, ft.errors)
+	require.False(t, otlptest.AssertSum(ft, []*collectormetrics.ExportMetricsServiceRequest{actual}, "unknown", 0))
+	require.Equal(t, 2, ft.errors)
+}
+
+func TestWithFaults(t *testing.T) {
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewHTTPMetricsCollector(recorder, otlptest.WithFaults(
+		otlptest.Unavailable(),
+		otlptest.ResourceExhausted(),
+		otlptest.PartialSuccess(3, "invalid data points"),
+		otlptest.Slow(time.Second),
+	))
+	defer server.Close()
+	bs, err := proto.Marshal(newRequest())
+	require.NoError(t, err)
+	post := func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+otlptest.MetricsPath, bytes.NewReader(bs))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := post(context.Background())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = post(context.Background())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	resp, err = post(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	var exportResp collectormetrics.ExportMetricsServiceResponse
+	require.NoError(t, proto.Unmarshal(body, &exportResp))
+	require.EqualValues(t, 3, exportResp.GetPartialSuccess().GetRejectedDataPoints())
+	require.Equal(t, "invalid data points", exportResp.GetPartialSuccess().GetErrorMessage())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = post(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the requests after the script are accepted.
+	resp, err = post(context.Background())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, recorder.Requests(), 2, "partial success and the last request")
+}
@@ -0,0 +1,165 @@
+package otlptest
+
+import (
+	"cmp"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// FindMetrics returns the metrics of the name in the requests.
+func FindMetrics(reqs []*collectormetrics.ExportMetricsServiceRequest, name string) []*metricspb.Metric {
+	var metrics []*metricspb.Metric
+	for _, req := range reqs {
+		for _, rm := range req.GetResourceMetrics() {
+			for _, sm := range rm.GetScopeMetrics() {
+				for _, m := range sm.GetMetrics() {
+					if m.GetName() == name {
+						metrics = append(metrics, m)
+					}
+				}
+			}
+		}
+	}
+	return metrics
+}
+
+// SumDataPoints returns the total of the data points which have all the attributes.
+// the value of a sum or gauge data point, and the sum of a histogram data point are added.
+func SumDataPoints(metrics []*metricspb.Metric, attrs ...attribute.KeyValue) float64 {
+	var total float64
+	for _, m := range metrics {
+		var dps []*metricspb.NumberDataPoint
+		switch data := m.GetData().(type) {
+		case *metricspb.Metric_Sum:
+			dps = data.Sum.GetDataPoints()
+		case *metricspb.Metric_Gauge:
+			dps = data.Gauge.GetDataPoints()
+		case *metricspb.Metric_Histogram:
+			for _, dp := range data.Histogram.GetDataPoints() {
+				if hasAttributes(dp.GetAttributes(), attrs) {
+					total += dp.GetSum()
+				}
+			}
+		}
+		for _, dp := range dps {
+			if !hasAttributes(dp.GetAttributes(), attrs) {
+				continue
+			}
+			switch v := dp.GetValue().(type) {
+			case *metricspb.NumberDataPoint_AsInt:
+				total += float64(v.AsInt)
+			case *metricspb.NumberDataPoint_AsDouble:
+				total += v.AsDouble
+			}
+		}
+	}
+	return total
+}
+
+func hasAttributes(kvs []*commonpb.KeyValue, attrs []attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		idx := slices.IndexFunc(kvs, func(kv *commonpb.KeyValue) bool {
+			return kv.GetKey() == string(attr.Key)
+		})
+		if idx < 0 || !equalValue(kvs[idx].GetValue(), attr.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValue(v *commonpb.AnyValue, want attribute.Value) bool {
+	switch want.Type() {
+	case attribute.STRING:
+		s, ok := v.GetValue().(*commonpb.AnyValue_StringValue)
+		return ok && s.StringValue == want.AsString()
+	case attribute.BOOL:
+		b, ok := v.GetValue().(*commonpb.AnyValue_BoolValue)
+		return ok && b.BoolValue == want.AsBool()
+	case attribute.INT64:
+		i, ok := v.GetValue().(*commonpb.AnyValue_IntValue)
+		return ok && i.IntValue == want.AsInt64()
+	case attribute.FLOAT64:
+		f, ok := v.GetValue().(*commonpb.AnyValue_DoubleValue)
+		return ok && f.DoubleValue == want.AsFloat64()
+	default:
+		return false
+	}
+}
+
+// Normalize returns the copy of the request, with the attributes sorted by key.
+func Normalize(req *collectormetrics.ExportMetricsServiceRequest) *collectormetrics.ExportMetricsServiceRequest {
+	req = proto.Clone(req).(*collectormetrics.ExportMetricsServiceRequest)
+	for _, rm := range req.GetResourceMetrics() {
+		sortAttributes(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			sortAttributes(sm.GetScope().GetAttributes())
+			for _, m := range sm.GetMetrics() {
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Sum:
+					for _, dp := range data.Sum.GetDataPoints() {
+						sortAttributes(dp.GetAttributes())
+					}
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						sortAttributes(dp.GetAttributes())
+					}
+				case *metricspb.Metric_Histogram:
+					for _, dp := range data.Histogram.GetDataPoints() {
+						sortAttributes(dp.GetAttributes())
+					}
+				}
+			}
+		}
+	}
+	return req
+}
+
+func sortAttributes(kvs []*commonpb.KeyValue) {
+	slices.SortStableFunc(kvs, func(a, b *commonpb.KeyValue) int {
+		return cmp.Compare(a.GetKey(), b.GetKey())
+	})
+}
+
+// Equal reports whether the requests are equal, ignoring the order of attributes.
+func Equal(expected, actual *collectormetrics.ExportMetricsServiceRequest) bool {
+	return proto.Equal(Normalize(expected), Normalize(actual))
+}
+
+// TestingT is the subset of testing.TB used by the assertion helpers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertEqual reports the error to t if the requests are not equal, ignoring the order of attributes.
+func AssertEqual(t TestingT, expected, actual *collectormetrics.ExportMetricsServiceRequest) bool {
+	t.Helper()
+	if Equal(expected, actual) {
+		return true
+	}
+	opts := protojson.MarshalOptions{Multiline: true}
+	t.Errorf("requests are not equal\nexpected:\n%s\nactual:\n%s", opts.Format(Normalize(expected)), opts.Format(Normalize(actual)))
+	return false
+}
+
+// AssertSum reports the error to t if the total of the data points of the metric is not the expected value.
+func AssertSum(t TestingT, reqs []*collectormetrics.ExportMetricsServiceRequest, name string, expected float64, attrs ...attribute.KeyValue) bool {
+	t.Helper()
+	metrics := FindMetrics(reqs, name)
+	if len(metrics) == 0 {
+		t.Errorf("metric %q not found", name)
+		return false
+	}
+	if actual := SumDataPoints(metrics, attrs...); actual != expected {
+		t.Errorf("sum of metric %q with %v: expected %v, actual %v", name, attrs, expected, actual)
+		return false
+	}
+	return true
+}
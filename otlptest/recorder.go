@@ -0,0 +1,47 @@
+package otlptest
+
+import (
+	"context"
+	"sync"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Recorder is the Exporter which stores all received requests.
+type Recorder struct {
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// Requests returns the received requests in the order of arrival.
+func (r *Recorder) Requests() []*collectormetrics.ExportMetricsServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reqs := make([]*collectormetrics.ExportMetricsServiceRequest, len(r.requests))
+	copy(reqs, r.requests)
+	return reqs
+}
+
+// Metrics returns the metrics of the name in all received requests.
+func (r *Recorder) Metrics(name string) []*metricspb.Metric {
+	return FindMetrics(r.Requests(), name)
+}
+
+// Reset discards the received requests.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
@@ -0,0 +1,10 @@
+package cflog2otel
+
+type ParseErrorPolicy int
+
+//go:generate enumer -type=ParseErrorPolicy -trimprefix=ParseErrorPolicy -transform=snake -json -text
+const (
+	ParseErrorPolicyFail ParseErrorPolicy = iota
+	ParseErrorPolicySkip
+	ParseErrorPolicySkipAndCount
+)
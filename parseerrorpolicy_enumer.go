@@ -0,0 +1,115 @@
+// Code generated by "enumer -type=ParseErrorPolicy -trimprefix=ParseErrorPolicy -transform=snake -json -text"; DO NOT EDIT.
+
+package cflog2otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const _ParseErrorPolicyName = "failskipskip_and_count"
+
+var _ParseErrorPolicyIndex = [...]uint8{0, 4, 8, 22}
+
+const _ParseErrorPolicyLowerName = "failskipskip_and_count"
+
+func (i ParseErrorPolicy) String() string {
+	if i < 0 || i >= ParseErrorPolicy(len(_ParseErrorPolicyIndex)-1) {
+		return fmt.Sprintf("ParseErrorPolicy(%d)", i)
+	}
+	return _ParseErrorPolicyName[_ParseErrorPolicyIndex[i]:_ParseErrorPolicyIndex[i+1]]
+}
+
+// An "invalid array index" compiler error signifies that the constant values have changed.
+// Re-run the stringer command to generate them again.
+func _ParseErrorPolicyNoOp() {
+	var x [1]struct{}
+	_ = x[ParseErrorPolicyFail-(0)]
+	_ = x[ParseErrorPolicySkip-(1)]
+	_ = x[ParseErrorPolicySkipAndCount-(2)]
+}
+
+var _ParseErrorPolicyValues = []ParseErrorPolicy{ParseErrorPolicyFail, ParseErrorPolicySkip, ParseErrorPolicySkipAndCount}
+
+var _ParseErrorPolicyNameToValueMap = map[string]ParseErrorPolicy{
+	_ParseErrorPolicyName[0:4]:  ParseErrorPolicyFail,
+	_ParseErrorPolicyName[4:8]:  ParseErrorPolicySkip,
+	_ParseErrorPolicyName[8:22]: ParseErrorPolicySkipAndCount,
+}
+
+var _ParseErrorPolicyLowerNameToValueMap = map[string]ParseErrorPolicy{
+	_ParseErrorPolicyLowerName[0:4]:  ParseErrorPolicyFail,
+	_ParseErrorPolicyLowerName[4:8]:  ParseErrorPolicySkip,
+	_ParseErrorPolicyLowerName[8:22]: ParseErrorPolicySkipAndCount,
+}
+
+var _ParseErrorPolicyNames = []string{
+	_ParseErrorPolicyName[0:4],
+	_ParseErrorPolicyName[4:8],
+	_ParseErrorPolicyName[8:22],
+}
+
+// ParseErrorPolicyString retrieves an enum value from the enum constants string name.
+// Throws an error if the param is not part of the enum.
+func ParseErrorPolicyString(s string) (ParseErrorPolicy, error) {
+	if val, ok := _ParseErrorPolicyNameToValueMap[s]; ok {
+		return val, nil
+	}
+
+	if val, ok := _ParseErrorPolicyLowerNameToValueMap[strings.ToLower(s)]; ok {
+		return val, nil
+	}
+	return 0, fmt.Errorf("%s does not belong to ParseErrorPolicy values", s)
+}
+
+// ParseErrorPolicyValues returns all values of the enum
+func ParseErrorPolicyValues() []ParseErrorPolicy {
+	return _ParseErrorPolicyValues
+}
+
+// ParseErrorPolicyStrings returns a slice of all String values of the enum
+func ParseErrorPolicyStrings() []string {
+	strs := make([]string, len(_ParseErrorPolicyNames))
+	copy(strs, _ParseErrorPolicyNames)
+	return strs
+}
+
+// IsAParseErrorPolicy returns "true" if the value is listed in the enum definition. "false" otherwise
+func (i ParseErrorPolicy) IsAParseErrorPolicy() bool {
+	for _, v := range _ParseErrorPolicyValues {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface for ParseErrorPolicy
+func (i ParseErrorPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for ParseErrorPolicy
+func (i *ParseErrorPolicy) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("ParseErrorPolicy should be a string, got %s", data)
+	}
+
+	var err error
+	*i, err = ParseErrorPolicyString(s)
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for ParseErrorPolicy
+func (i ParseErrorPolicy) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for ParseErrorPolicy
+func (i *ParseErrorPolicy) UnmarshalText(text []byte) error {
+	var err error
+	*i, err = ParseErrorPolicyString(string(text))
+	return err
+}
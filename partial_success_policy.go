@@ -0,0 +1,12 @@
+package cflog2otel
+
+// PartialSuccessPolicy is how to handle the partial success response of the OTLP export.
+type PartialSuccessPolicy int
+
+//go:generate enumer -type=PartialSuccessPolicy -trimprefix=PartialSuccessPolicy -transform=snake -json -text
+const (
+	// PartialSuccessPolicyWarn logs the rejected data points as a warning.
+	PartialSuccessPolicyWarn PartialSuccessPolicy = iota
+	// PartialSuccessPolicyFail returns PartialSuccessError.
+	PartialSuccessPolicyFail
+)
@@ -0,0 +1,111 @@
+// Code generated by "enumer -type=PartialSuccessPolicy -trimprefix=PartialSuccessPolicy -transform=snake -json -text"; DO NOT EDIT.
+
+package cflog2otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const _PartialSuccessPolicyName = "warnfail"
+
+var _PartialSuccessPolicyIndex = [...]uint8{0, 4, 8}
+
+const _PartialSuccessPolicyLowerName = "warnfail"
+
+func (i PartialSuccessPolicy) String() string {
+	if i < 0 || i >= PartialSuccessPolicy(len(_PartialSuccessPolicyIndex)-1) {
+		return fmt.Sprintf("PartialSuccessPolicy(%d)", i)
+	}
+	return _PartialSuccessPolicyName[_PartialSuccessPolicyIndex[i]:_PartialSuccessPolicyIndex[i+1]]
+}
+
+// An "invalid array index" compiler error signifies that the constant values have changed.
+// Re-run the stringer command to generate them again.
+func _PartialSuccessPolicyNoOp() {
+	var x [1]struct{}
+	_ = x[PartialSuccessPolicyWarn-(0)]
+	_ = x[PartialSuccessPolicyFail-(1)]
+}
+
+var _PartialSuccessPolicyValues = []PartialSuccessPolicy{PartialSuccessPolicyWarn, PartialSuccessPolicyFail}
+
+var _PartialSuccessPolicyNameToValueMap = map[string]PartialSuccessPolicy{
+	_PartialSuccessPolicyName[0:4]: PartialSuccessPolicyWarn,
+	_PartialSuccessPolicyName[4:8]: PartialSuccessPolicyFail,
+}
+
+var _PartialSuccessPolicyLowerNameToValueMap = map[string]PartialSuccessPolicy{
+	_PartialSuccessPolicyLowerName[0:4]: PartialSuccessPolicyWarn,
+	_PartialSuccessPolicyLowerName[4:8]: PartialSuccessPolicyFail,
+}
+
+var _PartialSuccessPolicyNames = []string{
+	_PartialSuccessPolicyName[0:4],
+	_PartialSuccessPolicyName[4:8],
+}
+
+// PartialSuccessPolicyString retrieves an enum value from the enum constants string name.
+// Throws an error if the param is not part of the enum.
+func PartialSuccessPolicyString(s string) (PartialSuccessPolicy, error) {
+	if val, ok := _PartialSuccessPolicyNameToValueMap[s]; ok {
+		return val, nil
+	}
+
+	if val, ok := _PartialSuccessPolicyLowerNameToValueMap[strings.ToLower(s)]; ok {
+		return val, nil
+	}
+	return 0, fmt.Errorf("%s does not belong to PartialSuccessPolicy values", s)
+}
+
+// PartialSuccessPolicyValues returns all values of the enum
+func PartialSuccessPolicyValues() []PartialSuccessPolicy {
+	return _PartialSuccessPolicyValues
+}
+
+// PartialSuccessPolicyStrings returns a slice of all String values of the enum
+func PartialSuccessPolicyStrings() []string {
+	strs := make([]string, len(_PartialSuccessPolicyNames))
+	copy(strs, _PartialSuccessPolicyNames)
+	return strs
+}
+
+// IsAPartialSuccessPolicy returns "true" if the value is listed in the enum definition. "false" otherwise
+func (i PartialSuccessPolicy) IsAPartialSuccessPolicy() bool {
+	for _, v := range _PartialSuccessPolicyValues {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements the json.Marshaler interface for PartialSuccessPolicy
+func (i PartialSuccessPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for PartialSuccessPolicy
+func (i *PartialSuccessPolicy) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("PartialSuccessPolicy should be a string, got %s", data)
+	}
+
+	var err error
+	*i, err = PartialSuccessPolicyString(s)
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for PartialSuccessPolicy
+func (i PartialSuccessPolicy) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for PartialSuccessPolicy
+func (i *PartialSuccessPolicy) UnmarshalText(text []byte) error {
+	var err error
+	*i, err = PartialSuccessPolicyString(string(text))
+	return err
+}
@@ -0,0 +1,62 @@
+package cflog2otel
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// AppBuilder builds App from the config.
+type AppBuilder func(ctx context.Context, cfg *Config) (*App, error)
+
+// Reloader reloads the config on invocations of warm Lambda, and swaps App atomically.
+// if the new config is invalid or App can not be built, the current App is kept.
+type Reloader struct {
+	loader *ConfigLoader
+	build  AppBuilder
+	app    atomic.Pointer[App]
+	mu     sync.Mutex
+}
+
+// NewReloader returns Reloader serving the App built from the config loaded by the loader.
+func NewReloader(loader *ConfigLoader, app *App, build AppBuilder) *Reloader {
+	r := &Reloader{
+		loader: loader,
+		build:  build,
+	}
+	r.app.Store(app)
+	return r
+}
+
+// App returns the current App.
+func (r *Reloader) App() *App {
+	return r.app.Load()
+}
+
+// Reload swaps App if the config is changed. returns true if swapped.
+func (r *Reloader) Reload(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg, version, err := r.loader.Reload(ctx)
+	if err != nil || cfg == nil {
+		return false, err
+	}
+	app, err := r.build(ctx, cfg)
+	if err != nil {
+		// the version is not committed, so the config is built again at the next check.
+		return false, err
+	}
+	r.app.Store(app)
+	r.loader.Commit(version)
+	slog.InfoContext(ctx, "config reloaded", "location", r.loader.Location())
+	return true, nil
+}
+
+func (r *Reloader) Invoke(ctx context.Context, event json.RawMessage) (any, error) {
+	if _, err := r.Reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "failed to reload config, keep the current config", "location", r.loader.Location(), "error", err)
+	}
+	return r.App().Invoke(ctx, event)
+}
@@ -0,0 +1,328 @@
+package cflog2otel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/samber/oops"
+)
+
+// DefaultReplayConcurrency is the default number of hours replayed concurrently.
+const DefaultReplayConcurrency = 4
+
+// replayHourLayout is the format of the hour in the object key of CloudFront standard logs.
+const replayHourLayout = "2006-01-02-15"
+
+// ReplayInput is the range of CloudFront standard logs to replay.
+type ReplayInput struct {
+	Bucket string
+	// Prefix is the prefix of the object key before the distribution ID, e.g. `logs/`.
+	Prefix         string
+	DistributionID string
+	// From and To are the range of hours to replay, From is inclusive and To is exclusive.
+	From time.Time
+	To   time.Time
+	// Concurrency is the number of hours replayed concurrently. if zero, DefaultReplayConcurrency is used.
+	Concurrency int
+	// CheckpointPath is the file to record the completed hours. if set, the completed hours are skipped on resume.
+	CheckpointPath string
+}
+
+func (input *ReplayInput) Validate() error {
+	if input.Bucket == "" {
+		return oops.Errorf("bucket is required")
+	}
+	if input.DistributionID == "" {
+		return oops.Errorf("distribution id is required")
+	}
+	if input.From.IsZero() || input.To.IsZero() {
+		return oops.Errorf("from and to are required")
+	}
+	if !input.From.Before(input.To) {
+		return oops.Errorf("from must be before to")
+	}
+	if input.Concurrency < 0 {
+		return oops.Errorf("concurrency must be positive")
+	}
+	if input.Prefix != "" && !strings.HasSuffix(input.Prefix, "/") {
+		input.Prefix += "/"
+	}
+	return nil
+}
+
+// ReplayCheckpoint is the progress of Replay, saved as JSON.
+type ReplayCheckpoint struct {
+	Bucket         string   `json:"bucket"`
+	Prefix         string   `json:"prefix"`
+	DistributionID string   `json:"distribution_id"`
+	Completed      []string `json:"completed"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func loadReplayCheckpoint(input ReplayInput) (*ReplayCheckpoint, error) {
+	cp := &ReplayCheckpoint{
+		Bucket:         input.Bucket,
+		Prefix:         input.Prefix,
+		DistributionID: input.DistributionID,
+		Completed:      []string{},
+		path:           input.CheckpointPath,
+	}
+	if cp.path == "" {
+		return cp, nil
+	}
+	bs, err := os.ReadFile(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to read checkpoint %s", cp.path)
+	}
+	var saved ReplayCheckpoint
+	if err := json.Unmarshal(bs, &saved); err != nil {
+		return nil, oops.Wrapf(err, "failed to decode checkpoint %s", cp.path)
+	}
+	if saved.Bucket != cp.Bucket || saved.Prefix != cp.Prefix || saved.DistributionID != cp.DistributionID {
+		return nil, oops.Errorf("checkpoint %s is for s3://%s/%s%s, not for this replay", cp.path, saved.Bucket, saved.Prefix, saved.DistributionID)
+	}
+	cp.Completed = saved.Completed
+	return cp, nil
+}
+
+func (cp *ReplayCheckpoint) isCompleted(hour time.Time) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return slices.Contains(cp.Completed, hour.Format(replayHourLayout))
+}
+
+// complete records the hour as completed, and saves the checkpoint atomically.
+func (cp *ReplayCheckpoint) complete(hour time.Time) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Completed = append(cp.Completed, hour.Format(replayHourLayout))
+	slices.Sort(cp.Completed)
+	if cp.path == "" {
+		return nil
+	}
+	bs, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return oops.Wrapf(err, "failed to encode checkpoint")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), filepath.Base(cp.path)+".*")
+	if err != nil {
+		return oops.Wrapf(err, "failed to create checkpoint")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return oops.Wrapf(err, "failed to write checkpoint")
+	}
+	if err := tmp.Close(); err != nil {
+		return oops.Wrapf(err, "failed to write checkpoint")
+	}
+	if err := os.Rename(tmp.Name(), cp.path); err != nil {
+		return oops.Wrapf(err, "failed to save checkpoint")
+	}
+	return nil
+}
+
+// Replay aggregates the CloudFront standard logs in the range hour by hour, and exports the metrics with original timestamps.
+// all lines of an hour are aggregated together, including the late lines in the objects of the following hour,
+// so the backfill config is not used. `object` variables are the ones of the first object in the hour.
+func (app *App) Replay(ctx context.Context, input ReplayInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	if p, ok := app.cfg.Parse.Parser(); ok && p.Name() != LogFormatCloudFrontStandard {
+		return oops.Errorf("replay supports only parse.format %s, got %s", LogFormatCloudFrontStandard, p.Name())
+	}
+	// each hour exports the intervals in it, so the intervals must not straddle hours.
+	for i, m := range app.cfg.Metrics {
+		if time.Hour%m.AggregateInterval() != 0 {
+			return oops.Errorf("metrics[%d]: interval %s must divide 1h for replay", i, m.Interval)
+		}
+	}
+	cp, err := loadReplayCheckpoint(input)
+	if err != nil {
+		return err
+	}
+	concurrency := input.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultReplayConcurrency
+	}
+	var hours []time.Time
+	for h := input.From.UTC().Truncate(time.Hour); h.Before(input.To); h = h.Add(time.Hour) {
+		if cp.isCompleted(h) {
+			slog.DebugContext(ctx, "skipping completed hour", "hour", h.Format(replayHourLayout))
+			continue
+		}
+		hours = append(hours, h)
+	}
+	if len(hours) == 0 {
+		slog.InfoContext(ctx, "no hours to replay")
+		return nil
+	}
+	exporter, endpointURL, err := newOtelExporter(ctx, app.cfg.Otel)
+	if err != nil {
+		return oops.Wrapf(err, "failed to create OTLP exporter")
+	}
+	slog.InfoContext(ctx, "starting replay", "endpoint", endpointURL, "hours", len(hours), "concurrency", concurrency)
+	defer func() {
+		if err := exporter.Shutdown(ctx); err != nil {
+			slog.WarnContext(ctx, "failed to shutdown exporter", "error", err)
+		}
+	}()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, h := range hours {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := app.replayHour(ctx, exporter, input, h)
+			if err == nil {
+				err = cp.complete(h)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, oops.Wrapf(err, "hour %s", h.Format(replayHourLayout)))
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return oops.Wrapf(errors.Join(errs...), "failed to replay")
+	}
+	slog.InfoContext(ctx, "replay completed", "hours", len(hours))
+	return nil
+}
+
+// replayHour aggregates the lines of the hour, including the late lines delivered in the objects of the following hour.
+// the lines of other hours are left to their own hours, so no interval is exported twice with partial totals.
+func (app *App) replayHour(ctx context.Context, exporter *otelExporter, input ReplayInput, hour time.Time) error {
+	prefix := fmt.Sprintf("%s%s.%s.", input.Prefix, input.DistributionID, hour.Format(replayHourLayout))
+	objects, err := app.listReplayObjects(ctx, input.Bucket, prefix)
+	if err != nil {
+		return err
+	}
+	following, err := app.listReplayObjects(ctx, input.Bucket, fmt.Sprintf("%s%s.%s.", input.Prefix, input.DistributionID, hour.Add(time.Hour).Format(replayHourLayout)))
+	if err != nil {
+		return err
+	}
+	if len(objects)+len(following) == 0 {
+		slog.InfoContext(ctx, "no objects in the hour", "prefix", prefix)
+		return nil
+	}
+	type replayObject struct {
+		logs  []CELVariablesLog
+		stats *ParseStats
+	}
+	all := append(slices.Clone(objects), following...)
+	parsed, err := parallelMap(ctx, app.cfg.ConcurrencyValue(), all, func(ctx context.Context, obj types.Object) (replayObject, error) {
+		reader, err := NewS3ObjectReader(ctx, app.downloader, input.Bucket, aws.ToString(obj.Key))
+		if err != nil {
+			return replayObject{}, oops.Wrapf(err, "failed to create object reader")
+		}
+		objectLogs, objectStats, err := ParseCloudFrontLogWithConfig(ctx, reader, app.cfg.Parse)
+		if err != nil {
+			return replayObject{}, oops.Wrapf(err, "failed to parse cloudfront log[%s]", aws.ToString(obj.Key))
+		}
+		return replayObject{logs: objectLogs, stats: objectStats}, nil
+	})
+	if err != nil {
+		return err
+	}
+	var logs []CELVariablesLog
+	stats := &ParseStats{}
+	var eventTime time.Time
+	end := hour.Add(time.Hour)
+	for i, obj := range all {
+		for _, l := range parsed[i].logs {
+			if !l.Timestamp.Before(hour) && l.Timestamp.Before(end) {
+				logs = append(logs, l)
+			}
+		}
+		// the objects of the following hour are counted when replaying that hour.
+		if i < len(objects) {
+			stats.Merge(parsed[i].stats)
+		}
+		if t := aws.ToTime(obj.LastModified); t.After(eventTime) {
+			eventTime = t
+		}
+	}
+	slices.SortStableFunc(logs, func(i, j CELVariablesLog) int {
+		return i.Timestamp.Compare(j.Timestamp)
+	})
+	notification := events.S3EventRecord{
+		EventTime: eventTime,
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: input.Bucket},
+			Object: events.S3Object{
+				Key:  aws.ToString(all[0].Key),
+				Size: aws.ToInt64(all[0].Size),
+				ETag: aws.ToString(all[0].ETag),
+			},
+		},
+	}
+	vars := NewCELVariables(notification, input.DistributionID)
+	metrics, err := app.aggregateLogs(ctx, notification, vars, logs, stats, app.newLookups())
+	if err != nil {
+		return oops.Wrapf(err, "failed to aggregate metrics")
+	}
+	for _, m := range metrics {
+		if err := exporter.Export(ctx, m); err != nil {
+			return oops.Wrapf(err, "failed to export metrics")
+		}
+	}
+	slog.InfoContext(ctx, "replayed hour", "prefix", prefix, "objects", len(objects), "following_objects", len(following), "lines", len(logs))
+	return nil
+}
+
+func (app *App) listReplayObjects(ctx context.Context, bucket, prefix string) ([]types.Object, error) {
+	var objects []types.Object
+	p := s3.NewListObjectsV2Paginator(app.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to list objects")
+		}
+		for _, obj := range out.Contents {
+			if strings.HasSuffix(aws.ToString(obj.Key), ".gz") {
+				objects = append(objects, obj)
+			}
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,200 @@
+package cflog2otel_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mashiike/cflog2otel"
+	"github.com/mashiike/cflog2otel/otlptest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+)
+
+func TestApp__Replay(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	for key, path := range map[string]string{
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz": "testdata/cf_log2.txt",
+		"logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz": "testdata/cf_log.txt",
+	} {
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		client.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Bucket == "example-bucket" && *input.Key == key
+		})).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+	}
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22."),
+	}).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{
+				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT3KCN4SGK9.gz"),
+				LastModified: aws.Time(time.Date(2019, 12, 01, 22, 40, 0, 0, time.UTC)),
+			},
+			{
+				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"),
+				LastModified: aws.Time(time.Date(2019, 12, 01, 22, 52, 0, 0, time.UTC)),
+			},
+		},
+	}, nil).Once()
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-23."),
+	}).Return(&s3.ListObjectsV2Output{}, nil).Twice()
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-02-00."),
+	}).Return(&s3.ListObjectsV2Output{}, nil).Once()
+
+	var (
+		mu     sync.Mutex
+		sended []*collectormetrics.ExportMetricsServiceRequest
+	)
+	server := otlptest.NewMetricsCollector(otlptest.ExporterFunc(
+		func(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			sended = append(sended, req)
+			return &collectormetrics.ExportMetricsServiceResponse{}, nil
+		},
+	))
+	defer server.Close()
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load("testdata/backfil_config.jsonnet", cflog2otel.WithAWSConfig(aws.Config{})))
+	require.NoError(t, cfg.Otel.SetEndpointURL(server.URL))
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	input := cflog2otel.ReplayInput{
+		Bucket:         "example-bucket",
+		Prefix:         "logs",
+		DistributionID: "EMLARXS9EXAMPLE",
+		From:           time.Date(2019, 12, 01, 22, 0, 0, 0, time.UTC),
+		To:             time.Date(2019, 12, 02, 0, 0, 0, 0, time.UTC),
+		CheckpointPath: checkpoint,
+	}
+	ctx := context.Background()
+	require.NoError(t, app.Replay(ctx, input))
+	require.Len(t, sended, 1)
+	var total int64
+	for _, m := range sended[0].ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		for _, dp := range m.GetSum().GetDataPoints() {
+			total += dp.GetAsInt()
+		}
+	}
+	require.EqualValues(t, 12, total, "all lines of the two objects are aggregated together")
+
+	bs, err := os.ReadFile(checkpoint)
+	require.NoError(t, err)
+	var saved cflog2otel.ReplayCheckpoint
+	require.NoError(t, json.Unmarshal(bs, &saved))
+	require.Equal(t, []string{"2019-12-01-22", "2019-12-01-23"}, saved.Completed)
+
+	// resumed replay skips the completed hours, so no more API calls.
+	require.NoError(t, app.Replay(ctx, input))
+	require.Len(t, sended, 1)
+
+	input.DistributionID = "OTHERDISTRIBUTION"
+	require.ErrorContains(t, app.Replay(ctx, input), "not for this replay")
+}
+
+func TestApp__Replay__LateLineInFollowingHour(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	// the object of 22 has a late line of 21:59, and the object of 21 has the other line of the same interval.
+	bs, err := os.ReadFile("testdata/cf_log_late.txt")
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(bs), []byte("\n"))
+	earlier := bytes.Join([][]byte{lines[0], lines[1], bytes.Replace(lines[len(lines)-1], []byte("21:59:50"), []byte("21:59:10"), 1)}, []byte("\n"))
+	client.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Bucket == "example-bucket" && *input.Key == "logs/EMLARXS9EXAMPLE.2019-12-01-21.RT1KCN4SGK9.gz"
+	})).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(gzipData(earlier))),
+		ContentLength: aws.Int64(int64(len(earlier))),
+	}, nil).Once()
+	// read by the hour 21 for the late line, and by the hour 22.
+	for range 2 {
+		client.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+			return *input.Bucket == "example-bucket" && *input.Key == "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"
+		})).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(gzipData(bs))),
+			ContentLength: aws.Int64(int64(len(bs))),
+		}, nil).Once()
+	}
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-21."),
+	}).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{
+				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-21.RT1KCN4SGK9.gz"),
+				LastModified: aws.Time(time.Date(2019, 12, 01, 21, 59, 30, 0, time.UTC)),
+			},
+		},
+	}, nil).Once()
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22."),
+	}).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{
+				Key:          aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"),
+				LastModified: aws.Time(time.Date(2019, 12, 01, 22, 52, 0, 0, time.UTC)),
+			},
+		},
+	}, nil).Twice()
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("example-bucket"),
+		Prefix: aws.String("logs/EMLARXS9EXAMPLE.2019-12-01-23."),
+	}).Return(&s3.ListObjectsV2Output{}, nil).Once()
+
+	recorder := otlptest.NewRecorder()
+	server := otlptest.NewMetricsCollector(recorder)
+	defer server.Close()
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load("testdata/backfil_config.jsonnet", cflog2otel.WithAWSConfig(aws.Config{})))
+	require.NoError(t, cfg.Otel.SetEndpointURL(server.URL))
+	app, err := cflog2otel.NewWithClient(cfg, client)
+	require.NoError(t, err)
+
+	require.NoError(t, app.Replay(context.Background(), cflog2otel.ReplayInput{
+		Bucket:         "example-bucket",
+		Prefix:         "logs",
+		DistributionID: "EMLARXS9EXAMPLE",
+		From:           time.Date(2019, 12, 01, 21, 0, 0, 0, time.UTC),
+		To:             time.Date(2019, 12, 01, 23, 0, 0, 0, time.UTC),
+	}))
+	// each interval is exported once by the hour it belongs to.
+	counts := make(map[time.Time]int64)
+	for _, m := range recorder.Metrics("http.server.http_requests") {
+		for _, dp := range m.GetSum().GetDataPoints() {
+			start := time.Unix(0, int64(dp.GetStartTimeUnixNano())).UTC()
+			_, dup := counts[start]
+			require.False(t, dup, "interval %s is exported twice", start)
+			counts[start] = dp.GetAsInt()
+		}
+	}
+	require.Equal(t, map[time.Time]int64{
+		time.Date(2019, 12, 01, 21, 59, 0, 0, time.UTC): 2,
+		time.Date(2019, 12, 01, 22, 42, 0, 0, time.UTC): 3,
+		time.Date(2019, 12, 01, 22, 51, 0, 0, time.UTC): 3,
+	}, counts)
+}
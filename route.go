@@ -0,0 +1,203 @@
+package cflog2otel
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/samber/oops"
+)
+
+// Router matches URL paths against path templates such as `/users/{id}/orders`.
+// `{name}` matches one path segment, `{name...}` at the end matches the rest of the path.
+type Router struct {
+	routes []routeTemplate
+}
+
+type routeTemplate struct {
+	template string
+	segments []routeSegment
+}
+
+type routeSegment struct {
+	literal string
+	param   bool
+	rest    bool
+}
+
+var routeParamPattern = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)(\.\.\.)?\}$`)
+
+func NewRouter(templates []string) (*Router, error) {
+	r := &Router{
+		routes: make([]routeTemplate, 0, len(templates)),
+	}
+	for i, tmpl := range templates {
+		if !strings.HasPrefix(tmpl, "/") {
+			return nil, oops.Errorf("routes[%d]: must start with '/'", i)
+		}
+		parts := strings.Split(strings.TrimPrefix(tmpl, "/"), "/")
+		segments := make([]routeSegment, 0, len(parts))
+		for j, part := range parts {
+			if !strings.ContainsAny(part, "{}") {
+				segments = append(segments, routeSegment{literal: part})
+				continue
+			}
+			m := routeParamPattern.FindStringSubmatch(part)
+			if m == nil {
+				return nil, oops.Errorf("routes[%d]: invalid segment %q", i, part)
+			}
+			rest := m[2] != ""
+			if rest && j != len(parts)-1 {
+				return nil, oops.Errorf("routes[%d]: %q must be the last segment", i, part)
+			}
+			segments = append(segments, routeSegment{param: true, rest: rest})
+		}
+		r.routes = append(r.routes, routeTemplate{
+			template: tmpl,
+			segments: segments,
+		})
+	}
+	return r, nil
+}
+
+// Match returns the first route template that matches the path.
+func (r *Router) Match(path string) (string, bool) {
+	if r == nil || path == "" {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for _, route := range r.routes {
+		if route.match(parts) {
+			return route.template, true
+		}
+	}
+	return "", false
+}
+
+func (t routeTemplate) match(parts []string) bool {
+	for i, seg := range t.segments {
+		if i >= len(parts) {
+			return false
+		}
+		if seg.rest {
+			// like net/http.ServeMux, the rest matches the empty remainder of "/static/", but not "/static".
+			return true
+		}
+		if seg.param {
+			if parts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg.literal != parts[i] {
+			return false
+		}
+	}
+	return len(parts) == len(t.segments)
+}
+
+var (
+	pathNumericSegment = regexp.MustCompile(`^[0-9]+$`)
+	pathUUIDSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	pathHashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// NormalizePath collapses numeric, UUID and hash-like path segments
+// into `{id}`, `{uuid}` and `{hash}` placeholders.
+func NormalizePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		switch {
+		case pathNumericSegment.MatchString(part):
+			parts[i] = "{id}"
+		case pathUUIDSegment.MatchString(part):
+			parts[i] = "{uuid}"
+		case pathHashSegment.MatchString(part):
+			parts[i] = "{hash}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// CELRouterType is the CEL type of `route` variable.
+var CELRouterType = types.NewOpaqueType("cflog2otel.Router")
+
+func (r *Router) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", CELRouterType, typeDesc)
+}
+
+func (r *Router) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return CELRouterType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CELRouterType, typeVal)
+}
+
+func (r *Router) Equal(other ref.Val) ref.Val {
+	return types.Bool(r == other)
+}
+
+func (r *Router) Type() ref.Type {
+	return CELRouterType
+}
+
+func (r *Router) Value() any {
+	return r
+}
+
+// RouteCELLib returns CEL functions for URL paths.
+//
+//	route.match(string) -> string
+//	path.normalize(string) -> string
+//
+// route.match returns the first matched template of `routes`, or empty string if not matched.
+func RouteCELLib() cel.EnvOption {
+	return cel.Lib(routeCELLib{})
+}
+
+type routeCELLib struct{}
+
+func (routeCELLib) LibraryName() string {
+	return "cflog2otel.route"
+}
+
+func (routeCELLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Variable("route", CELRouterType),
+		cel.Function("match",
+			cel.MemberOverload("route_match_string", []*cel.Type{CELRouterType, cel.StringType}, cel.StringType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					r, ok := lhs.(*Router)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					s, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					tmpl, _ := r.Match(string(s))
+					return types.String(tmpl)
+				}),
+			),
+		),
+		cel.Function("path.normalize",
+			cel.Overload("path_normalize_string", []*cel.Type{cel.StringType}, cel.StringType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					s, ok := arg.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return types.String(NormalizePath(string(s)))
+				}),
+			),
+		),
+	}
+}
+
+func (routeCELLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{}
+}
@@ -0,0 +1,76 @@
+package cflog2otel_test
+
+import (
+	"testing"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterMatch(t *testing.T) {
+	router, err := cflog2otel.NewRouter([]string{
+		"/",
+		"/users/me",
+		"/users/{id}",
+		"/users/{id}/orders",
+		"/static/{path...}",
+	})
+	require.NoError(t, err)
+	cases := []struct {
+		path string
+		want string
+	}{
+		{path: "/", want: "/"},
+		{path: "/users/me", want: "/users/me"},
+		{path: "/users/123", want: "/users/{id}"},
+		{path: "/users/123/orders", want: "/users/{id}/orders"},
+		{path: "/users/123/orders/456", want: ""},
+		{path: "/users/", want: ""},
+		{path: "/static/css/main.css", want: "/static/{path...}"},
+		{path: "/static/", want: "/static/{path...}"},
+		{path: "/static", want: ""},
+		{path: "/index.html", want: ""},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			got, ok := router.Match(c.path)
+			require.Equal(t, c.want, got)
+			require.Equal(t, c.want != "", ok)
+		})
+	}
+}
+
+func TestNewRouter__Invalid(t *testing.T) {
+	cases := []struct {
+		templates []string
+		wantErr   string
+	}{
+		{templates: []string{"users/{id}"}, wantErr: "routes[0]: must start with '/'"},
+		{templates: []string{"/", "/users/{id"}, wantErr: `routes[1]: invalid segment "{id"`},
+		{templates: []string{"/users/{id...}/orders"}, wantErr: `routes[0]: "{id...}" must be the last segment`},
+	}
+	for _, c := range cases {
+		t.Run(c.wantErr, func(t *testing.T) {
+			_, err := cflog2otel.NewRouter(c.templates)
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{path: "/", want: "/"},
+		{path: "/users/123/orders", want: "/users/{id}/orders"},
+		{path: "/items/3f2504e0-4f89-11d3-9a0c-0305e82c3301", want: "/items/{uuid}"},
+		{path: "/assets/d41d8cd98f00b204e9800998ecf8427e/app.js", want: "/assets/{hash}/app.js"},
+		{path: "/v2/users", want: "/v2/users"},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			require.Equal(t, c.want, cflog2otel.NormalizePath(c.path))
+		})
+	}
+}
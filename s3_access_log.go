@@ -0,0 +1,88 @@
+package cflog2otel
+
+import (
+	"context"
+	"io"
+	"iter"
+	"path"
+	"regexp"
+)
+
+// s3AccessLogFields are the fields of S3 server access logs.
+// see https://docs.aws.amazon.com/AmazonS3/latest/userguide/LogFormat.html
+var s3AccessLogFields = []string{
+	"bucket_owner", "bucket", "time", "remote_ip", "requester", "request_id", "operation", "key", "request_uri",
+	"http_status", "error_code", "bytes_sent", "object_size", "total_time", "turn_around_time", "referer",
+	"user_agent", "version_id", "host_id", "signature_version", "cipher_suite", "authentication_type", "host_header",
+	"tls_version", "access_point_arn", "acl_required",
+}
+
+var s3AccessLogFormat = positionalLogFormat{
+	logType:   "S3 Server Access Log",
+	split:     splitLogFields,
+	minFields: 18,
+	aliases: map[string]string{
+		"remote_ip":    "c-ip",
+		"http_status":  "sc-status",
+		"bytes_sent":   "sc-bytes",
+		"referer":      "cs(Referer)",
+		"user_agent":   "cs(User-Agent)",
+		"cipher_suite": "ssl-cipher",
+		"tls_version":  "ssl-protocol",
+	},
+	setters: func(l *CELVariablesLog) map[string]func(string) error {
+		return map[string]func(string) error{
+			"time": func(s string) error {
+				return l.setTimestamp("02/Jan/2006:15:04:05 -0700", s)
+			},
+			"request_uri": l.setRequestLine,
+			"total_time": func(s string) error {
+				v, err := toPtrSeconds(s)
+				l.TimeTaken = v
+				return err
+			},
+			"turn_around_time": func(s string) error {
+				v, err := toPtrSeconds(s)
+				l.TimeToFirstByte = v
+				return err
+			},
+			"host_header": func(s string) error {
+				l.HostHeader = toPtrString(s)
+				l.CsHost = toPtrString(s)
+				return nil
+			},
+		}
+	},
+}
+
+var (
+	s3AccessLogObjectName = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}-[0-9A-F]{16}$`)
+	s3AccessLogLine       = regexp.MustCompile(`^\S+ \S+ \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] `)
+)
+
+// S3AccessLogParser is the LogParser of S3 server access logs.
+// `log.timeTaken` and `log.timeToFirstByte` are the total time and the turn-around time in seconds.
+type S3AccessLogParser struct{}
+
+func (S3AccessLogParser) Name() string {
+	return LogFormatS3Access
+}
+
+func (S3AccessLogParser) Detect(objectKey string, head []byte) bool {
+	if s3AccessLogObjectName.MatchString(path.Base(objectKey)) {
+		return true
+	}
+	return s3AccessLogLine.Match(head)
+}
+
+func (S3AccessLogParser) Parse(ctx context.Context, r io.Reader, _ ParseConfig) iter.Seq2[CELVariablesLog, error] {
+	return s3AccessLogFormat.parse(ctx, r, s3AccessLogFields)
+}
+
+func (S3AccessLogParser) Schema() []CELField {
+	return NewLogSchema([]string{
+		"type", "date", "time", "timestamp", "clientIp", "csMethod", "csUriStem", "csUriQuery", "csProtocolVersion",
+		"scStatus", "scStatusCategory", "scBytes", "timeTaken", "timeToFirstByte", "csReferer", "csUserAgent",
+		"sslCipher", "sslProtocol", "xHostHeader", "csHost", "route", "query", "fields",
+	}, s3AccessLogFields)
+}
@@ -0,0 +1,166 @@
+package cflog2otel
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/samber/oops"
+)
+
+// CELS3References reports which S3 tags and metadata are referenced by compiled expressions.
+// they need extra S3 API calls, so they are fetched only when referenced.
+type CELS3References struct {
+	ObjectTags     bool
+	ObjectMetadata bool
+	BucketTags     bool
+}
+
+func (r CELS3References) Merge(other CELS3References) CELS3References {
+	return CELS3References{
+		ObjectTags:     r.ObjectTags || other.ObjectTags,
+		ObjectMetadata: r.ObjectMetadata || other.ObjectMetadata,
+		BucketTags:     r.BucketTags || other.BucketTags,
+	}
+}
+
+// Any reports whether any of tags and metadata is referenced.
+func (r CELS3References) Any() bool {
+	return r.ObjectTags || r.ObjectMetadata || r.BucketTags
+}
+
+// S3TagsLookup fetches tags and metadata of S3 objects and buckets.
+// results are cached in the lookup, so create a new one for each invocation.
+type S3TagsLookup struct {
+	client     S3APIClient
+	mu         sync.Mutex
+	bucketTags map[string]map[string]string
+	objects    map[s3ObjectID]s3ObjectAttributes
+}
+
+type s3ObjectID struct {
+	Bucket    string
+	Key       string
+	VersionID string
+}
+
+type s3ObjectAttributes struct {
+	Tags     map[string]string
+	Metadata map[string]string
+}
+
+func NewS3TagsLookup(client S3APIClient) *S3TagsLookup {
+	return &S3TagsLookup{
+		client:     client,
+		bucketTags: make(map[string]map[string]string),
+		objects:    make(map[s3ObjectID]s3ObjectAttributes),
+	}
+}
+
+// SetVariables fetches the referenced tags and metadata, and sets them to `bucket` and `object` variables.
+func (l *S3TagsLookup) SetVariables(ctx context.Context, refs CELS3References, vars *CELVariables) error {
+	if !refs.Any() {
+		return nil
+	}
+	if refs.BucketTags {
+		tags, err := l.BucketTags(ctx, vars.Bucket.Name)
+		if err != nil {
+			return err
+		}
+		vars.Bucket.Tags = tags
+	}
+	if refs.ObjectTags || refs.ObjectMetadata {
+		id := s3ObjectID{Bucket: vars.Bucket.Name, Key: vars.Object.Key, VersionID: vars.Object.VersionID}
+		attrs, err := l.objectAttributes(ctx, id, refs)
+		if err != nil {
+			return err
+		}
+		vars.Object.Tags = attrs.Tags
+		vars.Object.Metadata = attrs.Metadata
+	}
+	return nil
+}
+
+// BucketTags returns the tags of the bucket. if the bucket has no tags, returns an empty map.
+func (l *S3TagsLookup) BucketTags(ctx context.Context, bucket string) (map[string]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tags, ok := l.bucketTags[bucket]; ok {
+		return tags, nil
+	}
+	out, err := l.client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket: &bucket,
+	})
+	var tags map[string]string
+	switch {
+	case isNoSuchTagSet(err):
+		tags = map[string]string{}
+	case err != nil:
+		return nil, oops.Wrapf(err, "failed to get bucket tagging[%s]", bucket)
+	default:
+		tags = tagsToMap(out.TagSet)
+	}
+	l.bucketTags[bucket] = tags
+	return tags, nil
+}
+
+func (l *S3TagsLookup) objectAttributes(ctx context.Context, id s3ObjectID, refs CELS3References) (s3ObjectAttributes, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attrs := l.objects[id]
+	var versionID *string
+	if id.VersionID != "" {
+		versionID = &id.VersionID
+	}
+	if refs.ObjectTags && attrs.Tags == nil {
+		out, err := l.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+			Bucket:    &id.Bucket,
+			Key:       &id.Key,
+			VersionId: versionID,
+		})
+		if err != nil {
+			return attrs, oops.Wrapf(err, "failed to get object tagging[s3://%s/%s]", id.Bucket, id.Key)
+		}
+		attrs.Tags = tagsToMap(out.TagSet)
+	}
+	if refs.ObjectMetadata && attrs.Metadata == nil {
+		out, err := l.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    &id.Bucket,
+			Key:       &id.Key,
+			VersionId: versionID,
+		})
+		if err != nil {
+			return attrs, oops.Wrapf(err, "failed to head object[s3://%s/%s]", id.Bucket, id.Key)
+		}
+		attrs.Metadata = make(map[string]string, len(out.Metadata))
+		for k, v := range out.Metadata {
+			attrs.Metadata[k] = v
+		}
+	}
+	l.objects[id] = attrs
+	return attrs, nil
+}
+
+func tagsToMap(tagSet []types.Tag) map[string]string {
+	tags := make(map[string]string, len(tagSet))
+	for _, tag := range tagSet {
+		if tag.Key == nil {
+			continue
+		}
+		var value string
+		if tag.Value != nil {
+			value = *tag.Value
+		}
+		tags[*tag.Key] = value
+	}
+	return tags
+}
+
+// isNoSuchTagSet reports whether the error means that the bucket has no tags.
+func isNoSuchTagSet(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchTagSet"
+}
@@ -0,0 +1,110 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCELCapable__S3References(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		want cflog2otel.CELS3References
+	}{
+		{
+			name: "no tags",
+			expr: `{"expr": "bucket.name + object.key"}`,
+			want: cflog2otel.CELS3References{},
+		},
+		{
+			name: "object tags and bucket tags",
+			expr: `{"expr": "object.tags[\"team\"] + bucket.tags[\"env\"]"}`,
+			want: cflog2otel.CELS3References{ObjectTags: true, BucketTags: true},
+		},
+		{
+			name: "object metadata with optional",
+			expr: `{"expr": "object.metadata[?\"owner\"].orValue(\"\")"}`,
+			want: cflog2otel.CELS3References{ObjectMetadata: true},
+		},
+		{
+			name: "object tags by index",
+			expr: `{"expr": "dyn(object)[\"tags\"][\"team\"]"}`,
+			want: cflog2otel.CELS3References{ObjectTags: true},
+		},
+		{
+			name: "bucket tags by optional index",
+			expr: `{"expr": "dyn(bucket)[?\"tags\"].orValue({})[?\"env\"].orValue(\"\")"}`,
+			want: cflog2otel.CELS3References{BucketTags: true},
+		},
+		{
+			name: "object by dynamic key",
+			expr: `{"expr": "string(dyn(object)[bucket.name == \"logs\" ? \"tags\" : \"metadata\"])"}`,
+			want: cflog2otel.CELS3References{ObjectTags: true, ObjectMetadata: true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expr cflog2otel.CELCapable[string]
+			require.NoError(t, json.Unmarshal([]byte(tc.expr), &expr))
+			require.Equal(t, tc.want, expr.S3References())
+		})
+	}
+}
+
+func TestS3TagsLookup(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	client := newMockS3APIClient(ctrl)
+	client.On(
+		"GetBucketTagging",
+		mock.Anything,
+		mock.MatchedBy(func(input *s3.GetBucketTaggingInput) bool {
+			return *input.Bucket == "example-bucket"
+		}),
+	).Return(&s3.GetBucketTaggingOutput{
+		TagSet: []types.Tag{{Key: aws.String("env"), Value: aws.String("prod")}},
+	}, nil).Once()
+	client.On(
+		"GetBucketTagging",
+		mock.Anything,
+		mock.MatchedBy(func(input *s3.GetBucketTaggingInput) bool {
+			return *input.Bucket == "untagged-bucket"
+		}),
+	).Return(nil, &smithy.GenericAPIError{Code: "NoSuchTagSet", Message: "The TagSet does not exist"}).Once()
+	client.On("GetObjectTagging", mock.Anything, mock.Anything).Return(&s3.GetObjectTaggingOutput{
+		TagSet: []types.Tag{{Key: aws.String("team"), Value: aws.String("web")}},
+	}, nil).Once()
+	client.On("HeadObject", mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+		Metadata: map[string]string{"owner": "alice"},
+	}, nil).Once()
+
+	ctx := context.Background()
+	lookup := cflog2otel.NewS3TagsLookup(client)
+	refs := cflog2otel.CELS3References{ObjectTags: true, ObjectMetadata: true, BucketTags: true}
+	for range 2 {
+		vars := &cflog2otel.CELVariables{
+			Bucket: cflog2otel.CELVariablesS3Bucket{Name: "example-bucket"},
+			Object: cflog2otel.CELVariablesS3Object{Key: "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz"},
+		}
+		require.NoError(t, lookup.SetVariables(ctx, refs, vars))
+		require.Equal(t, map[string]string{"env": "prod"}, vars.Bucket.Tags)
+		require.Equal(t, map[string]string{"team": "web"}, vars.Object.Tags)
+		require.Equal(t, map[string]string{"owner": "alice"}, vars.Object.Metadata)
+	}
+
+	tags, err := lookup.BucketTags(ctx, "untagged-bucket")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+	tags, err = lookup.BucketTags(ctx, "untagged-bucket")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+}
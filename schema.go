@@ -0,0 +1,206 @@
+package cflog2otel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSONSchemaDraft is the JSON Schema dialect of ConfigJSONSchema.
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// ConfigJSONSchema returns the JSON Schema of the rendered configuration, i.e. the JSON evaluated from jsonnet.
+// like the decoder of Config, unknown fields are not allowed.
+func ConfigJSONSchema() map[string]any {
+	g := &jsonSchemaGenerator{defs: make(map[string]any)}
+	root := g.schemaOf(reflect.TypeFor[Config]())
+	root["$schema"] = JSONSchemaDraft
+	root["title"] = "cflog2otel configuration"
+	root["$defs"] = g.defs
+	return root
+}
+
+// jsonSchemaProvider is implemented by the types which have the custom JSON representation.
+type jsonSchemaProvider interface {
+	jsonSchema(g *jsonSchemaGenerator) map[string]any
+}
+
+// jsonSchemaEnums are the enumer types, which are marshaled as the strings.
+var jsonSchemaEnums = map[reflect.Type]func() []string{
+	reflect.TypeFor[AggregationType]():      AggregationTypeStrings,
+	reflect.TypeFor[ParseErrorPolicy]():     ParseErrorPolicyStrings,
+	reflect.TypeFor[CELErrorPolicy]():       CELErrorPolicyStrings,
+	reflect.TypeFor[BackfillMode]():         BackfillModeStrings,
+	reflect.TypeFor[PartialSuccessPolicy](): PartialSuccessPolicyStrings,
+}
+
+type jsonSchemaGenerator struct {
+	defs map[string]any
+}
+
+func (g *jsonSchemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	if t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(reflect.TypeFor[jsonSchemaProvider]()) {
+		return reflect.New(t).Interface().(jsonSchemaProvider).jsonSchema(g)
+	}
+	if values, ok := jsonSchemaEnums[t]; ok {
+		return map[string]any{"type": "string", "enum": values()}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t.Name(), func() map[string]any {
+			return g.structSchema(t)
+		})
+	}
+	// interface, any JSON value
+	return map[string]any{}
+}
+
+// ref registers the schema to $defs once, and returns the reference to it.
+func (g *jsonSchemaGenerator) ref(name string, build func() map[string]any) map[string]any {
+	if _, ok := g.defs[name]; !ok {
+		g.defs[name] = map[string]any{} // placeholder for recursive types
+		g.defs[name] = build()
+	}
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
+
+func (g *jsonSchemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schemaOf(f.Type)
+		// the fields are marked explicitly as Validate enforces them, since the tag of encoding/json does not tell
+		// whether the field is defaulted or not.
+		if f.Tag.Get("jsonschema") == "required" {
+			required = append(required, name)
+		}
+	}
+	s := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// jsonSchema returns the schema of the literal value, `{expr}` and `{switch}` forms.
+func (expr *CELCapable[T]) jsonSchema(g *jsonSchemaGenerator) map[string]any {
+	t := reflect.TypeFor[T]()
+	name := "CELCapable"
+	if t.Kind() != reflect.Interface {
+		name += strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	}
+	return g.ref(name, func() map[string]any {
+		value := g.schemaOf(t)
+		celExpr := map[string]any{
+			"type":        "string",
+			"description": "CEL expression, see `cflog2otel schema -cel-fields` for available variables",
+		}
+		onError := g.schemaOf(reflect.TypeFor[CELErrorPolicy]())
+		return map[string]any{
+			"anyOf": []any{
+				value,
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"expr":     celExpr,
+						"on_error": onError,
+						"default":  value,
+					},
+					"required":             []string{"expr"},
+					"additionalProperties": false,
+				},
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"switch": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"case":         celExpr,
+									"value":        value,
+									"value_expr":   celExpr,
+									"default":      value,
+									"default_expr": celExpr,
+								},
+								"additionalProperties": false,
+							},
+						},
+						"on_error": onError,
+						"default":  value,
+					},
+					"required":             []string{"switch"},
+					"additionalProperties": false,
+				},
+			},
+		}
+	})
+}
+
+// CELField is a field of the builtin CEL variables.
+type CELField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Nullable reports whether the field is null if the value is `-` in logs.
+	Nullable bool `json:"nullable,omitempty"`
+}
+
+// CELFields returns the fields of `bucket`, `object`, `cloudfront` and `log` variables with CEL types.
+func CELFields() []CELField {
+	var vars CELVariables
+	provider := defaultCELEnv.CELTypeProvider()
+	var fields []CELField
+	for _, name := range []string{"bucket", "object", "cloudfront", "log"} {
+		rt := reflect.TypeOf(vars.marshalNativeTypesMap()[name])
+		typeName := fmt.Sprintf("cflog2otel.%s", rt.Name())
+		for i := range rt.NumField() {
+			f := rt.Field(i)
+			tag := f.Tag.Get("cel")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			ft, ok := provider.FindStructFieldType(typeName, tag)
+			if !ok {
+				continue
+			}
+			fields = append(fields, CELField{
+				Name:     name + "." + tag,
+				Type:     ft.Type.String(),
+				Nullable: f.Type.Kind() == reflect.Pointer,
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,112 @@
+package cflog2otel_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mashiike/cflog2otel"
+	"github.com/sebdah/goldie/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigJSONSchema(t *testing.T) {
+	schema := cflog2otel.ConfigJSONSchema()
+	g := goldie.New(t, goldie.WithFixtureDir("testdata/fixtures"), goldie.WithNameSuffix(".golden.json"))
+	g.AssertJson(t, "config_schema", schema)
+
+	bs, err := json.Marshal(schema)
+	require.NoError(t, err)
+	var root map[string]any
+	require.NoError(t, json.Unmarshal(bs, &root))
+	cases := []string{
+		"testdata/definitions.jsonnet",
+		"testdata/http_route.jsonnet",
+		"testdata/multi_metrics.jsonnet",
+		"testdata/on_error.jsonnet",
+		"testdata/parse_skip_and_count.jsonnet",
+		"testdata/request_time_histogram_custom_buckets.jsonnet",
+		"testdata/scope_without_name.jsonnet",
+		"testdata/switch_case.jsonnet",
+		"testdata/switch_with_cel_value.jsonnet",
+	}
+	for _, path := range cases {
+		t.Run(path, func(t *testing.T) {
+			jsonStr, err := cflog2otel.MakeVM().EvaluateFile(path)
+			require.NoError(t, err)
+			var v any
+			require.NoError(t, json.Unmarshal([]byte(jsonStr), &v))
+			require.NoError(t, checkSchema(root, root, v, "$"))
+			// the config valid for the schema is valid for Config.Load too.
+			require.NoError(t, cflog2otel.DefaultConfig().Load(path, cflog2otel.WithAWSConfig(aws.Config{})))
+		})
+	}
+}
+
+// checkSchema reports the object keys which are not declared in the schema, and the missing required keys.
+func checkSchema(root, schema map[string]any, v any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root["$defs"].(map[string]any)[strings.TrimPrefix(ref, "#/$defs/")]
+		return checkSchema(root, def.(map[string]any), v, path)
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		var err error
+		for _, s := range anyOf {
+			if err = checkSchema(root, s.(map[string]any), v, path); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		properties, ok := schema["properties"].(map[string]any)
+		if !ok {
+			if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+				for k, value := range v {
+					if err := checkSchema(root, additional, value, path+"."+k); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		if required, ok := schema["required"].([]any); ok {
+			for _, k := range required {
+				if _, ok := v[k.(string)]; !ok {
+					return fmt.Errorf("%s.%s is required", path, k)
+				}
+			}
+		}
+		for k, value := range v {
+			s, ok := properties[k]
+			if !ok {
+				return fmt.Errorf("%s.%s is not declared", path, k)
+			}
+			if err := checkSchema(root, s.(map[string]any), value, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i, value := range v {
+			if err := checkSchema(root, items, value, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestCELFields(t *testing.T) {
+	fields := cflog2otel.CELFields()
+	require.Contains(t, fields, cflog2otel.CELField{Name: "log.csUriStem", Type: "string", Nullable: true})
+	require.Contains(t, fields, cflog2otel.CELField{Name: "log.timeTaken", Type: "double", Nullable: true})
+	require.Contains(t, fields, cflog2otel.CELField{Name: "log.timestamp", Type: "google.protobuf.Timestamp"})
+	require.Contains(t, fields, cflog2otel.CELField{Name: "bucket.tags", Type: "map(string, string)"})
+}
@@ -0,0 +1,98 @@
+package cflog2otel
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/oops"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	SelfMetricsParseLines        = "cflog2otel.parse.lines"
+	SelfMetricsParseSkippedLines = "cflog2otel.parse.skipped_lines"
+)
+
+// NewParseSelfMetrics returns metrics about the parsed log lines.
+// resource attributes are evaluated without log line.
+func NewParseSelfMetrics(ctx context.Context, cfg *Config, celVariables *CELVariables, stats *ParseStats, t time.Time) (*metricdata.ResourceMetrics, error) {
+	vars := *celVariables
+	if vars.Definitions == nil {
+		vars.Definitions = cfg.CELDefinitions()
+	}
+	if vars.CELEnv == nil {
+		vars.CELEnv = cfg.CELEnv()
+	}
+	vars.SetLogLine(CELVariablesLog{})
+	attrs, err := ToAttributes(ctx, cfg.ResourceAttributes, &vars)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to convert attributes")
+	}
+	skipped := metricdata.Sum[int64]{
+		DataPoints:  make([]metricdata.DataPoint[int64], 0),
+		Temporality: metricdata.DeltaTemporality,
+		IsMonotonic: true,
+	}
+	for _, lineErr := range stats.SkippedLines {
+		attrSet := attribute.NewSet(attribute.String("reason", lineErr.Reason))
+		var found bool
+		for i, dp := range skipped.DataPoints {
+			if !dp.Attributes.Equals(&attrSet) {
+				continue
+			}
+			skipped.DataPoints[i].Value++
+			found = true
+			break
+		}
+		if !found {
+			skipped.DataPoints = append(skipped.DataPoints, metricdata.DataPoint[int64]{
+				StartTime:  t,
+				Time:       t,
+				Value:      1,
+				Attributes: attrSet,
+			})
+		}
+	}
+	metrics := []metricdata.Metrics{
+		{
+			Name:        SelfMetricsParseLines,
+			Description: "The number of parsed log lines",
+			Unit:        "{line}",
+			Data: metricdata.Sum[int64]{
+				DataPoints: []metricdata.DataPoint[int64]{
+					{
+						StartTime: t,
+						Time:      t,
+						Value:     int64(stats.TotalLines),
+					},
+				},
+				Temporality: metricdata.DeltaTemporality,
+				IsMonotonic: true,
+			},
+		},
+	}
+	if len(skipped.DataPoints) > 0 {
+		metrics = append(metrics, metricdata.Metrics{
+			Name:        SelfMetricsParseSkippedLines,
+			Description: "The number of log lines skipped because they could not be parsed",
+			Unit:        "{line}",
+			Data:        skipped,
+		})
+	}
+	return &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attrs...),
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope: instrumentation.Scope{
+					Name:      cfg.Scope.Name,
+					Version:   cfg.Scope.Version,
+					SchemaURL: cfg.Scope.SchemaURL,
+				},
+				Metrics: metrics,
+			},
+		},
+	}, nil
+}
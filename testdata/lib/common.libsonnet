@@ -0,0 +1,12 @@
+local cel = std.native('cel');
+
+{
+  scope: {
+    name: 'cflog2otel',
+  },
+  requestCount(name):: {
+    name: name,
+    type: 'Count',
+    filter: cel('log.csMethod == "GET"'),
+  },
+}
@@ -0,0 +1,393 @@
+package cflog2otel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/mashiike/cflog2otel/otlptest"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/samber/oops"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ConfigTestCase is a test case of the config, aggregating the local log file like the S3 object.
+type ConfigTestCase struct {
+	// LogPath is the path of the CloudFront standard log file, gzipped or not.
+	LogPath string
+	// Bucket and ObjectKey are the S3 location of the log in the notification.
+	// if ObjectKey is empty, the base name of LogPath is used.
+	Bucket    string
+	ObjectKey string
+	// ExpectedPath is the path of the expected requests in the OTLP JSON encoding, one object per export request.
+	ExpectedPath string
+	Assertions   []ConfigTestAssertion
+	// Update rewrites the expected OTLP JSON with the actual output.
+	Update bool
+}
+
+// ConfigTestResult is the result of ConfigTestCase.
+type ConfigTestResult struct {
+	// Diff is the unified diff between the expected and the actual OTLP JSON, empty if they are matched.
+	Diff     string
+	Failures []string
+	Updated  bool
+}
+
+func (r *ConfigTestResult) Passed() bool {
+	return r.Diff == "" && len(r.Failures) == 0
+}
+
+// ConfigTestAssertion asserts the data points of the metric which have all the attributes.
+// Value is the total of Count and Sum data points, Count and Sum are the totals of Histogram data points.
+// if none of them is set, asserts that the data points exist.
+type ConfigTestAssertion struct {
+	Metric     string         `json:"metric"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Value      *float64       `json:"value,omitempty"`
+	Count      *uint64        `json:"count,omitempty"`
+	Sum        *float64       `json:"sum,omitempty"`
+}
+
+// LoadConfigTestAssertions loads the list of assertions from jsonnet or json file.
+func LoadConfigTestAssertions(path string, opts ...JsonnetOption) ([]ConfigTestAssertion, error) {
+	vm := MakeVM(opts...)
+	jsonStr, err := vm.EvaluateFile(path)
+	if err != nil {
+		return nil, oops.Errorf("failed to evaluate JSONnet file: %w", err)
+	}
+	var assertions []ConfigTestAssertion
+	dec := json.NewDecoder(bytes.NewReader([]byte(jsonStr)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&assertions); err != nil {
+		return nil, oops.Wrapf(err, "failed to decode assertions")
+	}
+	for i := range assertions {
+		if err := assertions[i].Validate(); err != nil {
+			return nil, oops.Wrapf(err, "assertions[%d]", i)
+		}
+	}
+	return assertions, nil
+}
+
+func (a *ConfigTestAssertion) UnmarshalJSON(data []byte) error {
+	type Alias ConfigTestAssertion
+	aux := struct {
+		*Alias
+	}{
+		Alias: (*Alias)(a),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(&aux)
+}
+
+func (a *ConfigTestAssertion) Validate() error {
+	if a.Metric == "" {
+		return oops.Errorf("metric is required")
+	}
+	return nil
+}
+
+// RunConfigTest aggregates the log of the test case in the same way as the invocation, and compares the exported OTLP JSON
+// with the expected one. the enrichment is the same as the invocation, but backfill is not performed.
+func (app *App) RunConfigTest(ctx context.Context, tc ConfigTestCase) (*ConfigTestResult, error) {
+	metrics, err := app.aggregateLocalLog(ctx, tc)
+	if err != nil {
+		return nil, err
+	}
+	result := &ConfigTestResult{}
+	for _, a := range tc.Assertions {
+		if failure := a.check(metrics); failure != "" {
+			result.Failures = append(result.Failures, failure)
+		}
+	}
+	if tc.ExpectedPath == "" {
+		return result, nil
+	}
+	actual, err := exportRequests(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	if tc.Update {
+		bs, err := encodeOTLPJSON(actual)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(tc.ExpectedPath), 0755); err != nil {
+			return nil, oops.Wrapf(err, "failed to create directory for %s", tc.ExpectedPath)
+		}
+		if err := os.WriteFile(tc.ExpectedPath, bs, 0644); err != nil {
+			return nil, oops.Wrapf(err, "failed to write %s", tc.ExpectedPath)
+		}
+		result.Updated = true
+		return result, nil
+	}
+	bs, err := os.ReadFile(tc.ExpectedPath)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to read %s, run with update to create it", tc.ExpectedPath)
+	}
+	expected, err := decodeOTLPJSON(bs)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to decode %s", tc.ExpectedPath)
+	}
+	result.Diff, err = diffRequests(expected, actual, tc.ExpectedPath)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (app *App) aggregateLocalLog(ctx context.Context, tc ConfigTestCase) ([]*metricdata.ResourceMetrics, error) {
+	bs, err := readLocalLog(tc.LogPath, 0)
+	if err != nil {
+		return nil, err
+	}
+	return app.aggregateLocalLogBytes(ctx, bs, tc.LogPath, tc.Bucket, tc.ObjectKey)
+}
+
+// readLocalLog reads the log file, decompressing if gzipped. if line is positive,
+// only the line and the header lines before it are returned.
+func readLocalLog(path string, line int) ([]byte, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to read %s", path)
+	}
+	if IsGzipped(bs) {
+		gzReader, err := gzip.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to create gzip reader")
+		}
+		defer gzReader.Close()
+		if bs, err = io.ReadAll(gzReader); err != nil {
+			return nil, oops.Wrapf(err, "failed to decompress %s", path)
+		}
+	}
+	if line <= 0 {
+		return bs, nil
+	}
+	lines := bytes.Split(bs, []byte("\n"))
+	if line > len(lines) || len(bytes.TrimSpace(lines[line-1])) == 0 {
+		return nil, oops.Errorf("line %d is not found in %s", line, path)
+	}
+	if bytes.HasPrefix(lines[line-1], []byte("#")) {
+		return nil, oops.Errorf("line %d is a header line", line)
+	}
+	selected := make([][]byte, 0)
+	for _, l := range lines[:line-1] {
+		if bytes.HasPrefix(l, []byte("#")) {
+			selected = append(selected, l)
+		}
+	}
+	selected = append(selected, lines[line-1])
+	return bytes.Join(selected, []byte("\n")), nil
+}
+
+func (app *App) aggregateLocalLogBytes(ctx context.Context, bs []byte, path, bucket, objectKey string) ([]*metricdata.ResourceMetrics, error) {
+	if objectKey == "" {
+		objectKey = filepath.Base(path)
+	}
+	var r io.Reader = bytes.NewReader(bs)
+	parser, ok := app.cfg.Parse.Parser()
+	if !ok {
+		var err error
+		parser, r, err = detectLogParser(objectKey, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logs, stats, err := ParseLog(ctx, parser, r, app.cfg.Parse)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to parse %s log", parser.Name())
+	}
+	notification := events.S3EventRecord{
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: bucket},
+			Object: events.S3Object{Key: objectKey, Size: int64(len(bs))},
+		},
+	}
+	// the event time is the timestamp of the last log, to make self metrics reproducible.
+	if len(logs) > 0 {
+		notification.EventTime = logs[len(logs)-1].Timestamp
+	}
+	var distributionID string
+	if parser.Name() == LogFormatCloudFrontStandard {
+		_, distributionID, _, _, err = ParseCFStandardLogObjectKey(objectKey)
+		if err != nil {
+			distributionID = ""
+		}
+	}
+	vars := NewCELVariables(notification, distributionID)
+	return app.aggregateLogs(ctx, notification, vars, logs, stats, app.newLookups())
+}
+
+// exportRequests exports the metrics to the in-process collector, and returns the received requests.
+func exportRequests(ctx context.Context, metrics []*metricdata.ResourceMetrics) ([]*collectormetrics.ExportMetricsServiceRequest, error) {
+	recorder := otlptest.NewRecorder()
+	collector := otlptest.NewMetricsCollector(recorder)
+	defer collector.Close()
+	var oc OtelConfig
+	if err := oc.SetEndpointURL(collector.URL); err != nil {
+		return nil, err
+	}
+	exporter, _, err := newOtelExporter(ctx, oc)
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to create OTLP exporter")
+	}
+	defer exporter.Shutdown(ctx)
+	for _, m := range metrics {
+		if err := exporter.Export(ctx, m); err != nil {
+			return nil, oops.Wrapf(err, "failed to export metrics")
+		}
+	}
+	return recorder.Requests(), nil
+}
+
+// encodeOTLPJSON encodes the requests in the OTLP JSON encoding, one indented object per request.
+// the attributes are sorted by key, so that the output is stable.
+func encodeOTLPJSON(reqs []*collectormetrics.ExportMetricsServiceRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, req := range reqs {
+		bs, err := protojson.Marshal(otlptest.Normalize(req))
+		if err != nil {
+			return nil, oops.Wrapf(err, "failed to encode request")
+		}
+		// protojson output is intentionally unstable in whitespace, so re-indent it.
+		if err := json.Indent(&buf, bs, "", "  "); err != nil {
+			return nil, oops.Wrapf(err, "failed to indent request")
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeOTLPJSON decodes the stream of the requests in the OTLP JSON encoding.
+func decodeOTLPJSON(bs []byte) ([]*collectormetrics.ExportMetricsServiceRequest, error) {
+	var reqs []*collectormetrics.ExportMetricsServiceRequest
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return reqs, nil
+			}
+			return nil, err
+		}
+		req := &collectormetrics.ExportMetricsServiceRequest{}
+		if err := protojson.Unmarshal(raw, req); err != nil {
+			return nil, oops.Wrapf(err, "request[%d]", len(reqs))
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+// diffRequests returns the unified diff of the requests, empty if they are equal ignoring the order of attributes.
+func diffRequests(expected, actual []*collectormetrics.ExportMetricsServiceRequest, name string) (string, error) {
+	if len(expected) == len(actual) {
+		equal := true
+		for i := range expected {
+			if !otlptest.Equal(expected[i], actual[i]) {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return "", nil
+		}
+	}
+	eb, err := encodeOTLPJSON(expected)
+	if err != nil {
+		return "", err
+	}
+	ab, err := encodeOTLPJSON(actual)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(eb)),
+		B:        difflib.SplitLines(string(ab)),
+		FromFile: name,
+		ToFile:   "actual",
+		Context:  3,
+	})
+}
+
+// check returns the failure message, or empty if the assertion is satisfied.
+func (a *ConfigTestAssertion) check(metrics []*metricdata.ResourceMetrics) string {
+	var (
+		found      int
+		value, sum float64
+		count      uint64
+	)
+	for _, rm := range metrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != a.Metric {
+					continue
+				}
+				switch data := m.Data.(type) {
+				case metricdata.Sum[int64]:
+					for _, dp := range data.DataPoints {
+						if a.matchAttributes(dp.Attributes) {
+							found++
+							value += float64(dp.Value)
+						}
+					}
+				case metricdata.Sum[float64]:
+					for _, dp := range data.DataPoints {
+						if a.matchAttributes(dp.Attributes) {
+							found++
+							value += dp.Value
+						}
+					}
+				case metricdata.Histogram[float64]:
+					for _, dp := range data.DataPoints {
+						if a.matchAttributes(dp.Attributes) {
+							found++
+							count += dp.Count
+							sum += dp.Sum
+						}
+					}
+				}
+			}
+		}
+	}
+	name := a.Metric
+	if len(a.Attributes) > 0 {
+		bs, _ := json.Marshal(a.Attributes)
+		name += string(bs)
+	}
+	switch {
+	case found == 0:
+		return fmt.Sprintf("%s: no data points", name)
+	case a.Value != nil && value != *a.Value:
+		return fmt.Sprintf("%s: value expected %v, got %v", name, *a.Value, value)
+	case a.Count != nil && count != *a.Count:
+		return fmt.Sprintf("%s: count expected %v, got %v", name, *a.Count, count)
+	case a.Sum != nil && sum != *a.Sum:
+		return fmt.Sprintf("%s: sum expected %v, got %v", name, *a.Sum, sum)
+	}
+	return ""
+}
+
+func (a *ConfigTestAssertion) matchAttributes(set attribute.Set) bool {
+	for k, expected := range a.Attributes {
+		v, ok := set.Value(attribute.Key(k))
+		if !ok {
+			return false
+		}
+		if fmt.Sprint(v.AsInterface()) != fmt.Sprint(expected) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp__RunConfigTest(t *testing.T) {
+	ctrl := newMockControler(t)
+	defer ctrl.Finish()
+	cfg := cflog2otel.DefaultConfig()
+	require.NoError(t, cfg.Load("testdata/request_count_by_status_category.jsonnet", cflog2otel.WithAWSConfig(aws.Config{})))
+	app, err := cflog2otel.NewWithClient(cfg, newMockS3APIClient(ctrl))
+	require.NoError(t, err)
+	ctx := context.Background()
+	expectedPath := filepath.Join(t.TempDir(), "expected", "request_count.json")
+	tc := cflog2otel.ConfigTestCase{
+		LogPath:      "testdata/cf_log.txt",
+		Bucket:       "example-bucket",
+		ObjectKey:    "logs/EMLARXS9EXAMPLE.2019-12-01-22.RT4KCN4SGK9.gz",
+		ExpectedPath: expectedPath,
+		Update:       true,
+	}
+
+	result, err := app.RunConfigTest(ctx, tc)
+	require.NoError(t, err)
+	require.True(t, result.Updated)
+	require.True(t, result.Passed())
+	bs, err := os.ReadFile(expectedPath)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "EMLARXS9EXAMPLE")
+
+	tc.Update = false
+	result, err = app.RunConfigTest(ctx, tc)
+	require.NoError(t, err)
+	require.True(t, result.Passed(), result.Diff)
+
+	require.NoError(t, os.WriteFile(expectedPath, []byte(strings.Replace(string(bs), "2xx", "3xx", 1)), 0644))
+	result, err = app.RunConfigTest(ctx, tc)
+	require.NoError(t, err)
+	require.False(t, result.Passed())
+	require.Contains(t, result.Diff, `-                          "stringValue": "3xx"`)
+	require.Contains(t, result.Diff, `+                          "stringValue": "2xx"`)
+
+	// the order of attributes is not significant
+	distributionID := `{
+            "key": "aws.cloudfront.distribution_id",
+            "value": {
+              "stringValue": "EMLARXS9EXAMPLE"
+            }
+          }`
+	serviceName := `{
+            "key": "service.name",
+            "value": {
+              "stringValue": "Amazon CloudFront"
+            }
+          }`
+	require.Contains(t, string(bs), distributionID+",\n          "+serviceName)
+	swapped := strings.Replace(string(bs), distributionID+",\n          "+serviceName, serviceName+",\n          "+distributionID, 1)
+	require.NoError(t, os.WriteFile(expectedPath, []byte(swapped), 0644))
+	result, err = app.RunConfigTest(ctx, tc)
+	require.NoError(t, err)
+	require.True(t, result.Passed(), result.Diff)
+
+	tc.ExpectedPath = ""
+	tc.Assertions, err = cflog2otel.LoadConfigTestAssertions("testdata/config_test_assertions.jsonnet")
+	require.NoError(t, err)
+	result, err = app.RunConfigTest(ctx, tc)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`http.server.requests{"http.status_code":"4xx"}: no data points`,
+		`http.server.requests{"http.status_code":"5xx"}: value expected 2, got 3`,
+	}, result.Failures)
+}
@@ -0,0 +1,285 @@
+package cflog2otel
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed user_agent_rules.yaml
+var defaultUserAgentRulesYAML []byte
+
+var defaultUserAgentParser *UserAgentParser
+
+func init() {
+	rules, err := ParseUserAgentRules(defaultUserAgentRulesYAML)
+	if err != nil {
+		panic(oops.Wrapf(err, "failed to parse default user agent rules"))
+	}
+	defaultUserAgentParser, err = NewUserAgentParser(rules)
+	if err != nil {
+		panic(oops.Wrapf(err, "failed to create default user agent parser"))
+	}
+}
+
+// UserAgentRules is a set of regex rules for ua.* CEL functions.
+type UserAgentRules struct {
+	Bots     []UserAgentRule `yaml:"bots"`
+	Browsers []UserAgentRule `yaml:"browsers"`
+	OS       []UserAgentRule `yaml:"os"`
+	Devices  []UserAgentRule `yaml:"devices"`
+}
+
+type UserAgentRule struct {
+	Regex string `yaml:"regex"`
+	Name  string `yaml:"name"`
+	re    *regexp.Regexp
+}
+
+func ParseUserAgentRules(data []byte) (*UserAgentRules, error) {
+	var rules UserAgentRules
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil {
+		return nil, oops.Wrapf(err, "failed to decode user agent rules")
+	}
+	return &rules, nil
+}
+
+// LoadUserAgentRules loads the rules file from a local path or s3:// URL.
+// sections defined in the file replace the built-in ones.
+func LoadUserAgentRules(ctx context.Context, cfg *UserAgentConfig, downloader *manager.Downloader) (*UserAgentParser, error) {
+	data, err := readLocalOrS3File(ctx, cfg.Rules, downloader)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseUserAgentRules(data)
+	if err != nil {
+		return nil, oops.Wrapf(err, "rules %s", cfg.Rules)
+	}
+	defaultRules := defaultUserAgentParser.rules
+	if rules.Bots == nil {
+		rules.Bots = slices.Clone(defaultRules.Bots)
+	}
+	if rules.Browsers == nil {
+		rules.Browsers = slices.Clone(defaultRules.Browsers)
+	}
+	if rules.OS == nil {
+		rules.OS = slices.Clone(defaultRules.OS)
+	}
+	if rules.Devices == nil {
+		rules.Devices = slices.Clone(defaultRules.Devices)
+	}
+	return NewUserAgentParser(rules)
+}
+
+// UserAgentParser classifies User-Agent strings by the rules.
+type UserAgentParser struct {
+	rules *UserAgentRules
+}
+
+// NewUserAgentParser compiles the rules. the rules are copied, so the slices of the argument are not modified,
+// and they can be shared with the parser in use, e.g. the sections of the built-in rules.
+func NewUserAgentParser(rules *UserAgentRules) (*UserAgentParser, error) {
+	rules = &UserAgentRules{
+		Bots:     slices.Clone(rules.Bots),
+		Browsers: slices.Clone(rules.Browsers),
+		OS:       slices.Clone(rules.OS),
+		Devices:  slices.Clone(rules.Devices),
+	}
+	compile := func(section string, rs []UserAgentRule) error {
+		for i := range rs {
+			re, err := regexp.Compile(rs[i].Regex)
+			if err != nil {
+				return oops.Wrapf(err, "%s[%d]", section, i)
+			}
+			rs[i].re = re
+		}
+		return nil
+	}
+	if err := compile("bots", rules.Bots); err != nil {
+		return nil, err
+	}
+	if err := compile("browsers", rules.Browsers); err != nil {
+		return nil, err
+	}
+	if err := compile("os", rules.OS); err != nil {
+		return nil, err
+	}
+	if err := compile("devices", rules.Devices); err != nil {
+		return nil, err
+	}
+	return &UserAgentParser{rules: rules}, nil
+}
+
+type UserAgent struct {
+	Browser    string
+	OS         string
+	DeviceType string
+	IsBot      bool
+}
+
+func (p *UserAgentParser) Parse(s string) UserAgent {
+	ua := UserAgent{
+		Browser:    "Other",
+		OS:         "Other",
+		DeviceType: "other",
+	}
+	if s == "" {
+		return ua
+	}
+	for _, r := range p.rules.Bots {
+		if r.re.MatchString(s) {
+			ua.IsBot = true
+			break
+		}
+	}
+	if name, ok := matchUserAgentRules(p.rules.Browsers, s); ok {
+		ua.Browser = name
+	}
+	if name, ok := matchUserAgentRules(p.rules.OS, s); ok {
+		ua.OS = name
+	}
+	if ua.IsBot {
+		ua.DeviceType = "bot"
+	} else if name, ok := matchUserAgentRules(p.rules.Devices, s); ok {
+		ua.DeviceType = name
+	}
+	return ua
+}
+
+func matchUserAgentRules(rules []UserAgentRule, s string) (string, bool) {
+	for _, r := range rules {
+		if r.re.MatchString(s) {
+			return r.Name, true
+		}
+	}
+	return "", false
+}
+
+// NewLookup returns a CEL value for `ua` variable. parse results are cached in the returned value,
+// so create a new one for each invocation.
+func (p *UserAgentParser) NewLookup() *CELUserAgent {
+	return &CELUserAgent{
+		parser: p,
+		cache:  make(map[string]UserAgent),
+	}
+}
+
+// CELUserAgentType is the CEL type of `ua` variable.
+var CELUserAgentType = types.NewOpaqueType("cflog2otel.UserAgent")
+
+// CELUserAgent is the CEL value of `ua` variable.
+type CELUserAgent struct {
+	parser *UserAgentParser
+	mu     sync.Mutex
+	cache  map[string]UserAgent
+}
+
+func (u *CELUserAgent) parse(s string) UserAgent {
+	parser := defaultUserAgentParser
+	if u != nil && u.parser != nil {
+		parser = u.parser
+	}
+	if u == nil || u.cache == nil {
+		return parser.Parse(s)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ua, ok := u.cache[s]; ok {
+		return ua
+	}
+	ua := parser.Parse(s)
+	u.cache[s] = ua
+	return ua
+}
+
+func (u *CELUserAgent) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", CELUserAgentType, typeDesc)
+}
+
+func (u *CELUserAgent) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return CELUserAgentType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CELUserAgentType, typeVal)
+}
+
+func (u *CELUserAgent) Equal(other ref.Val) ref.Val {
+	return types.Bool(u == other)
+}
+
+func (u *CELUserAgent) Type() ref.Type {
+	return CELUserAgentType
+}
+
+func (u *CELUserAgent) Value() any {
+	return u
+}
+
+// UserAgentCELLib returns CEL functions for `ua` variable.
+//
+//	ua.browser(string) -> string
+//	ua.os(string) -> string
+//	ua.deviceType(string) -> string
+//	ua.isBot(string) -> bool
+func UserAgentCELLib() cel.EnvOption {
+	return cel.Lib(userAgentCELLib{})
+}
+
+type userAgentCELLib struct{}
+
+func (userAgentCELLib) LibraryName() string {
+	return "cflog2otel.useragent"
+}
+
+func (userAgentCELLib) CompileOptions() []cel.EnvOption {
+	overload := func(name string, resultType *cel.Type, fn func(UserAgent) ref.Val) cel.EnvOption {
+		return cel.Function(name,
+			cel.MemberOverload("ua_"+name+"_string", []*cel.Type{CELUserAgentType, cel.StringType}, resultType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					u, ok := lhs.(*CELUserAgent)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					s, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return fn(u.parse(string(s)))
+				}),
+			),
+		)
+	}
+	return []cel.EnvOption{
+		cel.Variable("ua", CELUserAgentType),
+		overload("browser", cel.StringType, func(ua UserAgent) ref.Val {
+			return types.String(ua.Browser)
+		}),
+		overload("os", cel.StringType, func(ua UserAgent) ref.Val {
+			return types.String(ua.OS)
+		}),
+		overload("deviceType", cel.StringType, func(ua UserAgent) ref.Val {
+			return types.String(ua.DeviceType)
+		}),
+		overload("isBot", cel.BoolType, func(ua UserAgent) ref.Val {
+			return types.Bool(ua.IsBot)
+		}),
+	}
+}
+
+func (userAgentCELLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{}
+}
@@ -0,0 +1,114 @@
+package cflog2otel_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/mashiike/cflog2otel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgentParser(t *testing.T) {
+	cases := []struct {
+		name string
+		ua   string
+		want cflog2otel.UserAgent
+	}{
+		{
+			name: "chrome on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/78.0.3904.108 Safari/537.36",
+			want: cflog2otel.UserAgent{Browser: "Chrome", OS: "Windows", DeviceType: "desktop"},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			want: cflog2otel.UserAgent{Browser: "Safari", OS: "iOS", DeviceType: "mobile"},
+		},
+		{
+			name: "edge on mac",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			want: cflog2otel.UserAgent{Browser: "Edge", OS: "macOS", DeviceType: "desktop"},
+		},
+		{
+			name: "googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: cflog2otel.UserAgent{Browser: "Other", OS: "Other", DeviceType: "bot", IsBot: true},
+		},
+		{
+			name: "curl",
+			ua:   "curl/7.55.1",
+			want: cflog2otel.UserAgent{Browser: "curl", OS: "Other", DeviceType: "bot", IsBot: true},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: cflog2otel.UserAgent{Browser: "Other", OS: "Other", DeviceType: "other"},
+		},
+	}
+	rules, err := cflog2otel.LoadUserAgentRules(context.Background(), &cflog2otel.UserAgentConfig{
+		Rules: "testdata/user_agent_rules.yaml",
+	}, nil)
+	require.NoError(t, err)
+	lookup := rules.NewLookup()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			variables := &cflog2otel.CELVariables{
+				Log: cflog2otel.CELVariablesLog{CsUserAgent: ptr(c.ua)},
+			}
+			testCaseCELCapable[string]{
+				expr:      `cel('ua.browser(log.csUserAgent) + "/" + ua.os(log.csUserAgent) + "/" + ua.deviceType(log.csUserAgent)')`,
+				variables: variables,
+				want:      c.want.Browser + "/" + c.want.OS + "/" + c.want.DeviceType,
+			}.Run(t)
+			testCaseCELCapable[bool]{
+				expr:      `cel('ua.isBot(log.csUserAgent)')`,
+				variables: variables,
+				want:      c.want.IsBot,
+			}.Run(t)
+		})
+	}
+	t.Run("override rules", func(t *testing.T) {
+		require.Equal(t, cflog2otel.UserAgent{Browser: "Safari", OS: "iOS", DeviceType: "smartphone"}, rules.Parse(cases[1].ua))
+		require.Equal(t, cflog2otel.UserAgent{Browser: "Chrome", OS: "Windows", DeviceType: "other"}, rules.Parse(cases[0].ua))
+		variables := &cflog2otel.CELVariables{
+			Log:       cflog2otel.CELVariablesLog{CsUserAgent: ptr(cases[1].ua)},
+			UserAgent: lookup,
+		}
+		testCaseCELCapable[string]{
+			expr:      `cel('ua.deviceType(log.csUserAgent)')`,
+			variables: variables,
+			want:      "smartphone",
+		}.Run(t)
+	})
+}
+
+func TestLoadUserAgentRules__DefaultParserInUse(t *testing.T) {
+	// the override file omits sections, which are shared with the built-in rules in use by the concurrent invocations.
+	var expr cflog2otel.CELCapable[string]
+	require.NoError(t, json.Unmarshal([]byte(`{"expr": "ua.browser(log.csUserAgent)"}`), &expr))
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vars := &cflog2otel.CELVariables{}
+			vars.SetLogLine(cflog2otel.CELVariablesLog{CsUserAgent: ptr(ua)})
+			for range 100 {
+				if got, err := expr.Eval(context.Background(), vars); err != nil || got != "Chrome" {
+					t.Errorf("unexpected result: %q, %v", got, err)
+					return
+				}
+			}
+		}()
+	}
+	for range 10 {
+		_, err := cflog2otel.LoadUserAgentRules(context.Background(), &cflog2otel.UserAgentConfig{
+			Rules: "testdata/user_agent_rules.yaml",
+		}, nil)
+		require.NoError(t, err)
+	}
+	wg.Wait()
+}